@@ -0,0 +1,197 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 基于 redis 的缓存
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/liuchonglin/go-tools/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 数据不存在，loader 返回该错误时会缓存不存在的结果
+var ErrNotFound = errors.New("cache: not found")
+
+// 数据不存在时缓存的值，不是合法的 json，不会与正常数据冲突
+const notFoundValue = "#notfound"
+
+// 后台刷新的超时时间
+const refreshTimeout = 30 * time.Second
+
+// 从数据源加载数据，数据不存在时返回 ErrNotFound
+type Loader func(ctx context.Context) (interface{}, error)
+
+// 旁路缓存，数据以 json 格式保存在 redis 中
+type Cache struct {
+	redis       *redis.Redis
+	cacheConfig *CacheConfig
+	loads       singleflight
+	refreshes   singleflight
+}
+
+func New(r *redis.Redis, cacheConfig *CacheConfig) (*Cache, error) {
+	if r == nil {
+		return nil, fmt.Errorf("redis 不能为空")
+	}
+	if cacheConfig == nil {
+		cacheConfig = &CacheConfig{}
+	}
+	cacheConfig.defaultValue()
+	return &Cache{redis: r, cacheConfig: cacheConfig}, nil
+}
+
+// 从缓存获取数据并解析到 dst 中，缓存未命中时调用 loader 加载并写入缓存
+// 同一进程内相同 key 的并发加载只会调用一次 loader
+// 数据不存在时返回 ErrNotFound
+func (c *Cache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, dst interface{}, loader Loader) error {
+	if utils.IsEmpty(key) {
+		return fmt.Errorf("key 不能为空")
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("ttl 必须大于 0")
+	}
+	if loader == nil {
+		return fmt.Errorf("loader 不能为空")
+	}
+	value, pttl, err := c.get(key)
+	if err != nil {
+		return err
+	}
+	if value != "" {
+		if c.needRefresh(ttl, pttl) {
+			c.refresh(key, ttl, loader)
+		}
+		return decode(value, dst)
+	}
+
+	for {
+		v, err, shared := c.loads.do(key, func() (interface{}, error) {
+			return c.load(ctx, key, ttl, loader)
+		})
+		// 共享的加载因发起方的 ctx 结束而失败时，用自己的 ctx 重新加载
+		if shared && isContextError(err) && ctx.Err() == nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return decode(v.(string), dst)
+	}
+}
+
+// 删除缓存
+func (c *Cache) Del(key string) error {
+	return c.redis.Del(key)
+}
+
+// 获取缓存的值及剩余过期时间，未命中时 value 为空
+func (c *Cache) get(key string) (value string, pttl time.Duration, err error) {
+	p := c.redis.Pipeline()
+	getReply := p.Get(key)
+	pttlReply := p.Send("pttl", key)
+	if _, err := p.Exec(); err != nil {
+		return "", 0, err
+	}
+	if value, err = getReply.String(); err != nil {
+		return "", 0, err
+	}
+	ms, err := pttlReply.Int64()
+	if err != nil {
+		return "", 0, err
+	}
+	return value, time.Duration(ms) * time.Millisecond, nil
+}
+
+// 调用 loader 并写入缓存，返回写入的值
+func (c *Cache) load(ctx context.Context, key string, ttl time.Duration, loader Loader) (string, error) {
+	data, err := loader(ctx)
+	if errors.Is(err, ErrNotFound) {
+		notFoundTTL := time.Duration(c.cacheConfig.NotFoundTTL) * time.Second
+		if err := c.set(key, notFoundValue, notFoundTTL); err != nil {
+			return "", err
+		}
+		return notFoundValue, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	value := string(b)
+	if err := c.set(key, value, c.jitter(ttl)); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// 在后台重新加载，相同 key 同时只有一个刷新在执行
+func (c *Cache) refresh(key string, ttl time.Duration, loader Loader) {
+	c.refreshes.tryDo(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		return c.load(ctx, key, ttl, loader)
+	})
+}
+
+func (c *Cache) needRefresh(ttl time.Duration, pttl time.Duration) bool {
+	if c.cacheConfig.RefreshAhead <= 0 || pttl <= 0 {
+		return false
+	}
+	return float64(pttl) < float64(ttl)*c.cacheConfig.RefreshAhead
+}
+
+func (c *Cache) set(key string, value string, ttl time.Duration) error {
+	return setPX(c.redis, key, value, ttl)
+}
+
+// 在 ttl 基础上增加随机时长
+func (c *Cache) jitter(ttl time.Duration) time.Duration {
+	if c.cacheConfig.Jitter <= 0 {
+		return ttl
+	}
+	max := int64(float64(ttl) * c.cacheConfig.Jitter)
+	if max <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Int63n(max))
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// 设置值并原子地设置毫秒级过期时间
+func setPX(r *redis.Redis, key string, value string, ttl time.Duration) error {
+	_, err := r.SetWithOptions(key, value, &redis.SetOptions{Expire: ttl})
+	return err
+}
+
+func decode(value string, dst interface{}) error {
+	if value == notFoundValue {
+		return ErrNotFound
+	}
+	if dst == nil {
+		return nil
+	}
+	return json.Unmarshal([]byte(value), dst)
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 缓存配置
+package cache
+
+var cacheConfig *CacheConfig
+
+// 缓存配置
+type CacheConfig struct {
+	// 过期时间随机抖动比例，避免大量 key 同时过期
+	// 默认值：0.1
+	Jitter float64 `json:"jitter" yaml:"jitter"`
+	// 数据不存在时的缓存时间，单位：秒
+	// 默认值：60
+	NotFoundTTL int `json:"notFoundTTL" yaml:"notFoundTTL"`
+	// 剩余过期时间低于 ttl 的该比例时在后台提前刷新，0 表示不提前刷新
+	// 默认值：0
+	RefreshAhead float64 `json:"refreshAhead" yaml:"refreshAhead"`
+}
+
+func GetCacheConfig() *CacheConfig {
+	if cacheConfig == nil {
+		cacheConfig = &CacheConfig{}
+		cacheConfig.defaultValue()
+	}
+	return cacheConfig
+}
+
+func (c *CacheConfig) defaultValue() {
+	if c.Jitter == 0 {
+		c.Jitter = 0.1
+	}
+	if c.NotFoundTTL == 0 {
+		c.NotFoundTTL = 60
+	}
+}
+
+// 二级缓存配置
+type NearCacheConfig struct {
+	// 本地缓存最大条目数
+	// 默认值：10000
+	Capacity int `json:"capacity" yaml:"capacity"`
+	// 本地缓存过期时间，单位：秒
+	// 默认值：60
+	LocalTTL int `json:"localTTL" yaml:"localTTL"`
+	// 广播失效通知的 redis 频道
+	// 默认值：nearcache:invalidate
+	Channel string `json:"channel" yaml:"channel"`
+}
+
+func (n *NearCacheConfig) defaultValue() {
+	if n.Capacity == 0 {
+		n.Capacity = 10000
+	}
+	if n.LocalTTL == 0 {
+		n.LocalTTL = 60
+	}
+	if n.Channel == "" {
+		n.Channel = "nearcache:invalidate"
+	}
+}
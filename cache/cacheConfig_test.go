@@ -0,0 +1,43 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 缓存配置
+package cache
+
+import (
+	"testing"
+)
+
+func TestGetCacheConfig(t *testing.T) {
+	tests := []struct {
+		name string
+	}{
+		{
+			name: "ok",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			GetCacheConfig()
+		})
+	}
+}
+
+func TestNearCacheConfigDefaultValue(t *testing.T) {
+	n := &NearCacheConfig{}
+	n.defaultValue()
+	if n.Capacity != 10000 || n.LocalTTL != 60 || n.Channel != "nearcache:invalidate" {
+		t.Errorf("defaultValue() = %+v", n)
+	}
+}
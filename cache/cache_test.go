@@ -0,0 +1,245 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 基于 redis 的缓存
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/liuchonglin/go-tools/redis"
+	"github.com/liuchonglin/go-tools/redis/redistest"
+)
+
+type testProduct struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+var redisConfig = &redis.RedisConfig{
+	MaxIdle:     16,
+	MaxActive:   100,
+	IdleTimeout: 300,
+}
+
+var redisTool *redis.Redis
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		redis   *redis.Redis
+		wantErr bool
+	}{
+		{
+			name:  "all",
+			redis: redisTool,
+		}, {
+			name:    "redis nil",
+			redis:   nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.redis, nil); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	c, _ := New(redisTool, nil)
+	loadErr := errors.New("load error")
+	loader := func(ctx context.Context) (interface{}, error) {
+		return &testProduct{Id: 1, Name: "phone"}, nil
+	}
+	tests := []struct {
+		name    string
+		key     string
+		ttl     time.Duration
+		loader  Loader
+		want    testProduct
+		wantErr error
+	}{
+		{
+			name:   "all",
+			key:    "cache:product:1",
+			ttl:    time.Minute,
+			loader: loader,
+			want:   testProduct{Id: 1, Name: "phone"},
+		}, {
+			name:   "hit",
+			key:    "cache:product:1",
+			ttl:    time.Minute,
+			loader: func(ctx context.Context) (interface{}, error) { return nil, loadErr },
+			want:   testProduct{Id: 1, Name: "phone"},
+		}, {
+			name:    "not found",
+			key:     "cache:product:2",
+			ttl:     time.Minute,
+			loader:  func(ctx context.Context) (interface{}, error) { return nil, ErrNotFound },
+			wantErr: ErrNotFound,
+		}, {
+			name:    "not found cached",
+			key:     "cache:product:2",
+			ttl:     time.Minute,
+			loader:  loader,
+			wantErr: ErrNotFound,
+		}, {
+			name:    "load error",
+			key:     "cache:product:3",
+			ttl:     time.Minute,
+			loader:  func(ctx context.Context) (interface{}, error) { return nil, loadErr },
+			wantErr: loadErr,
+		},
+	}
+	redisTool.MDel("cache:product:1", "cache:product:2", "cache:product:3")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testProduct
+			err := c.GetOrLoad(context.Background(), tt.key, tt.ttl, &got, tt.loader)
+			if err != tt.wantErr {
+				t.Errorf("GetOrLoad() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetOrLoad() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetOrLoadValidate(t *testing.T) {
+	c, _ := New(redisTool, nil)
+	loader := func(ctx context.Context) (interface{}, error) { return 1, nil }
+	var dst int
+	if err := c.GetOrLoad(context.Background(), "", time.Minute, &dst, loader); err == nil {
+		t.Errorf("GetOrLoad() key nil error = nil, wantErr true")
+	}
+	if err := c.GetOrLoad(context.Background(), "cache:validate", 0, &dst, loader); err == nil {
+		t.Errorf("GetOrLoad() ttl zero error = nil, wantErr true")
+	}
+	if err := c.GetOrLoad(context.Background(), "cache:validate", time.Minute, &dst, nil); err == nil {
+		t.Errorf("GetOrLoad() loader nil error = nil, wantErr true")
+	}
+}
+
+// 并发未命中时只加载一次
+func TestGetOrLoadSingleflight(t *testing.T) {
+	c, _ := New(redisTool, nil)
+	c.Del("cache:singleflight")
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got int
+			err := c.GetOrLoad(context.Background(), "cache:singleflight", time.Minute, &got,
+				func(ctx context.Context) (interface{}, error) {
+					atomic.AddInt32(&calls, 1)
+					time.Sleep(100 * time.Millisecond)
+					return 42, nil
+				})
+			if err != nil || got != 42 {
+				t.Errorf("GetOrLoad() = %v, %v, want 42, nil", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("GetOrLoad() loader calls = %v, want 1", calls)
+	}
+}
+
+// 共享的加载因发起方 ctx 取消而失败时，等待方用自己的 ctx 重新加载
+func TestGetOrLoadSharedContext(t *testing.T) {
+	c, _ := New(redisTool, nil)
+	c.Del("cache:shared")
+	started := make(chan struct{})
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan error, 1)
+	go func() {
+		var got int
+		leaderDone <- c.GetOrLoad(leaderCtx, "cache:shared", time.Minute, &got,
+			func(ctx context.Context) (interface{}, error) {
+				close(started)
+				<-ctx.Done()
+				return nil, ctx.Err()
+			})
+	}()
+	<-started
+	waiterDone := make(chan error, 1)
+	var got int
+	go func() {
+		waiterDone <- c.GetOrLoad(context.Background(), "cache:shared", time.Minute, &got,
+			func(ctx context.Context) (interface{}, error) { return 7, nil })
+	}()
+	// 等待方进入等待后再取消发起方
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("GetOrLoad() leader error = %v, want %v", err, context.Canceled)
+	}
+	if err := <-waiterDone; err != nil || got != 7 {
+		t.Errorf("GetOrLoad() waiter = %v, %v, want 7, nil", got, err)
+	}
+}
+
+// 剩余时间不足时后台提前刷新
+func TestGetOrLoadRefreshAhead(t *testing.T) {
+	c, _ := New(redisTool, &CacheConfig{Jitter: -1, RefreshAhead: 0.9})
+	c.Del("cache:refresh")
+	var version int32
+	loader := func(ctx context.Context) (interface{}, error) {
+		return atomic.AddInt32(&version, 1), nil
+	}
+	var got int32
+	if err := c.GetOrLoad(context.Background(), "cache:refresh", 2*time.Second, &got, loader); err != nil || got != 1 {
+		t.Fatalf("GetOrLoad() = %v, %v, want 1, nil", got, err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	// 命中旧值并触发后台刷新
+	if err := c.GetOrLoad(context.Background(), "cache:refresh", 2*time.Second, &got, loader); err != nil || got != 1 {
+		t.Fatalf("GetOrLoad() = %v, %v, want 1, nil", got, err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := c.GetOrLoad(context.Background(), "cache:refresh", 2*time.Second, &got, loader); err != nil || got != 2 {
+		t.Errorf("GetOrLoad() after refresh = %v, %v, want 2, nil", got, err)
+	}
+}
+
+func TestMain(m *testing.M) {
+	// 使用内存 redis 服务，不依赖外部环境
+	server, err := redistest.NewServer()
+	if err != nil {
+		panic(err)
+	}
+	redisConfig.Address = server.Addr()
+	redisTool, err = redis.NewRedis(redisConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
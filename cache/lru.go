@@ -0,0 +1,153 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 本地 LRU 缓存
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type lruEntry struct {
+	key      string
+	value    string
+	expireAt time.Time
+}
+
+// 容量有限的 LRU，每个条目单独设置过期时间，并发安全
+// 从 redis 加载值期间 key 被修改、删除或缓存被清空时，加载的旧值不会写入，见 startLoad/finishLoad
+type lru struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	// 每次修改、删除或清空时递增
+	gen uint64
+	// 正在加载的 key 及加载次数
+	loading map[string]int
+	// 正在加载的 key 最后一次被修改或删除时的 gen
+	changed map[string]uint64
+	// 最后一次清空时的 gen
+	flushed uint64
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{capacity: capacity, ll: list.New(), items: make(map[string]*list.Element),
+		loading: make(map[string]int), changed: make(map[string]uint64)}
+}
+
+// 获取未过期的值，过期的条目会被删除
+func (l *lru) get(key string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := e.Value.(*lruEntry)
+	if time.Now().After(entry.expireAt) {
+		l.removeElement(e)
+		return "", false
+	}
+	l.ll.MoveToFront(e)
+	return entry.value, true
+}
+
+// 写入值，超过容量时淘汰最久未使用的条目
+func (l *lru) set(key string, value string, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.change(key)
+	l.setLocked(key, value, ttl)
+}
+
+// 开始从 redis 加载 key，返回当前的 gen，加载完成后必须调用 finishLoad
+func (l *lru) startLoad(key string) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.loading[key]++
+	return l.gen
+}
+
+// 加载完成，加载期间 key 没有被修改、删除且缓存没有被清空时写入值，返回是否写入
+// ok 为 false 表示加载失败，只结束加载
+func (l *lru) finishLoad(key string, gen uint64, value string, ttl time.Duration, ok bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stale := l.changed[key] > gen || l.flushed > gen
+	if l.loading[key]--; l.loading[key] <= 0 {
+		delete(l.loading, key)
+		delete(l.changed, key)
+	}
+	if !ok || stale {
+		return false
+	}
+	l.setLocked(key, value, ttl)
+	return true
+}
+
+// 清空所有条目，正在加载的值也不会写入
+func (l *lru) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.gen++
+	l.flushed = l.gen
+	l.ll.Init()
+	l.items = make(map[string]*list.Element)
+}
+
+// 记录 key 被修改或删除，调用时需持有 mu
+func (l *lru) change(key string) {
+	l.gen++
+	if l.loading[key] > 0 {
+		l.changed[key] = l.gen
+	}
+}
+
+func (l *lru) setLocked(key string, value string, ttl time.Duration) {
+	expireAt := time.Now().Add(ttl)
+	if e, ok := l.items[key]; ok {
+		entry := e.Value.(*lruEntry)
+		entry.value = value
+		entry.expireAt = expireAt
+		l.ll.MoveToFront(e)
+		return
+	}
+	l.items[key] = l.ll.PushFront(&lruEntry{key: key, value: value, expireAt: expireAt})
+	for l.ll.Len() > l.capacity {
+		l.removeElement(l.ll.Back())
+	}
+}
+
+func (l *lru) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.change(key)
+	if e, ok := l.items[key]; ok {
+		l.removeElement(e)
+	}
+}
+
+func (l *lru) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len()
+}
+
+func (l *lru) removeElement(e *list.Element) {
+	l.ll.Remove(e)
+	delete(l.items, e.Value.(*lruEntry).key)
+}
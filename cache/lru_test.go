@@ -0,0 +1,97 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 本地 LRU 缓存
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	l := newLRU(2)
+	l.set("a", "1", time.Minute)
+	l.set("b", "2", time.Minute)
+	// 访问 a 后 b 成为最久未使用的条目
+	if v, ok := l.get("a"); !ok || v != "1" {
+		t.Errorf("get(a) = %v, %v, want 1, true", v, ok)
+	}
+	l.set("c", "3", time.Minute)
+	if _, ok := l.get("b"); ok {
+		t.Errorf("get(b) ok = true, want evicted")
+	}
+	if l.len() != 2 {
+		t.Errorf("len() = %v, want 2", l.len())
+	}
+	l.remove("a")
+	if _, ok := l.get("a"); ok {
+		t.Errorf("get(a) ok = true, want removed")
+	}
+}
+
+func TestLRUExpire(t *testing.T) {
+	l := newLRU(10)
+	l.set("a", "1", 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := l.get("a"); ok {
+		t.Errorf("get(a) ok = true, want expired")
+	}
+	if l.len() != 0 {
+		t.Errorf("len() = %v, want 0", l.len())
+	}
+}
+
+func TestLRULoad(t *testing.T) {
+	tests := []struct {
+		name   string
+		during func(l *lru)
+		want   bool
+	}{
+		{
+			name:   "unchanged",
+			during: func(l *lru) {},
+			want:   true,
+		}, {
+			name:   "removed",
+			during: func(l *lru) { l.remove("a") },
+			want:   false,
+		}, {
+			name:   "set",
+			during: func(l *lru) { l.set("a", "new", time.Minute) },
+			want:   false,
+		}, {
+			name:   "flushed",
+			during: func(l *lru) { l.flush() },
+			want:   false,
+		}, {
+			name:   "other key removed",
+			during: func(l *lru) { l.remove("b") },
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLRU(10)
+			gen := l.startLoad("a")
+			tt.during(l)
+			if got := l.finishLoad("a", gen, "loaded", time.Minute, true); got != tt.want {
+				t.Errorf("finishLoad() = %v, want %v", got, tt.want)
+			}
+			if len(l.loading) != 0 || len(l.changed) != 0 {
+				t.Errorf("loading = %v, changed = %v, want empty", l.loading, l.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 二级缓存：本地 LRU + redis
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/liuchonglin/go-tools/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 二级缓存，读取时先查本地 LRU 再查 redis
+// 通过 NearCache 执行的 Set/Del 会在 redis 频道上广播，所有实例收到后删除本地条目
+type NearCache struct {
+	redis           *redis.Redis
+	nearCacheConfig *NearCacheConfig
+	local           *lru
+	instanceId      string
+
+	// 订阅失效通知返回的错误
+	mu     sync.Mutex
+	subErr error
+
+	localHits   uint64
+	localMisses uint64
+	redisHits   uint64
+	redisMisses uint64
+}
+
+// 命中统计
+type NearCacheStats struct {
+	LocalHits   uint64 `json:"localHits"`
+	LocalMisses uint64 `json:"localMisses"`
+	RedisHits   uint64 `json:"redisHits"`
+	RedisMisses uint64 `json:"redisMisses"`
+}
+
+// 失效通知
+type invalidation struct {
+	InstanceId string `json:"instanceId"`
+	Key        string `json:"key"`
+}
+
+// 创建二级缓存并订阅失效通知，ctx 结束后停止订阅
+// 断线期间的失效通知会丢失，每次（重新）订阅成功后清空本地缓存
+func NewNearCache(ctx context.Context, r *redis.Redis, nearCacheConfig *NearCacheConfig) (*NearCache, error) {
+	if r == nil {
+		return nil, fmt.Errorf("redis 不能为空")
+	}
+	if nearCacheConfig == nil {
+		nearCacheConfig = &NearCacheConfig{}
+	}
+	nearCacheConfig.defaultValue()
+	if nearCacheConfig.Capacity < 0 {
+		return nil, fmt.Errorf("capacity 不能小于 0")
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	n := &NearCache{
+		redis:           r,
+		nearCacheConfig: nearCacheConfig,
+		local:           newLRU(nearCacheConfig.Capacity),
+		instanceId:      hex.EncodeToString(b),
+	}
+	go func() {
+		if err := r.SubscribeWithNotify(ctx, n.onInvalidate, n.local.flush, nearCacheConfig.Channel); err != nil {
+			n.mu.Lock()
+			n.subErr = err
+			n.mu.Unlock()
+		}
+	}()
+	return n, nil
+}
+
+// 订阅失效通知的错误，不为 nil 时订阅已停止，本地缓存不会再收到其他实例的失效通知
+// 断线重连不算错误，ctx 结束后订阅正常停止时返回 nil
+func (n *NearCache) Err() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.subErr
+}
+
+// 获取 key 对应的值，key 不存在时返回空字符串
+func (n *NearCache) Get(key string) (string, error) {
+	if utils.IsEmpty(key) {
+		return "", fmt.Errorf("key 不能为空")
+	}
+	if value, ok := n.local.get(key); ok {
+		atomic.AddUint64(&n.localHits, 1)
+		return value, nil
+	}
+	atomic.AddUint64(&n.localMisses, 1)
+	// 加载期间收到失效通知时，读到的值可能已经过期，不写入本地缓存
+	gen := n.local.startLoad(key)
+	value, ttl, err := n.load(key)
+	n.local.finishLoad(key, gen, value, ttl, err == nil && ttl > 0)
+	if err == redis.ErrNotFound {
+		atomic.AddUint64(&n.redisMisses, 1)
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	atomic.AddUint64(&n.redisHits, 1)
+	return value, nil
+}
+
+// 设置值，ttl 为 redis 中的过期时间，并通知其他实例删除本地条目
+func (n *NearCache) Set(key string, value string, ttl time.Duration) error {
+	if utils.IsEmpty(key) {
+		return fmt.Errorf("key 不能为空")
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("ttl 必须大于 0")
+	}
+	if err := setPX(n.redis, key, value, ttl); err != nil {
+		return err
+	}
+	localTTL := n.localTTL()
+	if ttl < localTTL {
+		localTTL = ttl
+	}
+	n.local.set(key, value, localTTL)
+	return n.publish(key)
+}
+
+// 删除值，并通知其他实例删除本地条目
+func (n *NearCache) Del(key string) error {
+	if err := n.redis.Del(key); err != nil {
+		return err
+	}
+	n.local.remove(key)
+	return n.publish(key)
+}
+
+// 获取命中统计
+func (n *NearCache) Stats() NearCacheStats {
+	return NearCacheStats{
+		LocalHits:   atomic.LoadUint64(&n.localHits),
+		LocalMisses: atomic.LoadUint64(&n.localMisses),
+		RedisHits:   atomic.LoadUint64(&n.redisHits),
+		RedisMisses: atomic.LoadUint64(&n.redisMisses),
+	}
+}
+
+func (n *NearCache) publish(key string) error {
+	b, err := json.Marshal(&invalidation{InstanceId: n.instanceId, Key: key})
+	if err != nil {
+		return err
+	}
+	_, err = n.redis.Publish(n.nearCacheConfig.Channel, string(b))
+	return err
+}
+
+// 收到其他实例的失效通知时删除本地条目
+func (n *NearCache) onInvalidate(msg *redis.Message) {
+	var inv invalidation
+	if err := json.Unmarshal(msg.Data, &inv); err != nil {
+		return
+	}
+	if inv.InstanceId == n.instanceId {
+		return
+	}
+	n.local.remove(inv.Key)
+}
+
+// 在同一次往返中读取值和剩余过期时间，本地过期时间取 LocalTTL 与 redis 剩余过期时间中较小的一个
+// 避免本地缓存的值比 redis 中的值存活更久
+func (n *NearCache) load(key string) (string, time.Duration, error) {
+	p := n.redis.Pipeline()
+	get := p.Get(key)
+	pttl := p.Send("pttl", key)
+	if _, err := p.Exec(); err != nil {
+		return "", 0, err
+	}
+	if get.Value == nil && get.Err == nil {
+		return "", 0, redis.ErrNotFound
+	}
+	value, err := get.String()
+	if err != nil {
+		return "", 0, err
+	}
+	ms, err := pttl.Int64()
+	if err != nil {
+		return "", 0, err
+	}
+	ttl := n.localTTL()
+	// -1 表示没有过期时间，-2 表示读取 GET 之后 key 已过期，此时不写入本地缓存
+	if remaining := time.Duration(ms) * time.Millisecond; ms != -1 && remaining < ttl {
+		ttl = remaining
+	}
+	return value, ttl, nil
+}
+
+func (n *NearCache) localTTL() time.Duration {
+	return time.Duration(n.nearCacheConfig.LocalTTL) * time.Second
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 二级缓存：本地 LRU + redis
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/liuchonglin/go-tools/redis"
+	"github.com/liuchonglin/go-tools/redis/redistest"
+)
+
+func TestNewNearCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *NearCacheConfig
+		wantErr bool
+		noRedis bool
+	}{
+		{
+			name: "all",
+		}, {
+			name:    "redis nil",
+			noRedis: true,
+			wantErr: true,
+		}, {
+			name:    "capacity negative",
+			config:  &NearCacheConfig{Capacity: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r := redisTool
+			if tt.noRedis {
+				r = nil
+			}
+			n, err := NewNearCache(ctx, r, tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewNearCache() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && n.Err() != nil {
+				t.Errorf("Err() = %v, want nil", n.Err())
+			}
+		})
+	}
+}
+
+func TestNearCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n, _ := NewNearCache(ctx, redisTool, nil)
+	// 等待订阅完成，订阅成功时会清空本地缓存
+	time.Sleep(200 * time.Millisecond)
+	n.Del("nearcache:1")
+
+	if got, err := n.Get("nearcache:1"); err != nil || got != "" {
+		t.Fatalf("Get() = %v, %v, want empty", got, err)
+	}
+	if err := n.Set("nearcache:1", "a", time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got, err := n.Get("nearcache:1"); err != nil || got != "a" {
+		t.Errorf("Get() = %v, %v, want a", got, err)
+	}
+	want := NearCacheStats{LocalHits: 1, LocalMisses: 1, RedisMisses: 1}
+	if got := n.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if _, err := n.Get(""); err == nil {
+		t.Errorf("Get() key nil error = nil, wantErr true")
+	}
+	if err := n.Set("nearcache:1", "a", 0); err == nil {
+		t.Errorf("Set() ttl zero error = nil, wantErr true")
+	}
+}
+
+// 一个实例修改后，其他实例的本地条目失效
+func TestNearCacheRedisTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n, _ := NewNearCache(ctx, redisTool, &NearCacheConfig{LocalTTL: 60})
+	time.Sleep(200 * time.Millisecond)
+
+	tests := []struct {
+		name    string
+		expire  time.Duration
+		wantTTL time.Duration
+	}{
+		{name: "redis shorter", expire: 5 * time.Second, wantTTL: 5 * time.Second},
+		{name: "local shorter", expire: time.Hour, wantTTL: time.Minute},
+		{name: "no expire", wantTTL: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := "nearcache:ttl"
+			if _, err := redisTool.SetWithOptions(key, "a", &redis.SetOptions{Expire: tt.expire}); err != nil {
+				t.Fatal(err)
+			}
+			n.local.remove(key)
+			if got, err := n.Get(key); err != nil || got != "a" {
+				t.Fatalf("Get() = %v, %v, want a", got, err)
+			}
+			n.local.mu.Lock()
+			e, ok := n.local.items[key]
+			n.local.mu.Unlock()
+			if !ok {
+				t.Fatalf("Get() did not cache %v locally", key)
+			}
+			ttl := time.Until(e.Value.(*lruEntry).expireAt)
+			if ttl > tt.wantTTL || ttl < tt.wantTTL-time.Second {
+				t.Errorf("local ttl = %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestNearCacheInvalidate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, _ := NewNearCache(ctx, redisTool, nil)
+	b, _ := NewNearCache(ctx, redisTool, nil)
+	// 等待订阅完成
+	time.Sleep(200 * time.Millisecond)
+
+	if err := a.Set("nearcache:2", "v1", time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got, _ := b.Get("nearcache:2"); got != "v1" {
+		t.Fatalf("Get() = %v, want v1", got)
+	}
+	if err := a.Set("nearcache:2", "v2", time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if got, _ := b.Get("nearcache:2"); got != "v2" {
+		t.Errorf("Get() after invalidate = %v, want v2", got)
+	}
+	a.Del("nearcache:2")
+}
+
+// 加载期间收到失效通知时，加载的旧值不写入本地缓存
+func TestNearCacheStaleLoad(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n, _ := NewNearCache(ctx, redisTool, nil)
+	time.Sleep(200 * time.Millisecond)
+
+	gen := n.local.startLoad("nearcache:3")
+	n.onInvalidate(&redis.Message{Data: []byte(`{"instanceId":"other","key":"nearcache:3"}`)})
+	if n.local.finishLoad("nearcache:3", gen, "stale", time.Minute, true) {
+		t.Errorf("finishLoad() = true, want stale value dropped")
+	}
+	if _, ok := n.local.get("nearcache:3"); ok {
+		t.Errorf("get() ok = true, want not cached")
+	}
+}
+
+// 订阅断开期间的修改收不到通知，重新订阅后清空本地缓存
+func TestNearCacheReconnect(t *testing.T) {
+	server, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer server.Close()
+	r, err := redis.NewRedis(&redis.RedisConfig{Address: server.Addr(), MaxIdle: 2})
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	defer r.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n, _ := NewNearCache(ctx, r, nil)
+	time.Sleep(200 * time.Millisecond)
+
+	if err := n.Set("nearcache:4", "v1", time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	server.CloseClients()
+	// 断线期间的修改不会广播
+	server.Set("nearcache:4", "v2")
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		got, err := n.Get("nearcache:4")
+		if err == nil && got == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Get() = %v, %v, want v2 after resubscribe", got, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
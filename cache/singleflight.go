@@ -0,0 +1,81 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 合并相同 key 的并发调用
+package cache
+
+import (
+	"fmt"
+	"sync"
+)
+
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// 同一时刻相同 key 只有一个调用在执行，其他调用等待并共享结果
+type singleflight struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// shared 表示结果来自其他调用
+// fn panic 时 panic 被转换为错误返回给所有调用方
+func (g *singleflight) do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+	c := &call{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.val, c.err = safeCall(fn)
+	return c.val, c.err, false
+}
+
+func safeCall(fn func() (interface{}, error)) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("got panic in singleflight: %+v", r)
+		}
+	}()
+	return fn()
+}
+
+// 相同 key 已有调用在执行时直接返回 false，不等待
+func (g *singleflight) tryDo(key string, fn func() (interface{}, error)) bool {
+	g.mu.Lock()
+	if _, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		return false
+	}
+	g.mu.Unlock()
+	go g.do(key, fn)
+	return true
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 合并相同 key 的并发调用
+package cache
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleflight(t *testing.T) {
+	var g singleflight
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, _ := g.do("key", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(100 * time.Millisecond)
+				return "value", nil
+			})
+			if err != nil || v != "value" {
+				t.Errorf("do() = %v, %v, want value, nil", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("do() calls = %v, want 1", calls)
+	}
+}
+
+func TestSingleflightPanic(t *testing.T) {
+	var g singleflight
+	started := make(chan struct{})
+	release := make(chan struct{})
+	leader := make(chan error, 1)
+	go func() {
+		_, err, _ := g.do("key", func() (interface{}, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+		leader <- err
+	}()
+	<-started
+	waiter := make(chan error, 1)
+	go func() {
+		v, err, shared := g.do("key", func() (interface{}, error) { return "value", nil })
+		if v != nil || !shared {
+			t.Errorf("do() = %v, shared %v, want nil, shared true", v, shared)
+		}
+		waiter <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for _, ch := range []chan error{leader, waiter} {
+		if err := <-ch; err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Errorf("do() error = %v, want panic error", err)
+		}
+	}
+}
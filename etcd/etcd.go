@@ -28,16 +28,37 @@ import (
 
 type etcd struct {
 	EtcdClient *clientv3.Client
+	// 创建时的配置，超时时间和租约时间从这里读取
+	etcdConfig *EtcdConfig
 }
 
 var (
 	etcdClientIsNilError = errors.New("etcd client is nil")
 	keyEmptyError        = errors.New("etcd key is empty")
 	valueNotJson         = errors.New("'value' is not a json")
+	// key 不存在
+	ErrNotFound = errors.New("etcd key not found")
 )
 
+// 请求 etcd 失败（网络异常、超时或服务端错误），与 ErrNotFound 区分
+type TransportError struct {
+	// 操作名称，如 get、put
+	Op string
+	// 操作的 key
+	Key string
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("etcd %s %s: %v", e.Op, e.Key, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
 func NewEtcd(etcdConfig *EtcdConfig) (e *etcd, err error) {
-	if etcdConfig != nil {
+	if etcdConfig == nil {
 		etcdConfig = &EtcdConfig{}
 	}
 	etcdConfig.defaultValue()
@@ -49,16 +70,29 @@ func NewEtcd(etcdConfig *EtcdConfig) (e *etcd, err error) {
 	if err != nil {
 		return nil, fmt.Errorf("etcd 初始化失败: %v", err)
 	}
+	e = &etcd{EtcdClient: etcdClient, etcdConfig: etcdConfig}
 	//etcd超时控制, 设置ContextTimeout超时
-	ctx, cancel := context.WithTimeout(context.Background(),
-		time.Duration(GetEtcdConfig().ContextTimeout)*time.Second)
+	ctx, cancel := e.timeoutContext()
 	_, err = etcdClient.Get(ctx, "init_get_test_key")
+	//操作完毕，取消超时控制
+	cancel()
 	if err != nil {
 		return nil, fmt.Errorf("etcd 初始化失败: %v", err)
 	}
-	//操作完毕，取消超时控制
-	cancel()
-	return &etcd{EtcdClient: etcdClient}, nil
+	return e, nil
+}
+
+// 创建时的配置，未通过 NewEtcd 创建时使用默认配置
+func (e *etcd) config() *EtcdConfig {
+	if e.etcdConfig == nil {
+		return GetEtcdConfig()
+	}
+	return e.etcdConfig
+}
+
+// 带 ContextTimeout 超时的 context，操作完毕后需要调用 cancel
+func (e *etcd) timeoutContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), time.Duration(e.config().ContextTimeout)*time.Second)
 }
 
 func (e *etcd) Get(key string, config interface{}) error {
@@ -72,25 +106,28 @@ func (e *etcd) Get(key string, config interface{}) error {
 	if err := utils.CheckPointer(config); err != nil {
 		return err
 	}
-	value, err := get(e.EtcdClient, key)
+	value, _, err := e.get(key)
 	if err != nil {
-		return nil
+		return err
 	}
 	return json.Unmarshal(value, config)
 }
 
-// 通过key 从etcd中获取value
-func get(etcdClient *clientv3.Client, key string) (value []byte, err error) {
+// 通过key 从etcd中获取value，key 不存在时返回 ErrNotFound
+// rev 为读取时的 revision，监听时从 rev+1 开始不会漏掉之后的变化
+func (e *etcd) get(key string) (value []byte, rev int64, err error) {
 	//etcd超时控制, 设置ContextTimeout超时
-	ctx, cancel := context.WithTimeout(context.Background(),
-		time.Duration(GetEtcdConfig().ContextTimeout)*time.Second)
-	resp, err := etcdClient.Get(ctx, key)
+	ctx, cancel := e.timeoutContext()
+	resp, err := e.EtcdClient.Get(ctx, key)
 	//操作完毕，取消超时控制
 	cancel()
-	if err != nil || len(resp.Kvs) == 0 {
-		return nil, err
+	if err != nil {
+		return nil, 0, &TransportError{Op: "get", Key: key, Err: err}
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, ErrNotFound
 	}
-	return resp.Kvs[0].Value, nil
+	return resp.Kvs[0].Value, resp.Header.Revision, nil
 }
 
 func (e *etcd) Watch(key string, f func(event *clientv3.Event)) error {
@@ -132,16 +169,15 @@ func (e *etcd) Put(key string, value string) error {
 	if flag, err := validateJson(value); err != nil || !flag {
 		return valueNotJson
 	}
-	return put(e.EtcdClient, key, value)
+	return e.put(key, value)
 }
 
-func put(etcdClient *clientv3.Client, key string, value string) error {
-	ctx, cancel := context.WithTimeout(context.Background(),
-		time.Duration(GetEtcdConfig().ContextTimeout)*time.Second)
-	_, err := etcdClient.Put(ctx, key, value)
+func (e *etcd) put(key string, value string) error {
+	ctx, cancel := e.timeoutContext()
+	_, err := e.EtcdClient.Put(ctx, key, value)
 	cancel()
 	if err != nil {
-		return err
+		return &TransportError{Op: "put", Key: key, Err: err}
 	}
 	return nil
 }
@@ -153,16 +189,15 @@ func (e *etcd) Delete(key string) error {
 	if key = formatKey(key); utils.IsEmpty(key) {
 		return keyEmptyError
 	}
-	return delete(e.EtcdClient, key)
+	return e.delete(key)
 }
 
-func delete(etcdClient *clientv3.Client, key string) error {
-	ctx, cancel := context.WithTimeout(context.Background(),
-		time.Duration(GetEtcdConfig().ContextTimeout)*time.Second)
-	_, err := etcdClient.Delete(ctx, key)
+func (e *etcd) delete(key string) error {
+	ctx, cancel := e.timeoutContext()
+	_, err := e.EtcdClient.Delete(ctx, key)
 	cancel()
 	if err != nil {
-		return err
+		return &TransportError{Op: "delete", Key: key, Err: err}
 	}
 	return nil
 }
@@ -0,0 +1,203 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// etcd配置绑定
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/liuchonglin/go-utils"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+)
+
+// watch 中断后重新监听的等待时间
+const bindRetryInterval = time.Second
+
+// 配置校验，Bind 的配置类型实现该接口时，校验通过的配置才会生效
+type Validator interface {
+	Validate() error
+}
+
+// 绑定到 etcd key 的配置，key 的值变化后自动重新解析
+// 通过 Load 获取当前配置，每次变化都会生成新的配置对象，已获取的配置不会被修改
+type Binding struct {
+	etcd *etcd
+	key  string
+	typ  reflect.Type
+
+	value  atomic.Value
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu          sync.Mutex
+	subscribers []func(old, new interface{})
+	err         error
+}
+
+// 绑定配置：读取 key 的 json 解析到 config 中，之后监听 key 的变化
+// config 必须是指针，首次加载失败时返回错误（key 不存在时为 ErrNotFound，请求失败时为 *TransportError）；
+// 之后解析或校验失败时保留上一次有效的配置
+// onChange 在配置变化后调用，old、new 与 config 的类型相同，可以为 nil
+func (e *etcd) Bind(key string, config interface{}, onChange func(old, new interface{})) (*Binding, error) {
+	if e.EtcdClient == nil {
+		return nil, etcdClientIsNilError
+	}
+	if key = formatKey(key); utils.IsEmpty(key) {
+		return nil, keyEmptyError
+	}
+	if err := utils.CheckPointer(config); err != nil {
+		return nil, err
+	}
+	b := &Binding{etcd: e, key: key, typ: reflect.TypeOf(config), done: make(chan struct{})}
+	if onChange != nil {
+		b.subscribers = append(b.subscribers, onChange)
+	}
+
+	value, rev, err := e.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeConfig(value, config); err != nil {
+		return nil, fmt.Errorf("etcd 配置解析失败: %s, %v", key, err)
+	}
+	b.value.Store(config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	go b.watch(ctx, rev+1)
+	return b, nil
+}
+
+// 当前配置，类型与 Bind 时传入的 config 相同
+func (b *Binding) Load() interface{} {
+	return b.value.Load()
+}
+
+// 增加配置变化的订阅者
+func (b *Binding) Subscribe(f func(old, new interface{})) {
+	if f == nil {
+		return
+	}
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, f)
+	b.mu.Unlock()
+}
+
+// 最近一次更新配置的错误，更新成功后为 nil
+func (b *Binding) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// 停止监听，等待正在执行的通知完成后返回
+func (b *Binding) Close() {
+	b.cancel()
+	<-b.done
+}
+
+// 监听 key 的变化，watch 中断（如 revision 已被压缩）后重新读取并继续监听
+func (b *Binding) watch(ctx context.Context, rev int64) {
+	defer close(b.done)
+	for {
+		watchChan := b.etcd.EtcdClient.Watch(clientv3.WithRequireLeader(ctx), b.key, clientv3.WithRev(rev))
+		for resp := range watchChan {
+			if resp.Canceled || resp.Err() != nil {
+				break
+			}
+			for _, ev := range resp.Events {
+				rev = ev.Kv.ModRevision + 1
+				if ev.Type == mvccpb.DELETE {
+					b.setErr(fmt.Errorf("etcd 配置已删除: %s", b.key))
+					continue
+				}
+				b.update(ev.Kv.Value)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bindRetryInterval):
+		}
+		rev = b.reload(rev)
+	}
+}
+
+// 重新读取配置，返回继续监听的 revision
+func (b *Binding) reload(rev int64) int64 {
+	ctx, cancel := b.etcd.timeoutContext()
+	resp, err := b.etcd.EtcdClient.Get(ctx, b.key)
+	cancel()
+	if err != nil {
+		b.setErr(err)
+		return rev
+	}
+	if len(resp.Kvs) > 0 && resp.Kvs[0].ModRevision >= rev {
+		b.update(resp.Kvs[0].Value)
+	}
+	return resp.Header.Revision + 1
+}
+
+// 解析、校验新配置，成功后替换并通知订阅者
+func (b *Binding) update(data []byte) {
+	config := reflect.New(b.typ.Elem()).Interface()
+	if err := decodeConfig(data, config); err != nil {
+		b.setErr(fmt.Errorf("etcd 配置解析失败: %s, %v", b.key, err))
+		return
+	}
+	old := b.value.Load()
+	b.value.Store(config)
+	b.mu.Lock()
+	b.err = nil
+	subscribers := make([]func(old, new interface{}), len(b.subscribers))
+	copy(subscribers, b.subscribers)
+	b.mu.Unlock()
+	for _, f := range subscribers {
+		notify(f, old, config)
+	}
+}
+
+func (b *Binding) setErr(err error) {
+	b.mu.Lock()
+	b.err = err
+	b.mu.Unlock()
+}
+
+func notify(f func(old, new interface{}), old, new interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("got panic in config subscriber: %+v", r)
+		}
+	}()
+	f(old, new)
+}
+
+// 解析 json 并校验
+func decodeConfig(data []byte, config interface{}) error {
+	if err := json.Unmarshal(data, config); err != nil {
+		return err
+	}
+	if v, ok := config.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// etcd配置绑定
+package etcd
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const testBindKey = "/liuchonglin/test/before/bind"
+
+type bindConfig struct {
+	Address string `json:"address"`
+	Weight  int    `json:"weight"`
+}
+
+func (c *bindConfig) Validate() error {
+	if c.Weight < 0 {
+		return errors.New("weight 不能小于 0")
+	}
+	return nil
+}
+
+func TestBind(t *testing.T) {
+	etcdClient.Put(testBindKey, `{"address":"a","weight":1}`)
+	defer etcdClient.Delete(testBindKey)
+	etcdClient.Put(testBindKey+"/invalid", `{"address":"a","weight":-1}`)
+	defer etcdClient.Delete(testBindKey + "/invalid")
+	tests := []struct {
+		name    string
+		key     string
+		config  interface{}
+		want    string
+		wantErr bool
+		// 期望的错误类型
+		errIs error
+	}{
+		{
+			name:   "all",
+			key:    testBindKey,
+			config: &bindConfig{},
+			want:   "a",
+		}, {
+			name:    "key not exist",
+			key:     testBindKey + "/none",
+			config:  &bindConfig{},
+			wantErr: true,
+			errIs:   ErrNotFound,
+		}, {
+			name:    "not pointer",
+			key:     testBindKey,
+			config:  bindConfig{},
+			wantErr: true,
+		}, {
+			name:    "key empty",
+			key:     "",
+			config:  &bindConfig{},
+			wantErr: true,
+		}, {
+			name:    "validate",
+			key:     testBindKey + "/invalid",
+			config:  &bindConfig{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := etcdClient.Bind(tt.key, tt.config, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Bind() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+				t.Errorf("Bind() error = %v, want %v", err, tt.errIs)
+			}
+			if err != nil {
+				return
+			}
+			defer b.Close()
+			if got := b.Load().(*bindConfig).Address; got != tt.want {
+				t.Errorf("Load() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindUpdate(t *testing.T) {
+	etcdClient.Put(testBindKey, `{"address":"a","weight":1}`)
+	defer etcdClient.Delete(testBindKey)
+	changes := make(chan [2]*bindConfig, 10)
+	b, err := etcdClient.Bind(testBindKey, &bindConfig{}, func(old, new interface{}) {
+		changes <- [2]*bindConfig{old.(*bindConfig), new.(*bindConfig)}
+	})
+	if err != nil {
+		t.Fatalf("Bind() error = %v", err)
+	}
+	defer b.Close()
+	subscribed := make(chan struct{}, 10)
+	b.Subscribe(func(old, new interface{}) { subscribed <- struct{}{} })
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		changed bool
+		wantErr bool
+	}{
+		{name: "update", value: `{"address":"b","weight":2}`, want: "b", changed: true},
+		{name: "invalid json", value: `{"address":`, want: "b", wantErr: true},
+		{name: "validate", value: `{"address":"c","weight":-1}`, want: "b", wantErr: true},
+		{name: "recover", value: `{"address":"d","weight":1}`, want: "d", changed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := b.Load().(*bindConfig)
+			// 直接写入，Put 会拒绝非法的 json
+			ctx, cancel := etcdClient.timeoutContext()
+			_, err := etcdClient.EtcdClient.Put(ctx, testBindKey, tt.value)
+			cancel()
+			if err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			if tt.changed {
+				select {
+				case c := <-changes:
+					if c[0] != before || c[1].Address != tt.want {
+						t.Errorf("onChange() = %+v, %+v, want %+v, %v", c[0], c[1], before, tt.want)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("onChange() not called")
+				}
+				select {
+				case <-subscribed:
+				case <-time.After(time.Second):
+					t.Errorf("subscriber not called")
+				}
+			} else {
+				time.Sleep(100 * time.Millisecond)
+			}
+			if got := b.Load().(*bindConfig).Address; got != tt.want {
+				t.Errorf("Load() = %v, want %v", got, tt.want)
+			}
+			if (b.Err() != nil) != tt.wantErr {
+				t.Errorf("Err() = %v, wantErr %v", b.Err(), tt.wantErr)
+			}
+		})
+	}
+}
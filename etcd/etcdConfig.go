@@ -29,6 +29,9 @@ type EtcdConfig struct {
 	Timeout int64 `json:"timeout" yaml:"timeout"`
 	// 设置ContextTimeout超时
 	ContextTimeout int64 `json:"contextTimeout" yaml:"contextTimeout"`
+	// 服务注册的租约时间，实例异常退出后最多经过该时间被移除，单位：秒
+	// 默认值：10
+	LeaseTTL int64 `json:"leaseTTL" yaml:"leaseTTL"`
 }
 
 func GetEtcdConfig() *EtcdConfig {
@@ -49,4 +52,7 @@ func (e *EtcdConfig) defaultValue() {
 	if e.ContextTimeout == 0 {
 		e.ContextTimeout = 10
 	}
+	if e.LeaseTTL == 0 {
+		e.LeaseTTL = 10
+	}
 }
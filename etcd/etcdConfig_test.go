@@ -17,6 +17,7 @@ package etcd
 
 import (
 	"testing"
+	"time"
 )
 
 func TestGetEtcdConfig(t *testing.T) {
@@ -33,3 +34,38 @@ func TestGetEtcdConfig(t *testing.T) {
 		})
 	}
 }
+
+// 超时时间和租约时间从创建时的配置读取
+func TestEtcdConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		etcd        *etcd
+		wantTimeout time.Duration
+		wantTTL     int64
+	}{
+		{
+			name:        "config",
+			etcd:        &etcd{etcdConfig: &EtcdConfig{ContextTimeout: 3, LeaseTTL: 7}},
+			wantTimeout: 3 * time.Second,
+			wantTTL:     7,
+		}, {
+			name:        "default",
+			etcd:        &etcd{},
+			wantTimeout: time.Duration(GetEtcdConfig().ContextTimeout) * time.Second,
+			wantTTL:     GetEtcdConfig().LeaseTTL,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.etcd.config().LeaseTTL; got != tt.wantTTL {
+				t.Errorf("LeaseTTL = %v, want %v", got, tt.wantTTL)
+			}
+			ctx, cancel := tt.etcd.timeoutContext()
+			defer cancel()
+			deadline, _ := ctx.Deadline()
+			if got := time.Until(deadline); got > tt.wantTimeout || got < tt.wantTimeout-time.Second {
+				t.Errorf("timeout = %v, want %v", got, tt.wantTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// etcd服务发现
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+	"google.golang.org/grpc/resolver"
+)
+
+// grpc resolver 的 scheme，grpc 客户端通过 etcd:///<服务名> 连接
+const ResolverScheme = "etcd"
+
+// 没有可用的服务实例
+var ErrNoInstance = errors.New("etcd service has no instance")
+
+// 服务发现，本地缓存服务的实例列表，通过前缀监听保持更新
+type Discovery struct {
+	etcd        *etcd
+	serviceName string
+	prefix      string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu          sync.RWMutex
+	instances   map[string]*ServiceInstance
+	snapshot    []*ServiceInstance
+	subscribers []func(instances []*ServiceInstance)
+}
+
+// 发现服务：读取 /services/<serviceName>/ 下的所有实例，之后监听实例的变化
+// 格式错误的实例会被忽略
+func (e *etcd) Discover(serviceName string) (*Discovery, error) {
+	return e.discover(serviceName, nil)
+}
+
+// subscriber 不为空时在开始监听前加入订阅者，第一次通知即初始的实例列表，
+// 之后的通知都由监听协程按顺序发出，不会被较早的列表覆盖
+func (e *etcd) discover(serviceName string, subscriber func(instances []*ServiceInstance)) (*Discovery, error) {
+	if e.EtcdClient == nil {
+		return nil, etcdClientIsNilError
+	}
+	if err := validateServiceName(serviceName); err != nil {
+		return nil, err
+	}
+	d := &Discovery{etcd: e, serviceName: serviceName, prefix: serviceKey(serviceName), done: make(chan struct{})}
+	if subscriber != nil {
+		d.subscribers = append(d.subscribers, subscriber)
+	}
+	rev, err := d.reload()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	go d.watch(ctx, rev)
+	return d, nil
+}
+
+// 服务名
+func (d *Discovery) ServiceName() string {
+	return d.serviceName
+}
+
+// 当前的实例列表，按实例 id 排序，返回的实例不能修改
+func (d *Discovery) Instances() []*ServiceInstance {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.snapshot
+}
+
+// 使用 picker 选择一个实例，没有实例时返回 ErrNoInstance
+func (d *Discovery) Pick(picker Picker) (*ServiceInstance, error) {
+	return picker.Pick(d.Instances())
+}
+
+// 增加实例列表变化的订阅者，不会收到当前的实例列表，需要时通过 Instances 获取
+func (d *Discovery) Subscribe(f func(instances []*ServiceInstance)) {
+	if f == nil {
+		return
+	}
+	d.mu.Lock()
+	d.subscribers = append(d.subscribers, f)
+	d.mu.Unlock()
+}
+
+// 停止监听，等待正在执行的通知完成后返回
+func (d *Discovery) Close() {
+	d.cancel()
+	<-d.done
+}
+
+// 监听实例的变化，watch 中断后重新读取全部实例并继续监听
+func (d *Discovery) watch(ctx context.Context, rev int64) {
+	defer close(d.done)
+	for {
+		watchChan := d.etcd.EtcdClient.Watch(clientv3.WithRequireLeader(ctx), d.prefix,
+			clientv3.WithPrefix(), clientv3.WithRev(rev))
+		for resp := range watchChan {
+			if resp.Canceled || resp.Err() != nil {
+				break
+			}
+			d.mu.Lock()
+			for _, ev := range resp.Events {
+				rev = ev.Kv.ModRevision + 1
+				var instance *ServiceInstance
+				if ev.Type == mvccpb.PUT {
+					instance = decodeInstance(ev.Kv.Value)
+				}
+				if instance != nil {
+					d.instances[string(ev.Kv.Key)] = instance
+				} else {
+					delete(d.instances, string(ev.Kv.Key))
+				}
+			}
+			d.mu.Unlock()
+			d.update()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bindRetryInterval):
+		}
+		if r, err := d.reload(); err == nil {
+			rev = r
+		}
+	}
+}
+
+// 读取全部实例替换本地缓存，返回继续监听的 revision
+func (d *Discovery) reload() (int64, error) {
+	ctx, cancel := d.etcd.timeoutContext()
+	resp, err := d.etcd.EtcdClient.Get(ctx, d.prefix, clientv3.WithPrefix())
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+	instances := make(map[string]*ServiceInstance, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if instance := decodeInstance(kv.Value); instance != nil {
+			instances[string(kv.Key)] = instance
+		}
+	}
+	d.mu.Lock()
+	d.instances = instances
+	d.mu.Unlock()
+	d.update()
+	return resp.Header.Revision + 1, nil
+}
+
+// 重新生成实例列表并通知订阅者
+func (d *Discovery) update() {
+	d.mu.Lock()
+	snapshot := make([]*ServiceInstance, 0, len(d.instances))
+	for _, instance := range d.instances {
+		snapshot = append(snapshot, instance)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Id < snapshot[j].Id })
+	d.snapshot = snapshot
+	subscribers := make([]func(instances []*ServiceInstance), len(d.subscribers))
+	copy(subscribers, d.subscribers)
+	d.mu.Unlock()
+	for _, f := range subscribers {
+		notifyInstances(f, snapshot)
+	}
+}
+
+func notifyInstances(f func(instances []*ServiceInstance), instances []*ServiceInstance) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("got panic in discovery subscriber: %+v", r)
+		}
+	}()
+	f(instances)
+}
+
+func decodeInstance(data []byte) *ServiceInstance {
+	instance := &ServiceInstance{}
+	if err := json.Unmarshal(data, instance); err != nil || instance.Address == "" {
+		return nil
+	}
+	instance.defaultValue()
+	return instance
+}
+
+// 实例选择器
+type Picker interface {
+	// 从实例列表中选择一个，列表为空时返回 ErrNoInstance
+	Pick(instances []*ServiceInstance) (*ServiceInstance, error)
+}
+
+// 轮询选择器
+type roundRobinPicker struct {
+	next uint64
+}
+
+// 创建轮询选择器，依次选择每个实例
+func NewRoundRobinPicker() Picker {
+	return &roundRobinPicker{}
+}
+
+func (p *roundRobinPicker) Pick(instances []*ServiceInstance) (*ServiceInstance, error) {
+	if len(instances) == 0 {
+		return nil, ErrNoInstance
+	}
+	n := atomic.AddUint64(&p.next, 1) - 1
+	return instances[n%uint64(len(instances))], nil
+}
+
+// 平滑加权轮询选择器
+type weightedPicker struct {
+	mu      sync.Mutex
+	current map[string]int
+}
+
+// 创建加权选择器，按 Weight 的比例平滑地选择实例，Weight 小于 1 时视为 1
+func NewWeightedPicker() Picker {
+	return &weightedPicker{current: make(map[string]int)}
+}
+
+func (p *weightedPicker) Pick(instances []*ServiceInstance) (*ServiceInstance, error) {
+	if len(instances) == 0 {
+		return nil, ErrNoInstance
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current := make(map[string]int, len(instances))
+	var best *ServiceInstance
+	total := 0
+	for _, instance := range instances {
+		weight := instance.Weight
+		if weight < 1 {
+			weight = 1
+		}
+		total += weight
+		current[instance.Id] = p.current[instance.Id] + weight
+		if best == nil || current[instance.Id] > current[best.Id] {
+			best = instance
+		}
+	}
+	current[best.Id] -= total
+	// 只保留当前实例的状态，已下线的实例不再占用内存
+	p.current = current
+	return best, nil
+}
+
+// 同可用区优先的选择器
+type zonePicker struct {
+	zone   string
+	picker Picker
+}
+
+// 创建可用区选择器，优先在 zone 内的实例中选择，zone 内没有实例时在全部实例中选择
+// picker 为实际的选择策略，为 nil 时使用轮询
+func NewZonePicker(zone string, picker Picker) Picker {
+	if picker == nil {
+		picker = NewRoundRobinPicker()
+	}
+	return &zonePicker{zone: zone, picker: picker}
+}
+
+func (p *zonePicker) Pick(instances []*ServiceInstance) (*ServiceInstance, error) {
+	var local []*ServiceInstance
+	for _, instance := range instances {
+		if instance.Zone == p.zone {
+			local = append(local, instance)
+		}
+	}
+	if len(local) > 0 {
+		return p.picker.Pick(local)
+	}
+	return p.picker.Pick(instances)
+}
+
+// grpc resolver，通过服务发现解析 etcd:///<服务名>
+type resolverBuilder struct {
+	etcd *etcd
+}
+
+// grpc 的 resolver.Builder，实例的地址作为 grpc 的连接地址，Address.Metadata 为 *ServiceInstance
+func (e *etcd) ResolverBuilder() resolver.Builder {
+	return &resolverBuilder{etcd: e}
+}
+
+// 注册 grpc resolver，之后 grpc 客户端可以通过 grpc.Dial("etcd:///<服务名>") 连接服务
+// 需要在 grpc.Dial 之前调用
+func (e *etcd) RegisterResolver() {
+	resolver.Register(e.ResolverBuilder())
+}
+
+func (b *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn,
+	opts resolver.BuildOption) (resolver.Resolver, error) {
+	r := &etcdResolver{cc: cc}
+	// 在监听开始前订阅，初始列表和之后的变化按顺序通知
+	d, err := b.etcd.discover(target.Endpoint, r.update)
+	if err != nil {
+		return nil, err
+	}
+	r.discovery = d
+	return r, nil
+}
+
+func (b *resolverBuilder) Scheme() string {
+	return ResolverScheme
+}
+
+type etcdResolver struct {
+	discovery *Discovery
+	cc        resolver.ClientConn
+}
+
+func (r *etcdResolver) update(instances []*ServiceInstance) {
+	addresses := make([]resolver.Address, 0, len(instances))
+	for _, instance := range instances {
+		addresses = append(addresses, resolver.Address{Addr: instance.Address, Metadata: instance})
+	}
+	r.cc.NewAddress(addresses)
+}
+
+// 实例列表由监听保持更新，不需要重新解析
+func (r *etcdResolver) ResolveNow(resolver.ResolveNowOption) {}
+
+func (r *etcdResolver) Close() {
+	r.discovery.Close()
+}
@@ -0,0 +1,265 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// etcd服务发现
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func TestDiscover(t *testing.T) {
+	r, err := etcdClient.Register(context.Background(), testServiceName, &ServiceInstance{Id: "1", Address: "127.0.0.1:8080"})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	defer r.Deregister()
+	tests := []struct {
+		name        string
+		serviceName string
+		want        []string
+		wantErr     bool
+	}{
+		{name: "all", serviceName: testServiceName, want: []string{"127.0.0.1:8080"}},
+		{name: "no instance", serviceName: testServiceName + "-none", want: []string{}},
+		{name: "serviceName empty", serviceName: "", wantErr: true},
+		{name: "serviceName contains /", serviceName: "a/b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := etcdClient.Discover(tt.serviceName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Discover() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			defer d.Close()
+			if got := instanceAddresses(d.Instances()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Instances() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 实例上线、下线后本地缓存同步更新
+func TestDiscoveryWatch(t *testing.T) {
+	d, err := etcdClient.Discover(testServiceName)
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	defer d.Close()
+	changes := make(chan []*ServiceInstance, 10)
+	d.Subscribe(func(instances []*ServiceInstance) { changes <- instances })
+
+	r1, err := etcdClient.Register(context.Background(), testServiceName, &ServiceInstance{Id: "1", Address: "127.0.0.1:8080"})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	defer r1.Deregister()
+	waitInstances(t, changes, []string{"127.0.0.1:8080"})
+
+	r2, err := etcdClient.Register(context.Background(), testServiceName, &ServiceInstance{Id: "2", Address: "127.0.0.1:8081"})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	waitInstances(t, changes, []string{"127.0.0.1:8080", "127.0.0.1:8081"})
+
+	if err := r2.Deregister(); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+	waitInstances(t, changes, []string{"127.0.0.1:8080"})
+	if got := instanceAddresses(d.Instances()); !reflect.DeepEqual(got, []string{"127.0.0.1:8080"}) {
+		t.Errorf("Instances() = %v", got)
+	}
+}
+
+func TestPicker(t *testing.T) {
+	instances := []*ServiceInstance{
+		{Id: "a", Address: "a", Zone: "z1", Weight: 5},
+		{Id: "b", Address: "b", Zone: "z2", Weight: 1},
+		{Id: "c", Address: "c", Zone: "z2", Weight: 1},
+	}
+	tests := []struct {
+		name      string
+		picker    Picker
+		instances []*ServiceInstance
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "round robin",
+			picker:    NewRoundRobinPicker(),
+			instances: instances,
+			want:      []string{"a", "b", "c", "a"},
+		}, {
+			name:      "weighted",
+			picker:    NewWeightedPicker(),
+			instances: instances,
+			want:      []string{"a", "a", "b", "a", "c", "a", "a"},
+		}, {
+			name:      "zone",
+			picker:    NewZonePicker("z2", nil),
+			instances: instances,
+			want:      []string{"b", "c", "b"},
+		}, {
+			name:      "zone fallback",
+			picker:    NewZonePicker("z3", nil),
+			instances: instances,
+			want:      []string{"a", "b", "c"},
+		}, {
+			name:    "no instance",
+			picker:  NewWeightedPicker(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				if _, err := tt.picker.Pick(tt.instances); err != ErrNoInstance {
+					t.Errorf("Pick() error = %v, want %v", err, ErrNoInstance)
+				}
+				return
+			}
+			var got []string
+			for range tt.want {
+				instance, err := tt.picker.Pick(tt.instances)
+				if err != nil {
+					t.Fatalf("Pick() error = %v", err)
+				}
+				got = append(got, instance.Address)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Pick() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type testClientConn struct {
+	resolver.ClientConn
+	addresses chan []string
+}
+
+func (c *testClientConn) NewAddress(addresses []resolver.Address) {
+	addrs := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		addrs = append(addrs, address.Addr)
+	}
+	c.addresses <- addrs
+}
+
+func TestResolver(t *testing.T) {
+	builder := etcdClient.ResolverBuilder()
+	if builder.Scheme() != ResolverScheme {
+		t.Errorf("Scheme() = %v, want %v", builder.Scheme(), ResolverScheme)
+	}
+	cc := &testClientConn{addresses: make(chan []string, 10)}
+	r, err := builder.Build(resolver.Target{Scheme: ResolverScheme, Endpoint: testServiceName}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	defer r.Close()
+	if got := <-cc.addresses; len(got) != 0 {
+		t.Errorf("NewAddress() = %v, want empty", got)
+	}
+
+	reg, err := etcdClient.Register(context.Background(), testServiceName, &ServiceInstance{Address: "127.0.0.1:9090"})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	defer reg.Deregister()
+	select {
+	case got := <-cc.addresses:
+		if !reflect.DeepEqual(got, []string{"127.0.0.1:9090"}) {
+			t.Errorf("NewAddress() = %v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("NewAddress() not called")
+	}
+
+	if _, err := builder.Build(resolver.Target{Scheme: ResolverScheme}, cc, resolver.BuildOption{}); err == nil {
+		t.Errorf("Build() without service name should fail")
+	}
+}
+
+// 构建期间实例发生变化，最后一次通知的是最新的实例列表
+func TestResolverOrdering(t *testing.T) {
+	builder := etcdClient.ResolverBuilder()
+	for i := 0; i < 10; i++ {
+		cc := &testClientConn{addresses: make(chan []string, 100)}
+		registered := make(chan *Registration, 1)
+		go func() {
+			reg, _ := etcdClient.Register(context.Background(), testServiceName, &ServiceInstance{Address: "127.0.0.1:9091"})
+			registered <- reg
+		}()
+		r, err := builder.Build(resolver.Target{Scheme: ResolverScheme, Endpoint: testServiceName}, cc, resolver.BuildOption{})
+		if err != nil {
+			t.Fatalf("Build() error = %v", err)
+		}
+		reg := <-registered
+		if reg == nil {
+			t.Fatalf("Register() failed")
+		}
+		var last []string
+		deadline := time.After(time.Second)
+	wait:
+		for {
+			select {
+			case last = <-cc.addresses:
+				if reflect.DeepEqual(last, []string{"127.0.0.1:9091"}) {
+					break wait
+				}
+			case <-deadline:
+				t.Fatalf("NewAddress() = %v, want [127.0.0.1:9091]", last)
+			}
+		}
+		// 不会再收到较早的列表
+		select {
+		case got := <-cc.addresses:
+			t.Errorf("NewAddress() after latest = %v", got)
+		case <-time.After(50 * time.Millisecond):
+		}
+		r.Close()
+		reg.Deregister()
+	}
+}
+
+func instanceAddresses(instances []*ServiceInstance) []string {
+	addresses := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		addresses = append(addresses, instance.Address)
+	}
+	return addresses
+}
+
+func waitInstances(t *testing.T, changes chan []*ServiceInstance, want []string) {
+	t.Helper()
+	for {
+		select {
+		case instances := <-changes:
+			if reflect.DeepEqual(instanceAddresses(instances), want) {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("instances not changed to %v", want)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// etcd选主及分布式锁
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+)
+
+const (
+	// 选主的 key 前缀，候选者保存在 /election/<name>/<租约 id>
+	electionPrefix = "/election/"
+	// 分布式锁的 key 前缀，等待者保存在 /mutex/<name>/<租约 id>
+	mutexPrefix = "/mutex/"
+)
+
+var (
+	// 会话的租约已丢失
+	ErrSessionExpired = errors.New("etcd session expired")
+	// 当前没有 leader
+	ErrElectionNoLeader = errors.New("etcd election has no leader")
+	// 当前锁未被持有或已丢失
+	ErrMutexNotHeld = errors.New("etcd mutex not held")
+)
+
+// 会话，持有一个自动续期的租约，选主和分布式锁的 key 都绑定在该租约上
+// 租约丢失（如进程卡顿超过 ttl）后 Done 被关闭，会话不再可用，需要创建新的会话
+type Session struct {
+	etcd    *etcd
+	leaseID clientv3.LeaseID
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// 选主
+type Election struct {
+	session *Session
+	name    string
+	prefix  string
+
+	mu     sync.Mutex
+	key    string
+	rev    int64
+	cancel context.CancelFunc
+}
+
+// 分布式锁，按创建顺序排队获取
+type Mutex struct {
+	session *Session
+	name    string
+	prefix  string
+
+	mu  sync.Mutex
+	key string
+	rev int64
+}
+
+// 创建会话，ttl 为租约时间（秒），小于等于 0 时使用配置的 LeaseTTL
+func (e *etcd) NewSession(ttl int64) (*Session, error) {
+	if e.EtcdClient == nil {
+		return nil, etcdClientIsNilError
+	}
+	if ttl <= 0 {
+		ttl = e.config().LeaseTTL
+	}
+	timeoutCtx, timeoutCancel := e.timeoutContext()
+	defer timeoutCancel()
+	lease, err := e.EtcdClient.Grant(timeoutCtx, ttl)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	keepAlive, err := e.EtcdClient.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		cancel()
+		e.EtcdClient.Revoke(timeoutCtx, lease.ID)
+		return nil, err
+	}
+	s := &Session{etcd: e, leaseID: lease.ID, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		for range keepAlive {
+		}
+	}()
+	return s, nil
+}
+
+// 会话的租约 id
+func (s *Session) Lease() clientv3.LeaseID {
+	return s.leaseID
+}
+
+// 租约丢失或会话关闭后被关闭
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// 关闭会话并撤销租约，绑定在租约上的 key 随之删除，持有的 leader 和锁都会被释放
+// 租约已过期时同样视为关闭成功
+func (s *Session) Close() error {
+	s.cancel()
+	<-s.done
+	ctx, cancel := s.etcd.timeoutContext()
+	defer cancel()
+	_, err := s.etcd.EtcdClient.Revoke(ctx, s.leaseID)
+	if err == rpctypes.ErrLeaseNotFound {
+		return nil
+	}
+	return err
+}
+
+// 创建选主，同名的选主中同一时刻只有一个 leader
+func (s *Session) NewElection(name string) (*Election, error) {
+	if err := validateName("name", name); err != nil {
+		return nil, err
+	}
+	return &Election{session: s, name: name, prefix: electionPrefix + name + "/"}, nil
+}
+
+// 参与选主，阻塞直到成为 leader 或 ctx 结束，value 为 leader 对外公布的值（如地址）
+// 返回的 channel 在失去 leader 身份（会话丢失、key 被删除或 Resign）后被关闭，此时应立即停止工作
+// channel 关闭时参与状态已被清除，可以直接再次 Campaign；会话丢失时需要在新的会话上创建选主
+func (el *Election) Campaign(ctx context.Context, value string) (<-chan struct{}, error) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if el.key != "" {
+		return nil, fmt.Errorf("etcd election 已被当前实例参与: %s", el.name)
+	}
+	key := el.session.key(el.prefix)
+	rev, err := el.session.acquireKey(ctx, key, value)
+	if err != nil {
+		return nil, err
+	}
+	if err := el.session.waitDeletes(ctx, el.prefix, rev-1); err != nil {
+		el.session.releaseKey(key, rev)
+		return nil, err
+	}
+	monitorCtx, cancel := context.WithCancel(context.Background())
+	el.key, el.rev, el.cancel = key, rev, cancel
+	lost := make(chan struct{})
+	go func() {
+		defer close(lost)
+		el.session.waitDelete(monitorCtx, key, rev, rev+1)
+		if monitorCtx.Err() != nil {
+			// Resign 已清除状态
+			return
+		}
+		el.mu.Lock()
+		if el.key == key && el.rev == rev {
+			el.key, el.rev, el.cancel = "", 0, nil
+		}
+		el.mu.Unlock()
+		cancel()
+	}()
+	return lost, nil
+}
+
+// 放弃 leader 身份，其他候选者可以成为 leader；未成为 leader 时直接返回
+func (el *Election) Resign(ctx context.Context) error {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if el.key == "" {
+		return nil
+	}
+	el.cancel()
+	_, err := el.session.etcd.EtcdClient.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(el.key), "=", el.rev)).
+		Then(clientv3.OpDelete(el.key)).Commit()
+	if err != nil {
+		return err
+	}
+	el.key, el.rev, el.cancel = "", 0, nil
+	return nil
+}
+
+// 当前 leader 公布的值，没有 leader 时返回 ErrElectionNoLeader
+func (el *Election) Leader(ctx context.Context) (string, error) {
+	resp, err := el.session.etcd.EtcdClient.Get(ctx, el.prefix, clientv3.WithFirstCreate()...)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", ErrElectionNoLeader
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// 观察 leader 的变化，每次 leader 或其公布的值变化时发送新值，ctx 结束后 channel 被关闭
+func (el *Election) Observe(ctx context.Context) <-chan string {
+	ch := make(chan string)
+	go el.observe(ctx, ch)
+	return ch
+}
+
+func (el *Election) observe(ctx context.Context, ch chan<- string) {
+	defer close(ch)
+	client := el.session.etcd.EtcdClient
+	var last *string
+	send := func(value string) bool {
+		if last != nil && *last == value {
+			return true
+		}
+		select {
+		case ch <- value:
+			last = &value
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for ctx.Err() == nil {
+		resp, err := client.Get(ctx, el.prefix, clientv3.WithFirstCreate()...)
+		if err != nil {
+			sleepContext(ctx, bindRetryInterval)
+			continue
+		}
+		if len(resp.Kvs) == 0 {
+			// 等待新的候选者
+			watchCtx, cancel := context.WithCancel(ctx)
+			watchChan := client.Watch(clientv3.WithRequireLeader(watchCtx), el.prefix,
+				clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+			if !waitEvent(watchChan, mvccpb.PUT) {
+				sleepContext(ctx, bindRetryInterval)
+			}
+			cancel()
+			continue
+		}
+		kv := resp.Kvs[0]
+		if !send(string(kv.Value)) {
+			return
+		}
+		// 监听 leader 的 key，值变化时发送新值，删除后重新获取 leader
+		watchCtx, cancel := context.WithCancel(ctx)
+		watchChan := client.Watch(clientv3.WithRequireLeader(watchCtx), string(kv.Key),
+			clientv3.WithRev(resp.Header.Revision+1))
+	watch:
+		for resp := range watchChan {
+			if resp.Canceled || resp.Err() != nil {
+				break
+			}
+			for _, ev := range resp.Events {
+				if ev.Type == mvccpb.DELETE {
+					break watch
+				}
+				if !send(string(ev.Kv.Value)) {
+					break watch
+				}
+			}
+		}
+		cancel()
+	}
+}
+
+// 创建分布式锁，同名的锁同一时刻只能被一个会话持有
+func (s *Session) NewMutex(name string) (*Mutex, error) {
+	if err := validateName("name", name); err != nil {
+		return nil, err
+	}
+	return &Mutex{session: s, name: name, prefix: mutexPrefix + name + "/"}, nil
+}
+
+// 尝试加锁一次，锁被占用时返回 false
+func (m *Mutex) TryLock(ctx context.Context) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.key != "" {
+		return false, fmt.Errorf("etcd mutex 已被当前实例持有: %s", m.name)
+	}
+	key := m.session.key(m.prefix)
+	rev, err := m.session.acquireKey(ctx, key, "")
+	if err != nil {
+		return false, err
+	}
+	resp, err := m.session.etcd.EtcdClient.Get(ctx, m.prefix, clientv3.WithFirstCreate()...)
+	if err != nil {
+		m.session.releaseKey(key, rev)
+		return false, err
+	}
+	if len(resp.Kvs) == 0 || resp.Kvs[0].CreateRevision != rev {
+		m.session.releaseKey(key, rev)
+		return false, nil
+	}
+	m.key, m.rev = key, rev
+	return true, nil
+}
+
+// 阻塞加锁，直到成功、会话丢失或 ctx 结束
+func (m *Mutex) Lock(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.key != "" {
+		return fmt.Errorf("etcd mutex 已被当前实例持有: %s", m.name)
+	}
+	key := m.session.key(m.prefix)
+	rev, err := m.session.acquireKey(ctx, key, "")
+	if err != nil {
+		return err
+	}
+	if err := m.session.waitDeletes(ctx, m.prefix, rev-1); err != nil {
+		m.session.releaseKey(key, rev)
+		return err
+	}
+	m.key, m.rev = key, rev
+	return nil
+}
+
+// 释放锁，锁已随会话丢失时返回 ErrMutexNotHeld
+func (m *Mutex) Unlock() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.key == "" {
+		return ErrMutexNotHeld
+	}
+	released, err := m.session.releaseKey(m.key, m.rev)
+	if err != nil {
+		return err
+	}
+	m.key, m.rev = "", 0
+	if !released {
+		return ErrMutexNotHeld
+	}
+	return nil
+}
+
+// 会话在 prefix 下的 key
+func (s *Session) key(prefix string) string {
+	return fmt.Sprintf("%s%x", prefix, int64(s.leaseID))
+}
+
+// 以会话的租约创建 key，key 已存在时沿用并更新值，返回 key 的创建 revision
+func (s *Session) acquireKey(ctx context.Context, key string, value string) (int64, error) {
+	client := s.etcd.EtcdClient
+	put := clientv3.OpPut(key, value, clientv3.WithLease(s.leaseID))
+	resp, err := client.Txn(ctx).If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(put).Else(clientv3.OpGet(key)).Commit()
+	if err != nil {
+		return 0, err
+	}
+	if resp.Succeeded {
+		return resp.Header.Revision, nil
+	}
+	kvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(kvs) == 0 {
+		return 0, fmt.Errorf("etcd key 不存在: %s", key)
+	}
+	if string(kvs[0].Value) != value {
+		if _, err := client.Put(ctx, key, value, clientv3.WithLease(s.leaseID)); err != nil {
+			return 0, err
+		}
+	}
+	return kvs[0].CreateRevision, nil
+}
+
+// 删除创建 revision 为 rev 的 key，返回是否删除成功
+func (s *Session) releaseKey(key string, rev int64) (bool, error) {
+	ctx, cancel := s.etcd.timeoutContext()
+	defer cancel()
+	resp, err := s.etcd.EtcdClient.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", rev)).
+		Then(clientv3.OpDelete(key)).Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+// 等待 prefix 下创建 revision 不大于 maxCreateRev 的 key 全部被删除，即排在前面的候选者全部退出
+func (s *Session) waitDeletes(ctx context.Context, prefix string, maxCreateRev int64) error {
+	opts := append(clientv3.WithLastCreate(), clientv3.WithMaxCreateRev(maxCreateRev))
+	for {
+		resp, err := s.etcd.EtcdClient.Get(ctx, prefix, opts...)
+		if err != nil {
+			return err
+		}
+		if len(resp.Kvs) == 0 {
+			return nil
+		}
+		kv := resp.Kvs[0]
+		if err := s.waitDelete(ctx, string(kv.Key), kv.CreateRevision, resp.Header.Revision+1); err != nil {
+			return err
+		}
+	}
+}
+
+// 从 rev 开始监听，等待创建 revision 为 createRev 的 key 被删除
+// watch 中断后重新检查 key 是否存在；会话丢失时返回 ErrSessionExpired
+func (s *Session) waitDelete(ctx context.Context, key string, createRev int64, rev int64) error {
+	client := s.etcd.EtcdClient
+	for {
+		watchCtx, cancel := context.WithCancel(ctx)
+		watchChan := client.Watch(clientv3.WithRequireLeader(watchCtx), key, clientv3.WithRev(rev))
+		deleted, err := s.watchDelete(watchChan)
+		cancel()
+		if err != nil || deleted {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sleepContext(ctx, bindRetryInterval)
+		resp, err := client.Get(ctx, key)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+		if len(resp.Kvs) == 0 || resp.Kvs[0].CreateRevision != createRev {
+			return nil
+		}
+		rev = resp.Header.Revision + 1
+	}
+}
+
+// 读取 watch 事件直到 key 被删除（返回 true）或 watch 中断（返回 false）
+func (s *Session) watchDelete(watchChan clientv3.WatchChan) (bool, error) {
+	for {
+		select {
+		case <-s.done:
+			return false, ErrSessionExpired
+		case resp, ok := <-watchChan:
+			if !ok || resp.Canceled || resp.Err() != nil {
+				return false, nil
+			}
+			for _, ev := range resp.Events {
+				if ev.Type == mvccpb.DELETE {
+					return true, nil
+				}
+			}
+		}
+	}
+}
+
+// 等待指定类型的事件，收到时返回 true，watch 中断时返回 false
+func waitEvent(watchChan clientv3.WatchChan, typ mvccpb.Event_EventType) bool {
+	for resp := range watchChan {
+		if resp.Canceled || resp.Err() != nil {
+			return false
+		}
+		for _, ev := range resp.Events {
+			if ev.Type == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
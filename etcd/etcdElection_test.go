@@ -0,0 +1,243 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// etcd选主及分布式锁
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+)
+
+const testElectionName = "liuchonglin-test-election"
+
+func newTestSession(t *testing.T) *Session {
+	t.Helper()
+	s, err := etcdClient.NewSession(0)
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	return s
+}
+
+func TestNewElection(t *testing.T) {
+	s := newTestSession(t)
+	defer s.Close()
+	tests := []struct {
+		name    string
+		elName  string
+		wantErr bool
+	}{
+		{name: "all", elName: testElectionName},
+		{name: "name empty", elName: "", wantErr: true},
+		{name: "name contains /", elName: "a/b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.NewElection(tt.elName); (err != nil) != tt.wantErr {
+				t.Errorf("NewElection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := s.NewMutex(tt.elName); (err != nil) != tt.wantErr {
+				t.Errorf("NewMutex() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestElection(t *testing.T) {
+	s1, s2 := newTestSession(t), newTestSession(t)
+	defer s1.Close()
+	defer s2.Close()
+	e1, _ := s1.NewElection(testElectionName)
+	e2, _ := s2.NewElection(testElectionName)
+	ctx := context.Background()
+
+	if _, err := e1.Leader(ctx); err != ErrElectionNoLeader {
+		t.Errorf("Leader() error = %v, want %v", err, ErrElectionNoLeader)
+	}
+	observeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	observe := e2.Observe(observeCtx)
+
+	lost1, err := e1.Campaign(ctx, "node1")
+	if err != nil {
+		t.Fatalf("Campaign() error = %v", err)
+	}
+	if got, err := e2.Leader(ctx); err != nil || got != "node1" {
+		t.Errorf("Leader() = %v, %v, want node1", got, err)
+	}
+	waitObserve(t, observe, "node1")
+
+	// 第二个候选者阻塞到第一个放弃为止
+	elected := make(chan (<-chan struct{}), 1)
+	go func() {
+		lost, err := e2.Campaign(ctx, "node2")
+		if err != nil {
+			t.Errorf("Campaign() error = %v", err)
+		}
+		elected <- lost
+	}()
+	select {
+	case <-elected:
+		t.Fatalf("Campaign() should block while node1 is leader")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if err := e1.Resign(ctx); err != nil {
+		t.Fatalf("Resign() error = %v", err)
+	}
+	select {
+	case <-lost1:
+	case <-time.After(time.Second):
+		t.Errorf("leadership lost not notified after Resign()")
+	}
+	var lost2 <-chan struct{}
+	select {
+	case lost2 = <-elected:
+	case <-time.After(time.Second):
+		t.Fatalf("Campaign() not elected after Resign()")
+	}
+	waitObserve(t, observe, "node2")
+
+	// 租约丢失后失去 leader 身份
+	ctx2, cancel2 := etcdClient.timeoutContext()
+	_, err = etcdClient.EtcdClient.Revoke(ctx2, s2.Lease())
+	cancel2()
+	if err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	select {
+	case <-lost2:
+	case <-time.After(time.Second):
+		t.Errorf("leadership lost not notified after lease revoked")
+	}
+}
+
+// 失去 leader 身份后可以再次参与，会话过期后 Close 不返回错误
+func TestCampaignAfterLost(t *testing.T) {
+	s := newTestSession(t)
+	el, _ := s.NewElection(testElectionName)
+	ctx := context.Background()
+	lost, err := el.Campaign(ctx, "node1")
+	if err != nil {
+		t.Fatalf("Campaign() error = %v", err)
+	}
+	// leader 的 key 被删除
+	if _, err := etcdClient.EtcdClient.Delete(ctx, electionPrefix+testElectionName+"/", clientv3.WithPrefix()); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatalf("leadership lost not notified after key deleted")
+	}
+	lost, err = el.Campaign(ctx, "node1")
+	if err != nil {
+		t.Fatalf("Campaign() after lost error = %v", err)
+	}
+	if err := el.Resign(ctx); err != nil {
+		t.Errorf("Resign() error = %v", err)
+	}
+	<-lost
+
+	ctx2, cancel2 := etcdClient.timeoutContext()
+	_, err = etcdClient.EtcdClient.Revoke(ctx2, s.Lease())
+	cancel2()
+	if err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close() after lease revoked error = %v", err)
+	}
+}
+
+func TestCampaignTimeout(t *testing.T) {
+	s1, s2 := newTestSession(t), newTestSession(t)
+	defer s1.Close()
+	defer s2.Close()
+	e1, _ := s1.NewElection(testElectionName)
+	e2, _ := s2.NewElection(testElectionName)
+	if _, err := e1.Campaign(context.Background(), "node1"); err != nil {
+		t.Fatalf("Campaign() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := e2.Campaign(ctx, "node2"); err != context.DeadlineExceeded {
+		t.Errorf("Campaign() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got, err := e1.Leader(context.Background()); err != nil || got != "node1" {
+		t.Errorf("Leader() = %v, %v, want node1", got, err)
+	}
+}
+
+func TestMutex(t *testing.T) {
+	s1, s2 := newTestSession(t), newTestSession(t)
+	defer s1.Close()
+	defer s2.Close()
+	m1, _ := s1.NewMutex(testElectionName)
+	m2, _ := s2.NewMutex(testElectionName)
+	ctx := context.Background()
+
+	if err := m1.Unlock(); err != ErrMutexNotHeld {
+		t.Errorf("Unlock() error = %v, want %v", err, ErrMutexNotHeld)
+	}
+	if ok, err := m1.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("TryLock() = %v, %v, want true", ok, err)
+	}
+	if _, err := m1.TryLock(ctx); err == nil {
+		t.Errorf("TryLock() twice should fail")
+	}
+	if ok, err := m2.TryLock(ctx); err != nil || ok {
+		t.Errorf("TryLock() = %v, %v, want false", ok, err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if err := m2.Lock(timeoutCtx); err != context.DeadlineExceeded {
+		t.Errorf("Lock() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	locked := make(chan error, 1)
+	go func() { locked <- m2.Lock(ctx) }()
+	time.Sleep(100 * time.Millisecond)
+	if err := m1.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatalf("Lock() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Lock() not acquired after Unlock()")
+	}
+	if err := m2.Unlock(); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+}
+
+func waitObserve(t *testing.T, observe <-chan string, want string) {
+	t.Helper()
+	for {
+		select {
+		case got := <-observe:
+			if got == want {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Observe() not received %v", want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// etcd前缀查询
+package etcd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/liuchonglin/go-utils"
+	"go.etcd.io/etcd/clientv3"
+)
+
+// List 的默认单页数量
+const listPageSize = 1000
+
+// key 及其版本信息
+type KeyValue struct {
+	Key   string
+	Value string
+	// 创建时的 revision
+	CreateRevision int64
+	// 最后一次修改的 revision
+	ModRevision int64
+	// 修改次数，创建时为 1
+	Version int64
+	// 绑定的租约 id，没有租约时为 0
+	Lease int64
+}
+
+// 分页读取的位置，后续页面与第一页读取同一个 revision，得到一致的快照
+type Cursor struct {
+	// 下一页的起始 key
+	Key string
+	// 读取的 revision
+	Revision int64
+}
+
+// 列出目录 prefix 下的所有 key（包括子目录），按 key 排序
+// prefix 按目录匹配，如 /company/project 不会匹配 /company/project2；prefix 为 / 时列出所有 key
+func (e *etcd) List(prefix string) ([]*KeyValue, error) {
+	var kvs []*KeyValue
+	var cursor *Cursor
+	for {
+		page, next, err := e.ListPage(prefix, cursor, listPageSize)
+		if err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, page...)
+		if next == nil {
+			return kvs, nil
+		}
+		cursor = next
+	}
+}
+
+// 分页列出目录 prefix 下的 key，cursor 为 nil 时从第一页开始
+// 返回下一页的 cursor，已经是最后一页时返回 nil；revision 已被压缩时返回错误，需要从第一页重新读取
+func (e *etcd) ListPage(prefix string, cursor *Cursor, limit int64) ([]*KeyValue, *Cursor, error) {
+	if e.EtcdClient == nil {
+		return nil, nil, etcdClientIsNilError
+	}
+	dir := dirKey(prefix)
+	if utils.IsEmpty(dir) {
+		return nil, nil, keyEmptyError
+	}
+	if limit <= 0 {
+		return nil, nil, fmt.Errorf("limit 必须大于 0")
+	}
+	start, rev := dir, int64(0)
+	if cursor != nil {
+		if !strings.HasPrefix(cursor.Key, dir) {
+			return nil, nil, fmt.Errorf("cursor 与 prefix 不匹配: %s", cursor.Key)
+		}
+		start, rev = cursor.Key, cursor.Revision
+	}
+	ctx, cancel := e.timeoutContext()
+	defer cancel()
+	resp, err := e.EtcdClient.Get(ctx, start, clientv3.WithRange(clientv3.GetPrefixRangeEnd(dir)),
+		clientv3.WithRev(rev), clientv3.WithLimit(limit), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, nil, &TransportError{Op: "list", Key: dir, Err: err}
+	}
+	kvs := make([]*KeyValue, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs = append(kvs, &KeyValue{
+			Key:            string(kv.Key),
+			Value:          string(kv.Value),
+			CreateRevision: kv.CreateRevision,
+			ModRevision:    kv.ModRevision,
+			Version:        kv.Version,
+			Lease:          kv.Lease,
+		})
+	}
+	if !resp.More || len(kvs) == 0 {
+		return kvs, nil, nil
+	}
+	if rev == 0 {
+		rev = resp.Header.Revision
+	}
+	// 紧跟在最后一个 key 之后的 key
+	return kvs, &Cursor{Key: kvs[len(kvs)-1].Key + "\x00", Revision: rev}, nil
+}
+
+// 将目录 prefix 下的 key 按 / 拆分为嵌套的 map，叶子节点的值为 string
+// 如 /a/b/c=1 在 prefix 为 /a 时得到 {"b": {"c": "1"}}
+// key 同时是目录时，它自身的值保存在该目录 map 的 "" 下
+func (e *etcd) Tree(prefix string) (map[string]interface{}, error) {
+	kvs, err := e.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	dir := dirKey(prefix)
+	tree := make(map[string]interface{})
+	for _, kv := range kvs {
+		node := tree
+		parts := strings.Split(strings.TrimPrefix(kv.Key, dir), "/")
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				if child, ok := node[part].(map[string]interface{}); ok {
+					child[""] = kv.Value
+				} else {
+					node[part] = kv.Value
+				}
+				break
+			}
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				if value, ok := node[part].(string); ok {
+					child[""] = value
+				}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return tree, nil
+}
+
+// 目录 key，以 / 结尾，prefix 不合法时返回空字符串
+func dirKey(prefix string) string {
+	if prefix == "/" {
+		return prefix
+	}
+	if prefix = formatKey(prefix); utils.IsEmpty(prefix) {
+		return ""
+	}
+	return prefix + "/"
+}
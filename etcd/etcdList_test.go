@@ -0,0 +1,176 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// etcd前缀查询
+package etcd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const testListPrefix = "/liuchonglin/test/list"
+
+var testListValues = map[string]string{
+	testListPrefix + "/before/a":   `{"a":1}`,
+	testListPrefix + "/before/b":   `{"b":2}`,
+	testListPrefix + "/after/c":    `{"c":3}`,
+	testListPrefix + "/after/c/d":  `{"d":4}`,
+	testListPrefix + "2/before/e":  `{"e":5}`,
+	testListPrefix + "/after/f/g/": `{"g":6}`,
+}
+
+func putListValues(t *testing.T) func() {
+	t.Helper()
+	for key, value := range testListValues {
+		if err := etcdClient.Put(key, value); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	return func() {
+		for key := range testListValues {
+			etcdClient.Delete(key)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	defer putListValues(t)()
+	tests := []struct {
+		name     string
+		prefix   string
+		wantKeys []string
+		wantErr  bool
+	}{
+		{
+			name:   "all",
+			prefix: testListPrefix,
+			wantKeys: []string{
+				testListPrefix + "/after/c",
+				testListPrefix + "/after/c/d",
+				testListPrefix + "/after/f/g",
+				testListPrefix + "/before/a",
+				testListPrefix + "/before/b",
+			},
+		}, {
+			name:     "trailing slash",
+			prefix:   testListPrefix + "/before/",
+			wantKeys: []string{testListPrefix + "/before/a", testListPrefix + "/before/b"},
+		}, {
+			name:     "not exist",
+			prefix:   testListPrefix + "/none",
+			wantKeys: []string{},
+		}, {
+			name:    "prefix empty",
+			prefix:  "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kvs, err := etcdClient.List(tt.prefix)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("List() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			keys := make([]string, 0, len(kvs))
+			for _, kv := range kvs {
+				keys = append(keys, kv.Key)
+				if kv.Value != testListValues[kv.Key] && kv.Value != testListValues[kv.Key+"/"] {
+					t.Errorf("List() value of %v = %v", kv.Key, kv.Value)
+				}
+				if kv.Version != 1 || kv.CreateRevision == 0 || kv.ModRevision != kv.CreateRevision {
+					t.Errorf("List() revision of %v = %+v", kv.Key, kv)
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("List() = %v, want %v", keys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestListPage(t *testing.T) {
+	defer putListValues(t)()
+	var keys []string
+	var cursor *Cursor
+	pages := 0
+	for {
+		kvs, next, err := etcdClient.ListPage(testListPrefix, cursor, 2)
+		if err != nil {
+			t.Fatalf("ListPage() error = %v", err)
+		}
+		if len(kvs) > 2 {
+			t.Errorf("ListPage() returned %v keys, want at most 2", len(kvs))
+		}
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+		}
+		pages++
+		if next == nil {
+			break
+		}
+		if cursor != nil && next.Revision != cursor.Revision {
+			t.Errorf("ListPage() revision = %v, want %v", next.Revision, cursor.Revision)
+		}
+		cursor = next
+	}
+	if pages != 3 || len(keys) != 5 {
+		t.Errorf("ListPage() = %v pages %v, want 3 pages of 5 keys", pages, keys)
+	}
+
+	if _, _, err := etcdClient.ListPage(testListPrefix, nil, 0); err == nil {
+		t.Errorf("ListPage() with limit 0 should fail")
+	}
+	if _, _, err := etcdClient.ListPage(testListPrefix, &Cursor{Key: "/other"}, 2); err == nil {
+		t.Errorf("ListPage() with mismatched cursor should fail")
+	}
+}
+
+func TestTree(t *testing.T) {
+	defer putListValues(t)()
+	tree, err := etcdClient.Tree(testListPrefix)
+	if err != nil {
+		t.Fatalf("Tree() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"before": map[string]interface{}{"a": `{"a":1}`, "b": `{"b":2}`},
+		"after": map[string]interface{}{
+			"c": map[string]interface{}{"": `{"c":3}`, "d": `{"d":4}`},
+			"f": map[string]interface{}{"g": `{"g":6}`},
+		},
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("Tree() = %v, want %v", tree, want)
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := error(&TransportError{Op: "get", Key: "/a", Err: cause})
+	if err.Error() != "etcd get /a: connection refused" {
+		t.Errorf("Error() = %v", err.Error())
+	}
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) || !errors.Is(err, cause) {
+		t.Errorf("errors.As() or errors.Is() failed for %v", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("TransportError should not be ErrNotFound")
+	}
+}
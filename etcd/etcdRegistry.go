@@ -0,0 +1,219 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// etcd服务注册
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liuchonglin/go-utils"
+	"go.etcd.io/etcd/clientv3"
+)
+
+const (
+	// 服务实例的 key 前缀，实例保存在 /services/<服务名>/<实例 id>
+	servicesPrefix = "/services/"
+	// 重新注册的最小、最大等待时间
+	registerMinBackoff = 500 * time.Millisecond
+	registerMaxBackoff = 30 * time.Second
+)
+
+// 服务实例
+type ServiceInstance struct {
+	// 实例 id，同一服务内唯一
+	// 默认值：Address
+	Id string `json:"id"`
+	// 服务地址，如 10.0.0.1:8080
+	Address string `json:"address"`
+	// 版本
+	Version string `json:"version"`
+	// 所在可用区
+	Zone string `json:"zone"`
+	// 权重，按权重选择实例时使用
+	// 默认值：1
+	Weight int `json:"weight"`
+	// 其他元数据
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+func (s *ServiceInstance) defaultValue() {
+	if utils.IsEmpty(s.Id) {
+		s.Id = s.Address
+	}
+	if s.Weight == 0 {
+		s.Weight = 1
+	}
+}
+
+// 服务注册，持有租约并自动续期
+type Registration struct {
+	etcd  *etcd
+	key   string
+	value string
+	ttl   int64
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	leaseID clientv3.LeaseID
+}
+
+// 注册服务实例：申请租约，将实例 json 写入 /services/<serviceName>/<id> 并自动续期
+// 租约丢失（如 etcd 会话超时）后自动重新申请租约并写入；ctx 结束后停止续期，实例在租约到期后被移除
+// 正常退出时应调用 Deregister 立即移除实例
+func (e *etcd) Register(ctx context.Context, serviceName string, instance *ServiceInstance) (*Registration, error) {
+	if e.EtcdClient == nil {
+		return nil, etcdClientIsNilError
+	}
+	if err := validateServiceName(serviceName); err != nil {
+		return nil, err
+	}
+	if instance == nil || utils.IsEmpty(instance.Address) {
+		return nil, fmt.Errorf("instance address 不能为空")
+	}
+	ins := *instance
+	ins.defaultValue()
+	if strings.Contains(ins.Id, "/") {
+		return nil, fmt.Errorf("instance id 不能包含 /: %s", ins.Id)
+	}
+	value, err := json.Marshal(&ins)
+	if err != nil {
+		return nil, err
+	}
+	r := &Registration{
+		etcd:  e,
+		key:   serviceKey(serviceName) + ins.Id,
+		value: string(value),
+		ttl:   e.config().LeaseTTL,
+		done:  make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r.cancel = cancel
+	keepAlive, err := r.register(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go r.keepAlive(ctx, keepAlive)
+	return r, nil
+}
+
+// 实例的 key
+func (r *Registration) Key() string {
+	return r.key
+}
+
+// 当前的租约 id
+func (r *Registration) LeaseID() clientv3.LeaseID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.leaseID
+}
+
+// 注销实例：停止续期并撤销租约，实例 key 随租约一起删除
+func (r *Registration) Deregister() error {
+	r.cancel()
+	<-r.done
+	leaseID := r.LeaseID()
+	if leaseID == clientv3.NoLease {
+		return nil
+	}
+	ctx, cancel := r.etcd.timeoutContext()
+	defer cancel()
+	if _, err := r.etcd.EtcdClient.Revoke(ctx, leaseID); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.leaseID = clientv3.NoLease
+	r.mu.Unlock()
+	return nil
+}
+
+// 申请租约并写入实例，返回续期应答的 channel
+func (r *Registration) register(ctx context.Context) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	timeoutCtx, cancel := r.etcd.timeoutContext()
+	defer cancel()
+	lease, err := r.etcd.EtcdClient.Grant(timeoutCtx, r.ttl)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.etcd.EtcdClient.Put(timeoutCtx, r.key, r.value, clientv3.WithLease(lease.ID)); err != nil {
+		r.etcd.EtcdClient.Revoke(timeoutCtx, lease.ID)
+		return nil, err
+	}
+	keepAlive, err := r.etcd.EtcdClient.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		r.etcd.EtcdClient.Revoke(timeoutCtx, lease.ID)
+		return nil, err
+	}
+	r.mu.Lock()
+	r.leaseID = lease.ID
+	r.mu.Unlock()
+	return keepAlive, nil
+}
+
+// 消费续期应答，channel 关闭说明租约已丢失或续期失败，按指数退避重新注册
+func (r *Registration) keepAlive(ctx context.Context, keepAlive <-chan *clientv3.LeaseKeepAliveResponse) {
+	defer close(r.done)
+	backoff := registerMinBackoff
+	for {
+		for range keepAlive {
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		for {
+			var err error
+			if keepAlive, err = r.register(ctx); err == nil {
+				backoff = registerMinBackoff
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > registerMaxBackoff {
+				backoff = registerMaxBackoff
+			}
+		}
+	}
+}
+
+// 服务的 key 前缀，以 / 结尾
+func serviceKey(serviceName string) string {
+	return servicesPrefix + serviceName + "/"
+}
+
+func validateServiceName(serviceName string) error {
+	return validateName("serviceName", serviceName)
+}
+
+// 校验作为 key 中一段的名称，不能为空且不能包含 /
+func validateName(field string, name string) error {
+	if utils.IsEmpty(name) {
+		return fmt.Errorf("%s 不能为空", field)
+	}
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("%s 不能包含 /: %s", field, name)
+	}
+	return nil
+}
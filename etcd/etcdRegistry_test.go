@@ -0,0 +1,134 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// etcd服务注册
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const testServiceName = "liuchonglin-test-registry"
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name        string
+		serviceName string
+		instance    *ServiceInstance
+		wantKey     string
+		wantWeight  int
+		wantErr     bool
+	}{
+		{
+			name:        "all",
+			serviceName: testServiceName,
+			instance:    &ServiceInstance{Id: "1", Address: "127.0.0.1:8080", Version: "v1", Zone: "a", Weight: 3},
+			wantKey:     "/services/" + testServiceName + "/1",
+			wantWeight:  3,
+		}, {
+			name:        "default value",
+			serviceName: testServiceName,
+			instance:    &ServiceInstance{Address: "127.0.0.1:8081"},
+			wantKey:     "/services/" + testServiceName + "/127.0.0.1:8081",
+			wantWeight:  1,
+		}, {
+			name:        "serviceName empty",
+			serviceName: "",
+			instance:    &ServiceInstance{Address: "127.0.0.1:8080"},
+			wantErr:     true,
+		}, {
+			name:        "serviceName contains /",
+			serviceName: "a/b",
+			instance:    &ServiceInstance{Address: "127.0.0.1:8080"},
+			wantErr:     true,
+		}, {
+			name:        "address empty",
+			serviceName: testServiceName,
+			instance:    &ServiceInstance{Id: "1"},
+			wantErr:     true,
+		}, {
+			name:        "instance nil",
+			serviceName: testServiceName,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := etcdClient.Register(context.Background(), tt.serviceName, tt.instance)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Register() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if r.Key() != tt.wantKey {
+				t.Errorf("Key() = %v, want %v", r.Key(), tt.wantKey)
+			}
+			var got ServiceInstance
+			if err := json.Unmarshal([]byte(testGetRaw(t, r.Key())), &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if got.Address != tt.instance.Address || got.Weight != tt.wantWeight {
+				t.Errorf("Get() = %+v", got)
+			}
+			if err := r.Deregister(); err != nil {
+				t.Errorf("Deregister() error = %v", err)
+			}
+			if v := testGetRaw(t, r.Key()); v != "" {
+				t.Errorf("Get() after Deregister() = %v, want empty", v)
+			}
+		})
+	}
+}
+
+// 租约丢失后自动重新注册
+func TestRegisterLeaseLost(t *testing.T) {
+	r, err := etcdClient.Register(context.Background(), testServiceName, &ServiceInstance{Address: "127.0.0.1:8082"})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	defer r.Deregister()
+	leaseID := r.LeaseID()
+	ctx, cancel := etcdClient.timeoutContext()
+	_, err = etcdClient.EtcdClient.Revoke(ctx, leaseID)
+	cancel()
+	if err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for r.LeaseID() == leaseID || testGetRaw(t, r.Key()) == "" {
+		if time.Now().After(deadline) {
+			t.Fatalf("instance not registered again")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// 读取 key 的原始值，不存在时返回空字符串
+func testGetRaw(t *testing.T, key string) string {
+	ctx, cancel := etcdClient.timeoutContext()
+	defer cancel()
+	resp, err := etcdClient.EtcdClient.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return ""
+	}
+	return string(resp.Kvs[0].Value)
+}
@@ -156,21 +156,36 @@ func TestGet(t *testing.T) {
 		config interface{}
 	}
 	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
+		name      string
+		args      args
+		wantErr   bool
+		wantErrIs error
 	}{
 		{
 			name:    "all",
 			args:    args{key: testConfigKey, config: &configMap},
 			wantErr: false,
+		}, {
+			name:      "key not exist",
+			args:      args{key: testConfigKey + "/none", config: &configMap},
+			wantErr:   true,
+			wantErrIs: ErrNotFound,
+		}, {
+			name:      "key empty",
+			args:      args{key: "", config: &configMap},
+			wantErr:   true,
+			wantErrIs: keyEmptyError,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := etcdClient.Get(tt.args.key, tt.args.config); (err != nil) != tt.wantErr {
+			err := etcdClient.Get(tt.args.key, tt.args.config)
+			if (err != nil) != tt.wantErr {
 				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if tt.wantErrIs != nil && err != tt.wantErrIs {
+				t.Errorf("Get() error = %v, want %v", err, tt.wantErrIs)
+			}
 			fmt.Println(tt.args.config)
 		})
 	}
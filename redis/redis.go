@@ -16,14 +16,29 @@
 package redis
 
 import (
+	"context"
 	"github.com/gomodule/redigo/redis"
+	"errors"
 	"fmt"
-	"time"
 	"github.com/liuchonglin/go-utils"
+	"time"
 )
 
+// key 不存在
+var ErrNotFound = errors.New("redis key not found")
+
 type Redis struct {
 	RedisPool *redis.Pool
+	// 集群模式下的集群路由，其他模式为 nil
+	cluster *cluster
+	// key 前缀，见 WithNamespace
+	prefix string
+	// 连接池等待统计、命令监控和日志，所有视图共享
+	monitor *monitor
+	// 连接的读超时，context 版本的方法据此计算每条命令的超时时间
+	readTimeout time.Duration
+	// context 版本的方法绑定的 ctx，见 bind
+	ctx context.Context
 }
 
 func NewRedis(redisConfig *RedisConfig) (*Redis, error) {
@@ -31,41 +46,64 @@ func NewRedis(redisConfig *RedisConfig) (*Redis, error) {
 		redisConfig = &RedisConfig{}
 		redisConfig.defaultValue()
 	}
-	// MaxIdle：最大的空闲连接数，表示即使没有redis连接时依然可以保持N个空闲的连接，而不被清除，随时处于待命状态。
-	// MaxActive：最大的激活连接数，表示同时最多有N个连接
-	// IdleTimeout：最大的空闲连接等待时间，超过此时间后，空闲连接将被关闭
-	redisPool := &redis.Pool{
-		MaxIdle:     redisConfig.MaxIdle,
-		MaxActive:   redisConfig.MaxActive,
-		IdleTimeout: time.Duration(redisConfig.IdleTimeout) * time.Second,
-		Dial: func() (redis.Conn, error) {
-			if utils.IsEmpty(redisConfig.Password) {
-				return redis.Dial("tcp", redisConfig.Address)
-			} else {
-				return redis.Dial("tcp", redisConfig.Address,
-					redis.DialKeepAlive(1*time.Second),
-					redis.DialConnectTimeout(5*time.Second),
-					redis.DialReadTimeout(1*time.Second),
-					redis.DialPassword(redisConfig.Password))
-			}
-		},
+	// 复制一份再填充默认值，不修改调用方的配置
+	copied := *redisConfig
+	redisConfig = &copied
+	redisConfig.dialDefaultValue()
+	d, err := newDialer(redisConfig)
+	if err != nil {
+		return nil, fmt.Errorf("redis 初始化失败: %v", err)
 	}
-	if _, err := redisPool.Dial(); err != nil {
+	// 根据部署模式设置连接方式
+	var redisPool *redis.Pool
+	var redisCluster *cluster
+	switch redisConfig.Mode {
+	case SENTINEL:
+		s, err := newSentinel(redisConfig, d)
+		if err != nil {
+			return nil, fmt.Errorf("redis 初始化失败: %v", err)
+		}
+		redisPool = newPool(redisConfig, s.dial)
+		redisPool.TestOnBorrow = s.testOnBorrow
+	case CLUSTER:
+		c, err := newCluster(redisConfig, d)
+		if err != nil {
+			return nil, fmt.Errorf("redis 初始化失败: %v", err)
+		}
+		redisPool = newPool(redisConfig, c.dial)
+		// 路由连接本身不持有网络连接，健康检查由各节点的连接池负责
+		redisPool.TestOnBorrow = nil
+		redisCluster = c
+	default:
+		redisPool = newPool(redisConfig, func() (redis.Conn, error) {
+			return d.dial(redisConfig.Address)
+		})
+	}
+	conn, err := redisPool.Dial()
+	if err != nil {
 		return nil, fmt.Errorf("redis 初始化失败: %v", err)
 	}
-	return &Redis{RedisPool: redisPool}, nil
+	conn.Close()
+	r := &Redis{RedisPool: redisPool, cluster: redisCluster, prefix: redisConfig.KeyPrefix,
+		monitor: newMonitor(redisConfig.MaxActive), readTimeout: time.Duration(redisConfig.ReadTimeout) * time.Second}
+	if redisConfig.PreloadScripts {
+		if err := r.LoadScripts(); err != nil {
+			return nil, fmt.Errorf("redis 初始化失败: %v", err)
+		}
+	}
+	return r, nil
 }
 
-// 获取 key 对应的 string 值
+// 获取 key 对应的 string 值，key 不存在时返回 ErrNotFound
 func (r *Redis) Get(key string) (value string, err error) {
 	if utils.IsEmpty(key) {
 		return "", fmt.Errorf("key 不能为空")
 	}
-	conn := r.RedisPool.Get()
+	conn := r.conn()
 	defer conn.Close()
 	result, err := conn.Do("get", key)
 	if result == nil && err == nil {
-		return "", nil
+		return "", ErrNotFound
 	}
 	value, err = redis.String(result, err)
 	if err != nil {
@@ -84,7 +122,7 @@ func (r *Redis) Del(key string) error {
 	if utils.IsEmpty(key) {
 		return fmt.Errorf("key 不能为空")
 	}
-	conn := r.RedisPool.Get()
+	conn := r.conn()
 	defer conn.Close()
 
 	_, err := conn.Do("del", key)
@@ -94,23 +132,15 @@ func (r *Redis) Del(key string) error {
 	return nil
 }
 
-// 设置 string 值 和 超时时间
+// 设置 string 值 和 超时时间，ex 大于 0 时在同一条 SET 命令中设置超时时间（秒）
 func (r *Redis) SetExpire(key string, value string, ex int) error {
-	if utils.IsEmpty(key) || utils.IsEmpty(value) {
-		return fmt.Errorf("key or value 不能为空")
-	}
+	_, err := r.SetWithOptions(key, value, &SetOptions{Expire: time.Duration(ex) * time.Second})
+	return err
+}
 
-	conn := r.RedisPool.Get()
+// 从连接池获取连接执行命令，执行完毕归还连接
+func (r *Redis) do(commandName string, args ...interface{}) (interface{}, error) {
+	conn := r.conn()
 	defer conn.Close()
-	_, err := conn.Do("set", key, value)
-	if err != nil {
-		return err
-	}
-	if ex > 0 {
-		_, err = conn.Do("expire", key, ex)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return conn.Do(commandName, args...)
 }
@@ -0,0 +1,208 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis布隆过滤器
+package redis
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// redis string 最大 512MB，即 2^32 位
+const bloomMaxBits = 1 << 32
+
+// 设置元素的所有位，返回每个元素是否是新增的（至少有一位原来为 0）
+// ARGV[1] 为每个元素的位数，之后依次为各元素的偏移量
+var bloomAddScript = NewScript(1, `
+local k = tonumber(ARGV[1])
+local result = {}
+for i = 2, #ARGV, k do
+	local added = 0
+	for j = i, i + k - 1 do
+		if redis.call("setbit", KEYS[1], ARGV[j], 1) == 0 then
+			added = 1
+		end
+	end
+	result[#result + 1] = added
+end
+return result`)
+
+// 检查元素的所有位，参数同 bloomAddScript，返回每个元素是否可能存在
+var bloomExistsScript = NewScript(1, `
+local k = tonumber(ARGV[1])
+local result = {}
+for i = 2, #ARGV, k do
+	local exists = 1
+	for j = i, i + k - 1 do
+		if redis.call("getbit", KEYS[1], ARGV[j]) == 0 then
+			exists = 0
+			break
+		end
+	end
+	result[#result + 1] = exists
+end
+return result`)
+
+// 布隆过滤器配置
+type BloomFilterConfig struct {
+	// 存储位图的 key
+	Key string `json:"key" yaml:"key"`
+	// 预计元素数量，超过后误判率会升高
+	// 默认值：1000000
+	Capacity int64 `json:"capacity" yaml:"capacity"`
+	// 期望的误判率，取值范围 (0, 1)
+	// 默认值：0.01
+	ErrorRate float64 `json:"errorRate" yaml:"errorRate"`
+}
+
+func (b *BloomFilterConfig) defaultValue() {
+	if b.Capacity == 0 {
+		b.Capacity = 1000000
+	}
+	if b.ErrorRate == 0 {
+		b.ErrorRate = 0.01
+	}
+}
+
+// 基于 SETBIT/GETBIT 的布隆过滤器，判断不存在时一定不存在，判断存在时有一定误判率
+// 位图在第一次 Add 时由 redis 按需分配
+type BloomFilter struct {
+	redis  *Redis
+	key    string
+	bits   uint64
+	hashes int
+}
+
+// 创建布隆过滤器，位数和哈希函数个数由容量和误判率计算得到
+// 同一个 key 的容量和误判率需要保持一致，否则已有数据失效
+func (r *Redis) NewBloomFilter(config *BloomFilterConfig) (*BloomFilter, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config 不能为空")
+	}
+	if utils.IsEmpty(config.Key) {
+		return nil, fmt.Errorf("key 不能为空")
+	}
+	c := *config
+	c.defaultValue()
+	if c.Capacity < 0 {
+		return nil, fmt.Errorf("capacity 不能小于 0")
+	}
+	if c.ErrorRate <= 0 || c.ErrorRate >= 1 {
+		return nil, fmt.Errorf("errorRate 必须在 0 和 1 之间")
+	}
+	bits, hashes := bloomSize(c.Capacity, c.ErrorRate)
+	if bits > bloomMaxBits {
+		return nil, fmt.Errorf("redis 布隆过滤器需要 %d 位，超过了 string 的最大长度", bits)
+	}
+	return &BloomFilter{redis: r, key: c.Key, bits: bits, hashes: hashes}, nil
+}
+
+// 位图的位数
+func (b *BloomFilter) Bits() uint64 {
+	return b.bits
+}
+
+// 哈希函数个数
+func (b *BloomFilter) Hashes() int {
+	return b.hashes
+}
+
+// 添加元素，返回 false 表示元素可能已经存在
+func (b *BloomFilter) Add(item string) (bool, error) {
+	added, err := b.AddMulti(item)
+	if err != nil {
+		return false, err
+	}
+	return added[0], nil
+}
+
+// 批量添加元素，返回值与 items 一一对应
+func (b *BloomFilter) AddMulti(items ...string) ([]bool, error) {
+	return b.eval(bloomAddScript, items)
+}
+
+// 判断元素是否可能存在
+func (b *BloomFilter) Exists(item string) (bool, error) {
+	exists, err := b.ExistsMulti(item)
+	if err != nil {
+		return false, err
+	}
+	return exists[0], nil
+}
+
+// 批量判断元素是否可能存在，返回值与 items 一一对应
+func (b *BloomFilter) ExistsMulti(items ...string) ([]bool, error) {
+	return b.eval(bloomExistsScript, items)
+}
+
+// 清空过滤器
+func (b *BloomFilter) Clear() error {
+	return b.redis.Del(b.key)
+}
+
+func (b *BloomFilter) eval(script *Script, items []string) ([]bool, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("items 不能为空")
+	}
+	args := make([]interface{}, 0, 2+len(items)*b.hashes)
+	args = append(args, b.key, b.hashes)
+	for _, item := range items {
+		for _, offset := range b.offsets(item) {
+			args = append(args, offset)
+		}
+	}
+	values, err := redis.Ints(b.redis.Eval(script, args...))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]bool, len(values))
+	for i, v := range values {
+		result[i] = v == 1
+	}
+	return result, nil
+}
+
+// 元素对应的位偏移量，通过两个哈希值组合出 k 个哈希函数（Kirsch-Mitzenmacher）
+func (b *BloomFilter) offsets(item string) []uint64 {
+	h := fnv.New128a()
+	h.Write([]byte(item))
+	sum := h.Sum(nil)
+	h1 := binary.BigEndian.Uint64(sum[:8])
+	h2 := binary.BigEndian.Uint64(sum[8:])
+	offsets := make([]uint64, b.hashes)
+	for i := range offsets {
+		offsets[i] = (h1 + uint64(i)*h2) % b.bits
+	}
+	return offsets
+}
+
+// 根据容量 n 和误判率 p 计算位数 m = -n*ln(p)/ln(2)^2 和哈希函数个数 k = m/n*ln(2)
+func bloomSize(capacity int64, errorRate float64) (bits uint64, hashes int) {
+	n := float64(capacity)
+	if n < 1 {
+		n = 1
+	}
+	m := math.Ceil(-n * math.Log(errorRate) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return uint64(m), k
+}
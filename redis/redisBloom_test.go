@@ -0,0 +1,145 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis布隆过滤器
+package redis
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestBloomSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		capacity   int64
+		errorRate  float64
+		wantBits   uint64
+		wantHashes int
+	}{
+		{
+			name:       "1%",
+			capacity:   1000000,
+			errorRate:  0.01,
+			wantBits:   9585059,
+			wantHashes: 7,
+		}, {
+			name:       "0.1%",
+			capacity:   1000,
+			errorRate:  0.001,
+			wantBits:   14378,
+			wantHashes: 10,
+		}, {
+			name:       "zero capacity",
+			capacity:   0,
+			errorRate:  0.5,
+			wantBits:   2,
+			wantHashes: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bits, hashes := bloomSize(tt.capacity, tt.errorRate)
+			if bits != tt.wantBits || hashes != tt.wantHashes {
+				t.Errorf("bloomSize() = %v, %v, want %v, %v", bits, hashes, tt.wantBits, tt.wantHashes)
+			}
+		})
+	}
+}
+
+func TestNewBloomFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *BloomFilterConfig
+		wantErr bool
+	}{
+		{
+			name:   "all",
+			config: &BloomFilterConfig{Key: "bloom", Capacity: 1000, ErrorRate: 0.01},
+		}, {
+			name:   "default",
+			config: &BloomFilterConfig{Key: "bloom"},
+		}, {
+			name:    "config nil",
+			wantErr: true,
+		}, {
+			name:    "key nil",
+			config:  &BloomFilterConfig{},
+			wantErr: true,
+		}, {
+			name:    "error rate",
+			config:  &BloomFilterConfig{Key: "bloom", ErrorRate: 1},
+			wantErr: true,
+		}, {
+			name:    "too large",
+			config:  &BloomFilterConfig{Key: "bloom", Capacity: 1 << 40},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := redisTool.NewBloomFilter(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewBloomFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	requireRedisServer(t)
+	b, err := redisTool.NewBloomFilter(&BloomFilterConfig{Key: "bloom", Capacity: 1000, ErrorRate: 0.01})
+	if err != nil {
+		t.Fatalf("NewBloomFilter() error = %v", err)
+	}
+	b.Clear()
+	defer b.Clear()
+
+	if added, err := b.Add("13800000000"); err != nil || !added {
+		t.Fatalf("Add() = %v, %v, want true, nil", added, err)
+	}
+	if added, err := b.Add("13800000000"); err != nil || added {
+		t.Errorf("Add() again = %v, %v, want false, nil", added, err)
+	}
+	added, err := b.AddMulti("13800000001", "13800000002", "13800000001")
+	if want := []bool{true, true, false}; err != nil || !reflect.DeepEqual(added, want) {
+		t.Errorf("AddMulti() = %v, %v, want %v, nil", added, err, want)
+	}
+	exists, err := b.ExistsMulti("13800000000", "13800000002", "13900000000")
+	if want := []bool{true, true, false}; err != nil || !reflect.DeepEqual(exists, want) {
+		t.Errorf("ExistsMulti() = %v, %v, want %v, nil", exists, err, want)
+	}
+	if _, err := b.ExistsMulti(); err == nil {
+		t.Errorf("ExistsMulti() error = nil, want error")
+	}
+
+	// 填满容量后误判率应接近配置值
+	items := make([]string, 1000)
+	for i := range items {
+		items[i] = fmt.Sprint("item:", i)
+	}
+	if _, err := b.AddMulti(items...); err != nil {
+		t.Fatalf("AddMulti() error = %v", err)
+	}
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		if ok, _ := b.Exists(fmt.Sprint("other:", i)); ok {
+			falsePositives++
+		}
+	}
+	if falsePositives > 30 {
+		t.Errorf("false positives = %d/1000, want about 10", falsePositives)
+	}
+}
@@ -0,0 +1,722 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis集群模式
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// 集群 slot 数量
+	clusterSlots = 16384
+	// 单条命令最多跟随的重定向次数
+	clusterMaxRedirects = 16
+	// 集群不可用或迁移中时的重试间隔
+	clusterRetryDelay = 100 * time.Millisecond
+)
+
+var errClusterNoReply = errors.New("redis cluster: no pending replies")
+
+// 不包含 key 的命令，可以发送到任意节点
+var clusterKeylessCommands = map[string]bool{
+	"ping": true, "echo": true, "auth": true, "select": true, "role": true, "info": true,
+	"time": true, "script": true, "cluster": true, "asking": true, "readonly": true,
+	"multi": true, "exec": true, "discard": true, "unwatch": true, "dbsize": true,
+	"randomkey": true, "flushdb": true, "flushall": true, "scan": true, "keys": true,
+	"config": true, "client": true, "hello": true, "quit": true, "command": true, "slowlog": true,
+	"lastsave": true, "wait": true, "acl": true,
+}
+
+// 集群，按 key 的 slot 将命令路由到对应的主节点
+type cluster struct {
+	redisConfig *RedisConfig
+	dialer      *dialer
+	mu          sync.RWMutex
+	slots       [clusterSlots]string
+	pools       map[string]*redis.Pool
+	addresses   []string
+	refreshing  int32
+}
+
+func newCluster(redisConfig *RedisConfig, d *dialer) (*cluster, error) {
+	addresses := redisConfig.ClusterAddresses
+	if len(addresses) == 0 && redisConfig.Address != "" {
+		addresses = []string{redisConfig.Address}
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("redis 集群模式 clusterAddresses 不能为空")
+	}
+	// 集群只有 0 号数据库，SELECT 其他数据库会失败
+	if redisConfig.DB != 0 {
+		return nil, fmt.Errorf("redis 集群模式 db 只能为 0")
+	}
+	c := &cluster{
+		redisConfig: redisConfig,
+		dialer:      d,
+		pools:       make(map[string]*redis.Pool),
+		addresses:   append([]string(nil), addresses...),
+	}
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// 连接池创建的是路由连接，真正的节点连接从各节点的连接池中获取
+func (c *cluster) dial() (redis.Conn, error) {
+	return &clusterConn{cluster: c}, nil
+}
+
+// 建立到任意节点的独立连接，不经过连接池
+// 发布订阅的接收协程与 Ping/Close 会并发使用连接，路由连接和连接池的连接都不支持，
+// 集群中的消息会广播到所有节点，因此订阅任意节点即可
+func (c *cluster) dialNode() (redis.Conn, error) {
+	return c.dialer.dial(c.anyAddress())
+}
+
+// 获取节点的连接池，不存在时创建
+func (c *cluster) pool(address string) *redis.Pool {
+	c.mu.RLock()
+	p := c.pools[address]
+	c.mu.RUnlock()
+	if p != nil {
+		return p
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p = c.pools[address]; p == nil {
+		p = newPool(c.redisConfig, func() (redis.Conn, error) {
+			return c.dialer.dial(address)
+		})
+		c.pools[address] = p
+	}
+	return p
+}
+
+// 通过 CLUSTER SLOTS 刷新 slot 与节点的对应关系
+func (c *cluster) refresh() error {
+	c.mu.RLock()
+	addresses := append([]string(nil), c.addresses...)
+	c.mu.RUnlock()
+
+	var lastErr error
+	for _, address := range addresses {
+		slots, nodes, err := c.querySlots(address)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		c.mu.Lock()
+		c.slots = slots
+		for _, node := range nodes {
+			if !containsString(c.addresses, node) {
+				c.addresses = append(c.addresses, node)
+			}
+		}
+		c.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("redis 集群获取 slot 信息失败: %v", lastErr)
+}
+
+// 在后台刷新 slot，同时只有一个刷新在执行
+func (c *cluster) refreshAsync() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		c.refresh()
+	}()
+}
+
+// CLUSTER SLOTS 返回 [[start, end, [host, port, ...], replicas...], ...]
+func (c *cluster) querySlots(address string) (slots [clusterSlots]string, nodes []string, err error) {
+	conn := c.pool(address).Get()
+	defer conn.Close()
+	ranges, err := redis.Values(conn.Do("cluster", "slots"))
+	if err != nil {
+		return slots, nil, err
+	}
+	for _, r := range ranges {
+		info, err := redis.Values(r, nil)
+		if err != nil || len(info) < 3 {
+			return slots, nil, fmt.Errorf("redis cluster slots 返回值格式错误: %v", err)
+		}
+		start, err := redis.Int(info[0], nil)
+		if err != nil {
+			return slots, nil, err
+		}
+		end, err := redis.Int(info[1], nil)
+		if err != nil {
+			return slots, nil, err
+		}
+		node, err := redis.Values(info[2], nil)
+		if err != nil || len(node) < 2 {
+			return slots, nil, fmt.Errorf("redis cluster slots 节点格式错误: %v", err)
+		}
+		host, err := redis.String(node[0], nil)
+		if err != nil {
+			return slots, nil, err
+		}
+		port, err := redis.Int(node[1], nil)
+		if err != nil {
+			return slots, nil, err
+		}
+		// 节点未配置 cluster-announce-ip 时可能返回空地址，使用当前连接的地址
+		if host == "" {
+			host, _, _ = net.SplitHostPort(address)
+		}
+		master := net.JoinHostPort(host, strconv.Itoa(port))
+		for slot := start; slot <= end && slot < clusterSlots; slot++ {
+			slots[slot] = master
+		}
+		if !containsString(nodes, master) {
+			nodes = append(nodes, master)
+		}
+	}
+	return slots, nodes, nil
+}
+
+// 获取 slot 所在节点的地址，未知时返回任意节点
+func (c *cluster) slotAddress(slot int) string {
+	c.mu.RLock()
+	address := c.slots[slot]
+	c.mu.RUnlock()
+	if address == "" {
+		return c.anyAddress()
+	}
+	return address
+}
+
+// 获取所有已创建的节点连接池
+func (c *cluster) allPools() []*redis.Pool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	pools := make([]*redis.Pool, 0, len(c.pools))
+	for _, p := range c.pools {
+		pools = append(pools, p)
+	}
+	return pools
+}
+
+// 获取所有主节点地址
+func (c *cluster) masters() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var masters []string
+	for _, address := range c.slots {
+		if address != "" && !containsString(masters, address) {
+			masters = append(masters, address)
+		}
+	}
+	return masters
+}
+
+func (c *cluster) anyAddress() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.addresses[rand.Intn(len(c.addresses))]
+}
+
+// 获取命令应发送到的节点地址
+func (c *cluster) commandAddress(commandName string, args []interface{}) string {
+	if key, ok := commandKey(commandName, args); ok {
+		return c.slotAddress(hashSlot(key))
+	}
+	return c.anyAddress()
+}
+
+// 执行命令并处理 MOVED/ASK 重定向，timeout 为 0 时使用连接默认的读超时
+func (c *cluster) do(timeout time.Duration, commandName string, args []interface{}) (interface{}, error) {
+	if groups := slotGroups(commandName, args); len(groups) > 1 {
+		return c.doSplit(timeout, strings.ToLower(commandName), args, groups)
+	}
+	address := c.commandAddress(commandName, args)
+	asking := false
+	var lastErr error
+	for i := 0; i < clusterMaxRedirects; i++ {
+		reply, err := c.doOn(address, asking, timeout, commandName, args)
+		asking = false
+		if err == nil {
+			return reply, nil
+		}
+		e, ok := err.(redis.Error)
+		if !ok {
+			// 连接错误不重试，避免非幂等命令重复执行
+			c.refreshAsync()
+			return reply, err
+		}
+		msg := string(e)
+		switch {
+		case strings.HasPrefix(msg, "MOVED "):
+			slot, target, perr := parseRedirect(msg)
+			if perr != nil {
+				return nil, perr
+			}
+			c.mu.Lock()
+			c.slots[slot] = target
+			c.mu.Unlock()
+			c.refreshAsync()
+			address = target
+		case strings.HasPrefix(msg, "ASK "):
+			_, target, perr := parseRedirect(msg)
+			if perr != nil {
+				return nil, perr
+			}
+			address = target
+			asking = true
+		case strings.HasPrefix(msg, "TRYAGAIN"), strings.HasPrefix(msg, "CLUSTERDOWN"):
+			time.Sleep(clusterRetryDelay)
+		default:
+			return reply, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// 可按 slot 拆分执行的多 key 命令及每个 key 占用的参数个数
+var clusterMultiKeyCommands = map[string]int{
+	"mget": 1, "mset": 2, "del": 1, "unlink": 1, "exists": 1, "touch": 1, "pfcount": 1,
+}
+
+// 将多 key 命令的参数按 slot 分组，每组为参数下标，组的顺序为 slot 首次出现的顺序；
+// 不可拆分的命令返回 nil
+func slotGroups(commandName string, args []interface{}) [][]int {
+	step, ok := clusterMultiKeyCommands[strings.ToLower(commandName)]
+	if !ok || len(args) <= step || len(args)%step != 0 {
+		return nil
+	}
+	var groups [][]int
+	index := make(map[int]int)
+	for i := 0; i < len(args); i += step {
+		slot := hashSlot(argString(args[i]))
+		g, ok := index[slot]
+		if !ok {
+			g = len(groups)
+			index[slot] = g
+			groups = append(groups, nil)
+		}
+		for j := i; j < i+step; j++ {
+			groups[g] = append(groups[g], j)
+		}
+	}
+	return groups
+}
+
+// 按 slot 拆分执行多 key 命令并合并结果，拆分后各 slot 分别执行，整体不再是原子操作
+func (c *cluster) doSplit(timeout time.Duration, commandName string, args []interface{},
+	groups [][]int) (interface{}, error) {
+	if commandName == "pfcount" {
+		return c.pfCount(timeout, args)
+	}
+	values := make([]interface{}, len(args))
+	var count int64
+	for _, group := range groups {
+		groupArgs := make([]interface{}, len(group))
+		for i, index := range group {
+			groupArgs[i] = args[index]
+		}
+		reply, err := c.do(timeout, commandName, groupArgs)
+		if err != nil {
+			return nil, err
+		}
+		switch commandName {
+		case "mget":
+			groupValues, err := redis.Values(reply, nil)
+			if err != nil {
+				return nil, err
+			}
+			if len(groupValues) != len(group) {
+				return nil, fmt.Errorf("redis 集群 mget 返回值数量错误: %d", len(groupValues))
+			}
+			for i, index := range group {
+				values[index] = groupValues[i]
+			}
+		case "mset":
+		default:
+			n, err := redis.Int64(reply, nil)
+			if err != nil {
+				return nil, err
+			}
+			count += n
+		}
+	}
+	switch commandName {
+	case "mget":
+		return values, nil
+	case "mset":
+		return "OK", nil
+	}
+	return count, nil
+}
+
+// 临时 key 的过期时间（毫秒），清理失败时由 redis 自动删除
+const clusterPFCountTTL = 60000
+
+// 跨 slot 的 PFCOUNT 计算的是并集基数，不能按 slot 求和：
+// 将各 key 通过 DUMP/RESTORE 复制到同一 hashtag 下的临时 key 后再统计
+func (c *cluster) pfCount(timeout time.Duration, keys []interface{}) (interface{}, error) {
+	tag := fmt.Sprintf("{pfcount:%d}", rand.Int63())
+	var temps []interface{}
+	defer func() {
+		if len(temps) > 0 {
+			c.do(timeout, "del", temps)
+		}
+	}()
+	for i, key := range keys {
+		dump, err := c.do(timeout, "dump", []interface{}{key})
+		if err != nil {
+			return nil, err
+		}
+		if dump == nil {
+			continue
+		}
+		temp := fmt.Sprintf("%s:%d", tag, i)
+		if _, err := c.do(timeout, "restore", []interface{}{temp, clusterPFCountTTL, dump}); err != nil {
+			return nil, err
+		}
+		temps = append(temps, temp)
+	}
+	if len(temps) == 0 {
+		return int64(0), nil
+	}
+	return c.do(timeout, "pfcount", temps)
+}
+
+func (c *cluster) doOn(address string, asking bool, timeout time.Duration,
+	commandName string, args []interface{}) (interface{}, error) {
+	conn := c.pool(address).Get()
+	defer conn.Close()
+	if asking {
+		if _, err := conn.Do("asking"); err != nil {
+			return nil, err
+		}
+	}
+	if timeout > 0 {
+		return redis.DoWithTimeout(conn, timeout, commandName, args...)
+	}
+	return conn.Do(commandName, args...)
+}
+
+// 解析 "MOVED 3999 127.0.0.1:6381" 或 "ASK 3999 127.0.0.1:6381"
+func parseRedirect(msg string) (int, string, error) {
+	fields := strings.Fields(msg)
+	if len(fields) != 3 {
+		return 0, "", fmt.Errorf("redis 集群重定向格式错误: %s", msg)
+	}
+	slot, err := strconv.Atoi(fields[1])
+	if err != nil || slot < 0 || slot >= clusterSlots {
+		return 0, "", fmt.Errorf("redis 集群重定向格式错误: %s", msg)
+	}
+	return slot, fields[2], nil
+}
+
+// 路由连接，实现 redis.Conn，使 Redis 的方法在集群模式下同样可用
+// 普通命令按 key 路由；WATCH/MULTI/SUBSCRIBE 期间绑定到一个节点连接上，
+// 因此事务中的 key 必须位于同一个 slot（可使用 {hashtag}）
+type clusterConn struct {
+	cluster *cluster
+	// 事务或订阅期间绑定的节点连接
+	bound redis.Conn
+	// 已发送 MULTI，等待第一条带 key 的命令确定节点
+	pendingMulti bool
+	// Send 排队尚未执行的命令
+	pending []clusterCommand
+	// 已执行等待 Receive 的返回值
+	replies []clusterReply
+	err     error
+}
+
+type clusterCommand struct {
+	commandName string
+	args        []interface{}
+}
+
+type clusterReply struct {
+	reply interface{}
+	err   error
+}
+
+func (cc *clusterConn) Close() error {
+	cc.release()
+	cc.pending = nil
+	cc.replies = nil
+	if cc.err == nil {
+		cc.err = errors.New("redis cluster: connection closed")
+	}
+	return nil
+}
+
+func (cc *clusterConn) Err() error {
+	return cc.err
+}
+
+func (cc *clusterConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return cc.DoWithTimeout(0, commandName, args...)
+}
+
+func (cc *clusterConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	if cc.err != nil {
+		return nil, cc.err
+	}
+	name := strings.ToLower(commandName)
+	// 空命令表示读取所有未返回的结果，连接池归还连接时也会调用，此时解除绑定
+	if name == "" {
+		reply, err := cc.drain(timeout)
+		cc.release()
+		return reply, err
+	}
+	cc.execPending()
+	cc.replies = nil
+
+	if cc.bound == nil && (name == "watch" || isSubscribeCommand(name)) {
+		if err := cc.bind(commandName, args); err != nil {
+			return nil, err
+		}
+	}
+	if cc.bound == nil && cc.pendingMulti {
+		if err := cc.bindMulti(commandName, args); err != nil {
+			return nil, err
+		}
+	}
+	if cc.bound == nil {
+		return cc.cluster.do(timeout, commandName, args)
+	}
+	reply, err := doWithTimeout(cc.bound, timeout, commandName, args)
+	// 事务结束后解除绑定
+	if name == "exec" || name == "discard" || name == "unwatch" {
+		cc.release()
+	}
+	return reply, err
+}
+
+func (cc *clusterConn) Send(commandName string, args ...interface{}) error {
+	if cc.err != nil {
+		return cc.err
+	}
+	name := strings.ToLower(commandName)
+	if cc.bound == nil {
+		switch {
+		case name == "multi":
+			cc.pendingMulti = true
+			return nil
+		case name == "watch" || isSubscribeCommand(name):
+			cc.execPending()
+			if err := cc.bind(commandName, args); err != nil {
+				return err
+			}
+		case cc.pendingMulti:
+			if err := cc.bindMulti(commandName, args); err != nil {
+				return err
+			}
+		default:
+			cc.pending = append(cc.pending, clusterCommand{commandName: commandName, args: args})
+			return nil
+		}
+	}
+	return cc.bound.Send(commandName, args...)
+}
+
+func (cc *clusterConn) Flush() error {
+	if cc.err != nil {
+		return cc.err
+	}
+	cc.execPending()
+	if cc.bound != nil {
+		return cc.bound.Flush()
+	}
+	return nil
+}
+
+func (cc *clusterConn) Receive() (interface{}, error) {
+	return cc.ReceiveWithTimeout(0)
+}
+
+func (cc *clusterConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	if cc.err != nil {
+		return nil, cc.err
+	}
+	cc.execPending()
+	if len(cc.replies) > 0 {
+		r := cc.replies[0]
+		cc.replies = cc.replies[1:]
+		return r.reply, r.err
+	}
+	if cc.bound == nil {
+		return nil, errClusterNoReply
+	}
+	if timeout > 0 {
+		return redis.ReceiveWithTimeout(cc.bound, timeout)
+	}
+	return cc.bound.Receive()
+}
+
+// 逐条执行排队的命令，结果留给 Receive 读取
+func (cc *clusterConn) execPending() {
+	for _, cmd := range cc.pending {
+		reply, err := cc.cluster.do(0, cmd.commandName, cmd.args)
+		cc.replies = append(cc.replies, clusterReply{reply: reply, err: err})
+	}
+	cc.pending = nil
+}
+
+// 读取所有未返回的结果，返回最后一个
+func (cc *clusterConn) drain(timeout time.Duration) (interface{}, error) {
+	cc.execPending()
+	var reply interface{}
+	var err error
+	for _, r := range cc.replies {
+		reply, err = r.reply, r.err
+	}
+	cc.replies = nil
+	if cc.bound != nil {
+		reply, err = doWithTimeout(cc.bound, timeout, "", nil)
+	}
+	return reply, err
+}
+
+// 绑定到命令对应的节点连接
+func (cc *clusterConn) bind(commandName string, args []interface{}) error {
+	conn := cc.cluster.pool(cc.cluster.commandAddress(commandName, args)).Get()
+	if err := conn.Err(); err != nil {
+		conn.Close()
+		return err
+	}
+	cc.bound = conn
+	return nil
+}
+
+// 根据 MULTI 之后的第一条命令绑定节点，并补发 MULTI
+func (cc *clusterConn) bindMulti(commandName string, args []interface{}) error {
+	if err := cc.bind(commandName, args); err != nil {
+		return err
+	}
+	cc.pendingMulti = false
+	return cc.bound.Send("multi")
+}
+
+// 解除绑定，节点连接归还时由节点连接池清理事务和订阅状态
+func (cc *clusterConn) release() {
+	if cc.bound != nil {
+		cc.bound.Close()
+		cc.bound = nil
+	}
+	cc.pendingMulti = false
+}
+
+func doWithTimeout(conn redis.Conn, timeout time.Duration, commandName string, args []interface{}) (interface{}, error) {
+	if timeout > 0 {
+		return redis.DoWithTimeout(conn, timeout, commandName, args...)
+	}
+	return conn.Do(commandName, args...)
+}
+
+func isSubscribeCommand(name string) bool {
+	return name == "subscribe" || name == "psubscribe"
+}
+
+// 获取命令中用于路由的 key
+func commandKey(commandName string, args []interface{}) (string, bool) {
+	name := strings.ToLower(commandName)
+	if clusterKeylessCommands[name] {
+		return "", false
+	}
+	switch name {
+	case "eval", "evalsha":
+		// EVAL script numkeys key [key ...] arg [arg ...]
+		if len(args) < 3 {
+			return "", false
+		}
+		if n, err := strconv.Atoi(argString(args[1])); err != nil || n <= 0 {
+			return "", false
+		}
+		return argString(args[2]), true
+	case "xread", "xreadgroup":
+		for i, arg := range args {
+			if strings.EqualFold(argString(arg), "streams") && i+1 < len(args) {
+				return argString(args[i+1]), true
+			}
+		}
+		return "", false
+	case "xgroup", "xinfo", "object":
+		if len(args) < 2 {
+			return "", false
+		}
+		return argString(args[1]), true
+	}
+	if len(args) == 0 {
+		return "", false
+	}
+	return argString(args[0]), true
+}
+
+func argString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// 计算 key 所在的 slot，key 中包含 {hashtag} 时只计算 hashtag 部分
+func hashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % clusterSlots
+}
+
+// CRC16 XMODEM
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
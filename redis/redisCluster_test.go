@@ -0,0 +1,777 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis集群模式
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestCrc16(t *testing.T) {
+	if got := crc16("123456789"); got != 0x31c3 {
+		t.Errorf("crc16() = %x, want 31c3", got)
+	}
+}
+
+func TestHashSlot(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{
+			name: "all",
+			key:  "foo",
+			want: 12182,
+		}, {
+			name: "hashtag",
+			key:  "{user1000}.following",
+			want: hashSlot("user1000"),
+		}, {
+			name: "empty hashtag",
+			key:  "foo{}{bar}",
+			want: int(crc16("foo{}{bar}")) % clusterSlots,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hashSlot(tt.key); got != tt.want {
+				t.Errorf("hashSlot() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		commandName string
+		args        []interface{}
+		wantKey     string
+		wantOk      bool
+	}{
+		{
+			name:        "all",
+			commandName: "GET",
+			args:        []interface{}{"name"},
+			wantKey:     "name",
+			wantOk:      true,
+		}, {
+			name:        "keyless",
+			commandName: "ping",
+			wantOk:      false,
+		}, {
+			name:        "evalsha",
+			commandName: "evalsha",
+			args:        []interface{}{"sha", 1, []byte("lock"), "token"},
+			wantKey:     "lock",
+			wantOk:      true,
+		}, {
+			name:        "eval no keys",
+			commandName: "eval",
+			args:        []interface{}{"return 1", 0},
+			wantOk:      false,
+		}, {
+			name:        "xreadgroup",
+			commandName: "xreadgroup",
+			args:        []interface{}{"group", "g", "c", "count", 10, "streams", "jobs", ">"},
+			wantKey:     "jobs",
+			wantOk:      true,
+		}, {
+			name:        "xgroup",
+			commandName: "xgroup",
+			args:        []interface{}{"create", "jobs", "g", "0"},
+			wantKey:     "jobs",
+			wantOk:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotKey, gotOk := commandKey(tt.commandName, tt.args)
+			if gotKey != tt.wantKey || gotOk != tt.wantOk {
+				t.Errorf("commandKey() = %v, %v, want %v, %v", gotKey, gotOk, tt.wantKey, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestParseRedirect(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         string
+		wantSlot    int
+		wantAddress string
+		wantErr     bool
+	}{
+		{
+			name:        "moved",
+			msg:         "MOVED 3999 127.0.0.1:6381",
+			wantSlot:    3999,
+			wantAddress: "127.0.0.1:6381",
+		}, {
+			name:        "ask",
+			msg:         "ASK 3999 127.0.0.1:6381",
+			wantSlot:    3999,
+			wantAddress: "127.0.0.1:6381",
+		}, {
+			name:    "slot err",
+			msg:     "MOVED 99999 127.0.0.1:6381",
+			wantErr: true,
+		}, {
+			name:    "format err",
+			msg:     "MOVED 3999",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slot, address, err := parseRedirect(tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseRedirect() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if slot != tt.wantSlot || address != tt.wantAddress {
+				t.Errorf("parseRedirect() = %v, %v, want %v, %v", slot, address, tt.wantSlot, tt.wantAddress)
+			}
+		})
+	}
+}
+
+func TestNewRedisCluster(t *testing.T) {
+	fc := newFakeCluster(t, 1)
+	tests := []struct {
+		name    string
+		config  *RedisConfig
+		wantErr bool
+	}{
+		{
+			name:    "addresses nil",
+			config:  &RedisConfig{Mode: CLUSTER},
+			wantErr: true,
+		}, {
+			name: "cluster disabled",
+			config: &RedisConfig{
+				Mode:             CLUSTER,
+				ClusterAddresses: []string{config.Address},
+				Password:         config.Password,
+			},
+			wantErr: true,
+		}, {
+			name:   "all",
+			config: &RedisConfig{Mode: CLUSTER, ClusterAddresses: []string{fc.nodes[0].addr()}},
+		}, {
+			// 集群不支持 SELECT
+			name:    "db not zero",
+			config:  &RedisConfig{Mode: CLUSTER, ClusterAddresses: []string{fc.nodes[0].addr()}, DB: 1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRedis(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRedis() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				r.Close()
+			}
+		})
+	}
+}
+
+func TestClusterRouting(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	r := fc.redis(t)
+	values := map[string]string{"foo": "1", "bar": "2", "{foo}x": "3"}
+	for key, value := range values {
+		if err := r.Set(key, value); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+	for key, value := range values {
+		if got := fc.ownerOf(key).value(key); got != value {
+			t.Errorf("node value of %s = %q, want %q", key, got, value)
+		}
+		if got, err := r.Get(key); err != nil || got != value {
+			t.Errorf("Get(%s) = %q, %v, want %q", key, got, err, value)
+		}
+	}
+}
+
+// 多 key 命令的 key 位于不同 slot 时按 slot 拆分执行
+func TestClusterMultiKey(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	r := fc.redis(t)
+	if hashSlot("foo") == hashSlot("bar") {
+		t.Fatalf("foo and bar should be in different slots")
+	}
+	if err := r.MSet(map[string]string{"foo": "1", "bar": "2", "{foo}x": "3"}); err != nil {
+		t.Fatalf("MSet() error = %v", err)
+	}
+	got, err := r.MGet("bar", "foo", "missing", "{foo}x")
+	if want := []*string{stringPtr("2"), stringPtr("1"), nil, stringPtr("3")}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("MGet() = %v, %v, want %v", got, err, want)
+	}
+	if n, err := r.MDel("foo", "bar", "missing"); err != nil || n != 2 {
+		t.Errorf("MDel() = %d, %v, want 2", n, err)
+	}
+
+	if _, err := r.PFAdd("{foo}hll", "a", "b", "c"); err != nil {
+		t.Fatalf("PFAdd() error = %v", err)
+	}
+	if _, err := r.PFAdd("{bar}hll", "c", "d"); err != nil {
+		t.Fatalf("PFAdd() error = %v", err)
+	}
+	if n, err := r.PFCount("{foo}hll", "{bar}hll", "{baz}hll"); err != nil || n != 4 {
+		t.Errorf("PFCount() = %d, %v, want 4", n, err)
+	}
+	// 临时 key 已清理
+	for _, node := range fc.nodes {
+		for _, key := range node.keys() {
+			if strings.HasPrefix(key, "{pfcount:") {
+				t.Errorf("temporary key %s not deleted", key)
+			}
+		}
+	}
+}
+
+// MOVED 时重试目标节点并更新 slot 表
+func TestClusterMoved(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	r := fc.redis(t)
+	slot := hashSlot("foo")
+	from := fc.owner[slot]
+	to := fc.nodes[0]
+	if from == to {
+		to = fc.nodes[1]
+	}
+	fc.setOwner(slot, to)
+	if err := r.Set("foo", "moved"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got := to.value("foo"); got != "moved" {
+		t.Errorf("target value = %q, want moved", got)
+	}
+	if got := from.value("foo"); got != "" {
+		t.Errorf("source value = %q, want empty", got)
+	}
+	if got := r.cluster.slotAddress(slot); got != to.addr() {
+		t.Errorf("slotAddress() = %s, want %s", got, to.addr())
+	}
+}
+
+// ASK 时带 ASKING 重试目标节点，不更新 slot 表
+func TestClusterAsk(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	r := fc.redis(t)
+	slot := hashSlot("bar")
+	from := fc.owner[slot]
+	to := fc.nodes[0]
+	if from == to {
+		to = fc.nodes[1]
+	}
+	fc.migrate(slot, from, to)
+	to.set("bar", "migrated")
+	if got, err := r.Get("bar"); err != nil || got != "migrated" {
+		t.Errorf("Get() = %q, %v, want migrated", got, err)
+	}
+	if got := r.cluster.slotAddress(slot); got != from.addr() {
+		t.Errorf("slotAddress() = %s, want %s", got, from.addr())
+	}
+	// 不带 ASKING 时目标节点返回 MOVED
+	conn, err := redis.Dial("tcp", to.addr())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Do("get", "bar"); err == nil || !strings.HasPrefix(err.Error(), "MOVED ") {
+		t.Errorf("Do() error = %v, want MOVED", err)
+	}
+}
+
+// 路由连接的 Send/Receive 按 key 分别路由
+func TestClusterConnPipeline(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	r := fc.redis(t)
+	conn := r.RedisPool.Get()
+	defer conn.Close()
+	keys := []string{"foo", "bar", "baz", "qux"}
+	for i, key := range keys {
+		if err := conn.Send("set", key, strconv.Itoa(i)); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		if err := conn.Send("get", key); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	for i, key := range keys {
+		if _, err := conn.Receive(); err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		got, err := redis.String(conn.Receive())
+		if err != nil || got != strconv.Itoa(i) {
+			t.Errorf("Receive() = %q, %v, want %d", got, err, i)
+		}
+		if v := fc.ownerOf(key).value(key); v != strconv.Itoa(i) {
+			t.Errorf("node value of %s = %q, want %d", key, v, i)
+		}
+	}
+}
+
+// 脚本加载到每个主节点
+func TestClusterLoadScripts(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	r := fc.redis(t)
+	if err := r.LoadScripts(); err != nil {
+		t.Fatalf("LoadScripts() error = %v", err)
+	}
+	scriptRegistry.Lock()
+	scripts := scriptRegistry.scripts
+	scriptRegistry.Unlock()
+	for i, node := range fc.nodes {
+		fc.mu.Lock()
+		for _, s := range scripts {
+			if !node.scripts[s.Hash()] {
+				t.Errorf("node %d missing script %s", i, s.Hash())
+			}
+		}
+		fc.mu.Unlock()
+	}
+}
+
+// 集群模式下的订阅使用独立的节点连接，接收消息的同时可以 Ping 和关闭
+func TestClusterSubscribe(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	r := fc.redis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := r.SubscribeChan(ctx, "cluster:news")
+	if err != nil {
+		t.Fatalf("SubscribeChan() error = %v", err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		n, err := r.Publish("cluster:news", "hello")
+		if err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Publish() no subscribers")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case msg := <-ch:
+		if msg.Channel != "cluster:news" || string(msg.Data) != "hello" {
+			t.Errorf("SubscribeChan() message = %+v", msg)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("SubscribeChan() no message received")
+	}
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Errorf("SubscribeChan() not stopped after cancel")
+	}
+}
+
+// 模拟的 redis 集群，slot 平均分配给各节点，只支持测试用到的命令
+type fakeCluster struct {
+	mu    sync.Mutex
+	nodes []*fakeClusterNode
+	owner [clusterSlots]*fakeClusterNode
+	// 所有节点上订阅了频道的连接
+	subscribers map[*fakeClusterConn]bool
+}
+
+type fakeClusterNode struct {
+	cluster  *fakeCluster
+	listener net.Listener
+	// 字符串为 string，HyperLogLog 为元素集合
+	data map[string]interface{}
+	// 迁移出的 slot 及目标节点
+	migrating map[int]*fakeClusterNode
+	// 迁入中的 slot
+	importing map[int]bool
+	// SCRIPT LOAD 加载的脚本 sha1
+	scripts map[string]bool
+}
+
+type fakeStatus string
+
+type fakeError string
+
+func newFakeCluster(t *testing.T, n int) *fakeCluster {
+	fc := &fakeCluster{subscribers: make(map[*fakeClusterConn]bool)}
+	for i := 0; i < n; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen() error = %v", err)
+		}
+		node := &fakeClusterNode{cluster: fc, listener: listener, data: make(map[string]interface{}),
+			migrating: make(map[int]*fakeClusterNode), importing: make(map[int]bool),
+			scripts: make(map[string]bool)}
+		fc.nodes = append(fc.nodes, node)
+		go node.serve()
+	}
+	for slot := range fc.owner {
+		fc.owner[slot] = fc.nodes[slot*n/clusterSlots]
+	}
+	t.Cleanup(func() {
+		for _, node := range fc.nodes {
+			node.listener.Close()
+		}
+	})
+	return fc
+}
+
+func (fc *fakeCluster) redis(t *testing.T) *Redis {
+	r, err := NewRedis(&RedisConfig{Mode: CLUSTER, ClusterAddresses: []string{fc.nodes[0].addr()},
+		MaxIdle: 4, MaxActive: 8})
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func (fc *fakeCluster) ownerOf(key string) *fakeClusterNode {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.owner[hashSlot(key)]
+}
+
+func (fc *fakeCluster) setOwner(slot int, node *fakeClusterNode) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.owner[slot] = node
+}
+
+func (fc *fakeCluster) migrate(slot int, from, to *fakeClusterNode) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	from.migrating[slot] = to
+	to.importing[slot] = true
+}
+
+func (n *fakeClusterNode) addr() string {
+	return n.listener.Addr().String()
+}
+
+func (n *fakeClusterNode) value(key string) string {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	v, _ := n.data[key].(string)
+	return v
+}
+
+func (n *fakeClusterNode) set(key, value string) {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	n.data[key] = value
+}
+
+func (n *fakeClusterNode) keys() []string {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	var keys []string
+	for key := range n.data {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (n *fakeClusterNode) serve() {
+	for {
+		netConn, err := n.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer netConn.Close()
+			conn := redis.NewConn(netConn, 0, 0)
+			c := &fakeClusterConn{w: bufio.NewWriter(netConn)}
+			defer n.unsubscribe(c)
+			for {
+				values, err := redis.Strings(conn.Receive())
+				if err != nil || len(values) == 0 {
+					return
+				}
+				if err := c.write(n.handle(c, values)); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// 模拟节点上的一个客户端连接，发布的消息由其他连接的协程写入，写入需要加锁
+type fakeClusterConn struct {
+	mu       sync.Mutex
+	w        *bufio.Writer
+	asking   bool
+	channels map[string]bool
+}
+
+// 多个返回值依次写入，用于 SUBSCRIBE
+type fakeReplies []interface{}
+
+func (c *fakeClusterConn) write(reply interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if replies, ok := reply.(fakeReplies); ok {
+		for _, r := range replies {
+			writeFakeReply(c.w, r)
+		}
+	} else {
+		writeFakeReply(c.w, reply)
+	}
+	return c.w.Flush()
+}
+
+func (n *fakeClusterNode) unsubscribe(c *fakeClusterConn) {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	delete(n.cluster.subscribers, c)
+}
+
+func (n *fakeClusterNode) handle(c *fakeClusterConn, command []string) interface{} {
+	fc := n.cluster
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	name, args := strings.ToLower(command[0]), command[1:]
+	switch name {
+	case "ping":
+		if len(c.channels) > 0 {
+			return []interface{}{"pong", ""}
+		}
+		return fakeStatus("PONG")
+	case "asking":
+		c.asking = true
+		return fakeStatus("OK")
+	case "cluster":
+		return fc.slotsReply()
+	case "subscribe":
+		if c.channels == nil {
+			c.channels = make(map[string]bool)
+		}
+		var replies fakeReplies
+		for _, channel := range args {
+			c.channels[channel] = true
+			replies = append(replies, []interface{}{"subscribe", channel, int64(len(c.channels))})
+		}
+		fc.subscribers[c] = true
+		return replies
+	case "script":
+		// SCRIPT LOAD，只记录加载的脚本
+		if len(args) < 2 || strings.ToLower(args[0]) != "load" {
+			return fakeError("ERR unknown script subcommand")
+		}
+		sum := sha1.Sum([]byte(args[1]))
+		n.scripts[hex.EncodeToString(sum[:])] = true
+		return hex.EncodeToString(sum[:])
+	case "publish":
+		// 集群中的消息广播到所有节点的订阅者
+		var count int64
+		for sub := range fc.subscribers {
+			if sub.channels[args[0]] {
+				count++
+				go sub.write([]interface{}{"message", args[0], args[1]})
+			}
+		}
+		return count
+	}
+	wasAsking := c.asking
+	c.asking = false
+	keys := fakeCommandKeys(name, args)
+	if len(keys) > 0 {
+		slot := hashSlot(keys[0])
+		for _, key := range keys[1:] {
+			if hashSlot(key) != slot {
+				return fakeError("CROSSSLOT Keys in request don't hash to the same slot")
+			}
+		}
+		if fc.owner[slot] != n {
+			if !wasAsking || !n.importing[slot] {
+				return fakeError(fmt.Sprintf("MOVED %d %s", slot, fc.owner[slot].addr()))
+			}
+		} else if target := n.migrating[slot]; target != nil {
+			for _, key := range keys {
+				if _, ok := n.data[key]; !ok {
+					return fakeError(fmt.Sprintf("ASK %d %s", slot, target.addr()))
+				}
+			}
+		}
+	}
+	return n.exec(name, args)
+}
+
+func fakeCommandKeys(name string, args []string) []string {
+	switch name {
+	case "mset":
+		var keys []string
+		for i := 0; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+		return keys
+	case "mget", "del", "unlink", "exists", "pfcount":
+		return args
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args[:1]
+}
+
+func (n *fakeClusterNode) exec(name string, args []string) interface{} {
+	switch name {
+	case "get":
+		if v, ok := n.data[args[0]].(string); ok {
+			return v
+		}
+		return nil
+	case "set":
+		n.data[args[0]] = args[1]
+		return fakeStatus("OK")
+	case "mget":
+		values := make([]interface{}, len(args))
+		for i, key := range args {
+			if v, ok := n.data[key].(string); ok {
+				values[i] = v
+			}
+		}
+		return values
+	case "mset":
+		for i := 0; i+1 < len(args); i += 2 {
+			n.data[args[i]] = args[i+1]
+		}
+		return fakeStatus("OK")
+	case "del", "unlink", "exists":
+		var count int64
+		for _, key := range args {
+			if _, ok := n.data[key]; ok {
+				count++
+				if name != "exists" {
+					delete(n.data, key)
+				}
+			}
+		}
+		return count
+	case "pfadd":
+		set, _ := n.data[args[0]].(map[string]bool)
+		if set == nil {
+			set = make(map[string]bool)
+			n.data[args[0]] = set
+		}
+		var changed int64
+		for _, element := range args[1:] {
+			if !set[element] {
+				set[element] = true
+				changed = 1
+			}
+		}
+		return changed
+	case "pfcount":
+		union := make(map[string]bool)
+		for _, key := range args {
+			set, _ := n.data[key].(map[string]bool)
+			for element := range set {
+				union[element] = true
+			}
+		}
+		return int64(len(union))
+	case "dump":
+		set, ok := n.data[args[0]].(map[string]bool)
+		if !ok {
+			return nil
+		}
+		var elements []string
+		for element := range set {
+			elements = append(elements, element)
+		}
+		sort.Strings(elements)
+		return strings.Join(elements, "\x00")
+	case "restore":
+		set := make(map[string]bool)
+		for _, element := range strings.Split(args[2], "\x00") {
+			set[element] = true
+		}
+		n.data[args[0]] = set
+		return fakeStatus("OK")
+	}
+	return fakeError("ERR unknown command '" + name + "'")
+}
+
+// CLUSTER SLOTS 的返回值，连续的 slot 区间合并为一项
+func (fc *fakeCluster) slotsReply() []interface{} {
+	var ranges []interface{}
+	start := 0
+	for slot := 1; slot <= clusterSlots; slot++ {
+		if slot < clusterSlots && fc.owner[slot] == fc.owner[start] {
+			continue
+		}
+		host, port, _ := net.SplitHostPort(fc.owner[start].addr())
+		p, _ := strconv.ParseInt(port, 10, 64)
+		ranges = append(ranges, []interface{}{int64(start), int64(slot - 1), []interface{}{host, p}})
+		start = slot
+	}
+	return ranges
+}
+
+func writeFakeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case fakeStatus:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case fakeError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeFakeReply(w, item)
+		}
+	}
+}
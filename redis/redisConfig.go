@@ -19,6 +19,15 @@ import (
 	"github.com/liuchonglin/go-utils"
 )
 
+const (
+	// 单节点模式
+	STANDALONE = "standalone"
+	// 哨兵模式
+	SENTINEL = "sentinel"
+	// 集群模式
+	CLUSTER = "cluster"
+)
+
 var redisConfig *RedisConfig
 // redis 配置
 type RedisConfig struct {
@@ -32,6 +41,66 @@ type RedisConfig struct {
 	IdleTimeout int `json:"idleTimeout" yaml:"idleTimeout"`
 	// 密码
 	Password string `json:"password" yaml:"password"`
+	// 用户名，redis 6 ACL 使用，为空时只使用密码认证
+	Username string `json:"username" yaml:"username"`
+	// 数据库，集群模式只能为 0
+	// 默认值：0
+	DB int `json:"db" yaml:"db"`
+	// 连接超时时间，单位：秒
+	// 默认值：5
+	ConnectTimeout int `json:"connectTimeout" yaml:"connectTimeout"`
+	// 读超时时间，单位：秒
+	// 默认值：1
+	ReadTimeout int `json:"readTimeout" yaml:"readTimeout"`
+	// 写超时时间，单位：秒
+	// 默认值：1
+	WriteTimeout int `json:"writeTimeout" yaml:"writeTimeout"`
+	// tcp keep-alive 间隔，单位：秒
+	// 默认值：1
+	KeepAlive int `json:"keepAlive" yaml:"keepAlive"`
+	// 空闲超过该时间的连接在借出前先 PING 检查，单位：秒，小于 0 时不检查
+	// 默认值：60
+	HealthCheckInterval int `json:"healthCheckInterval" yaml:"healthCheckInterval"`
+	// 连接最大存活时间，超过后关闭重建，单位：秒
+	// 默认值：0，不限制
+	MaxConnLifetime int `json:"maxConnLifetime" yaml:"maxConnLifetime"`
+	// 连接数达到 MaxActive 时等待空闲连接，为 false 时直接返回错误
+	// 默认值：false
+	Wait bool `json:"wait" yaml:"wait"`
+	// TLS 配置，为空时不使用 TLS
+	TLS *RedisTLSConfig `json:"tls" yaml:"tls"`
+	// key 前缀，通过该实例执行的所有命令中的 key 和频道都会自动加上前缀
+	// 默认值：空，不加前缀
+	KeyPrefix string `json:"keyPrefix" yaml:"keyPrefix"`
+	// 连接成功后预加载所有已注册的 lua 脚本
+	// 默认值：false
+	PreloadScripts bool `json:"preloadScripts" yaml:"preloadScripts"`
+	// 部署模式
+	// 可选值：standalone|sentinel|cluster
+	// 默认值：standalone
+	Mode string `json:"mode" yaml:"mode"`
+	// 哨兵模式的主节点名称
+	MasterName string `json:"masterName" yaml:"masterName"`
+	// 哨兵地址
+	SentinelAddresses []string `json:"sentinelAddresses" yaml:"sentinelAddresses"`
+	// 哨兵密码
+	SentinelPassword string `json:"sentinelPassword" yaml:"sentinelPassword"`
+	// 集群节点地址，只需配置部分节点，其余节点通过 CLUSTER SLOTS 发现
+	ClusterAddresses []string `json:"clusterAddresses" yaml:"clusterAddresses"`
+}
+
+// redis TLS 配置
+type RedisTLSConfig struct {
+	// CA 证书文件，为空时使用系统证书
+	CAFile string `json:"caFile" yaml:"caFile"`
+	// 客户端证书文件，双向认证时使用
+	CertFile string `json:"certFile" yaml:"certFile"`
+	// 客户端私钥文件，双向认证时使用
+	KeyFile string `json:"keyFile" yaml:"keyFile"`
+	// 服务端证书校验使用的域名，为空时使用连接地址中的主机名
+	ServerName string `json:"serverName" yaml:"serverName"`
+	// 跳过服务端证书校验
+	InsecureSkipVerify bool `json:"insecureSkipVerify" yaml:"insecureSkipVerify"`
 }
 
 func GetRedisConfig() *RedisConfig {
@@ -55,4 +124,27 @@ func (r *RedisConfig) defaultValue() {
 	if r.IdleTimeout == 0 {
 		r.IdleTimeout = 300
 	}
+	if utils.IsEmpty(r.Mode) {
+		r.Mode = STANDALONE
+	}
+	r.dialDefaultValue()
+}
+
+// 连接参数的默认值，未调用 defaultValue 的配置也需要
+func (r *RedisConfig) dialDefaultValue() {
+	if r.ConnectTimeout == 0 {
+		r.ConnectTimeout = 5
+	}
+	if r.ReadTimeout == 0 {
+		r.ReadTimeout = 1
+	}
+	if r.WriteTimeout == 0 {
+		r.WriteTimeout = 1
+	}
+	if r.KeepAlive == 0 {
+		r.KeepAlive = 1
+	}
+	if r.HealthCheckInterval == 0 {
+		r.HealthCheckInterval = 60
+	}
 }
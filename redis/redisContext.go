@@ -0,0 +1,536 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis context 支持
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-tools/logs"
+)
+
+const logTag = "core.redis"
+
+type loggerHolder struct {
+	logger *logs.Logger
+}
+
+// 设置 context 版本方法使用的日志，命令以 debug 级别记录，并带上 ctx 中的 traceId
+// nil 表示不记录，对实例及其所有命名空间视图生效
+func (r *Redis) SetLogger(logger *logs.Logger) {
+	if r.monitor != nil {
+		r.monitor.logger.Store(loggerHolder{logger: logger})
+	}
+}
+
+// 返回绑定了 ctx 的视图：获取连接时使用 Pool.GetContext，ctx 的截止时间作为每条命令的超时时间
+// 与 WithContext 不同，不会使用 ctx 中的命名空间
+func (r *Redis) bind(ctx context.Context) *Redis {
+	if ctx == nil {
+		return r
+	}
+	view := *r
+	view.ctx = ctx
+	return &view
+}
+
+// 为命令设置 ctx 的截止时间，并记录 debug 日志
+// ctx 在命令返回前结束时立即返回 ctx 的错误，之后该连接上的操作都返回该错误；
+// 已发送的命令无法中断，会继续等待返回值或读超时，完成后连接才归还连接池，
+// 因此没有读超时的阻塞命令（如 BLPOP key 0）应同时使用带截止时间的 ctx
+type ctxConn struct {
+	redis.Conn
+	ctx         context.Context
+	readTimeout time.Duration
+	logs        *logs.Logs
+	// ctx 结束时的错误
+	err error
+	// ctx 结束时仍在执行的命令，命令返回后关闭
+	inflight chan struct{}
+}
+
+type ctxReply struct {
+	reply interface{}
+	err   error
+}
+
+func (c *ctxConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return c.DoWithTimeout(0, commandName, args...)
+}
+
+// timeout 为 0 时使用连接的读超时，ctx 的截止时间更早时以截止时间为准
+func (c *ctxConn) DoWithTimeout(timeout time.Duration, commandName string,
+	args ...interface{}) (interface{}, error) {
+	start := time.Now()
+	reply, err := c.do(timeout, commandName, args)
+	if c.logs != nil && commandName != "" {
+		// 只记录第一个参数（一般是 key），避免记录较大的 value
+		var key interface{}
+		if len(args) > 0 {
+			key = args[0]
+		}
+		c.logs.Debug("redis command: %s %v, duration: %v, error: %v", commandName, key, time.Since(start), err)
+	}
+	return reply, err
+}
+
+func (c *ctxConn) do(timeout time.Duration, commandName string, args []interface{}) (interface{}, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	timeout, err := c.timeout(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return c.call(func() (interface{}, error) {
+		if timeout == 0 {
+			return c.Conn.Do(commandName, args...)
+		}
+		return redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+	})
+}
+
+// 执行 f，ctx 先结束时不再等待 f 返回
+func (c *ctxConn) call(f func() (interface{}, error)) (interface{}, error) {
+	done := c.ctx.Done()
+	if done == nil {
+		return f()
+	}
+	result := make(chan ctxReply, 1)
+	inflight := make(chan struct{})
+	go func() {
+		defer close(inflight)
+		reply, err := f()
+		result <- ctxReply{reply: reply, err: err}
+	}()
+	select {
+	case r := <-result:
+		return r.reply, r.err
+	case <-done:
+		select {
+		case r := <-result:
+			return r.reply, r.err
+		default:
+		}
+		c.err = c.ctx.Err()
+		c.inflight = inflight
+		return nil, c.err
+	}
+}
+
+// 有未完成的命令时，等命令返回后再归还连接
+func (c *ctxConn) Close() error {
+	if c.inflight == nil {
+		return c.Conn.Close()
+	}
+	inflight := c.inflight
+	c.inflight = nil
+	go func() {
+		<-inflight
+		c.Conn.Close()
+	}()
+	return nil
+}
+
+func (c *ctxConn) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.Conn.Err()
+}
+
+func (c *ctxConn) Send(commandName string, args ...interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.Conn.Send(commandName, args...)
+}
+
+func (c *ctxConn) Flush() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.Conn.Flush()
+}
+
+func (c *ctxConn) Receive() (interface{}, error) {
+	return c.ReceiveWithTimeout(0)
+}
+
+func (c *ctxConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	timeout, err := c.timeout(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return c.call(func() (interface{}, error) {
+		if timeout == 0 {
+			return c.Conn.Receive()
+		}
+		return redis.ReceiveWithTimeout(c.Conn, timeout)
+	})
+}
+
+// 计算本次读取的超时时间，返回 0 表示使用连接的读超时
+func (c *ctxConn) timeout(timeout time.Duration) (time.Duration, error) {
+	deadline, ok := c.ctx.Deadline()
+	if !ok {
+		return timeout, nil
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return 0, context.DeadlineExceeded
+	}
+	if timeout == 0 {
+		timeout = c.readTimeout
+	}
+	if timeout <= 0 || remaining < timeout {
+		return remaining, nil
+	}
+	return timeout, nil
+}
+
+// 获取连接失败时返回的连接，所有操作都返回该错误
+type errorConn struct {
+	err error
+}
+
+func (c errorConn) Close() error                                   { return nil }
+func (c errorConn) Err() error                                     { return c.err }
+func (c errorConn) Do(string, ...interface{}) (interface{}, error) { return nil, c.err }
+func (c errorConn) Send(string, ...interface{}) error              { return c.err }
+func (c errorConn) Flush() error                                   { return c.err }
+func (c errorConn) Receive() (interface{}, error)                  { return nil, c.err }
+
+// 创建带 ctx 中 traceId 的日志，未设置日志时返回 nil
+func (r *Redis) logs(ctx context.Context) *logs.Logs {
+	if r.monitor == nil {
+		return nil
+	}
+	logger := r.monitor.getLogger()
+	if logger == nil {
+		return nil
+	}
+	return logs.New(ctx, logTag, logger.Logger)
+}
+
+func (m *monitor) getLogger() *logs.Logger {
+	if holder, ok := m.logger.Load().(loggerHolder); ok {
+		return holder.logger
+	}
+	return nil
+}
+
+// Get 的 context 版本
+func (r *Redis) GetContext(ctx context.Context, key string) (string, error) {
+	return r.bind(ctx).Get(key)
+}
+
+// Set 的 context 版本
+func (r *Redis) SetContext(ctx context.Context, key string, value string) error {
+	return r.bind(ctx).Set(key, value)
+}
+
+// Del 的 context 版本
+func (r *Redis) DelContext(ctx context.Context, key string) error {
+	return r.bind(ctx).Del(key)
+}
+
+// SetExpire 的 context 版本
+func (r *Redis) SetExpireContext(ctx context.Context, key string, value string, ex int) error {
+	return r.bind(ctx).SetExpire(key, value, ex)
+}
+
+// SetWithOptions 的 context 版本
+func (r *Redis) SetWithOptionsContext(ctx context.Context, key string, value string, opts *SetOptions) (bool, error) {
+	return r.bind(ctx).SetWithOptions(key, value, opts)
+}
+
+// SetNX 的 context 版本
+func (r *Redis) SetNXContext(ctx context.Context, key string, value string, expire time.Duration) (bool, error) {
+	return r.bind(ctx).SetNX(key, value, expire)
+}
+
+// GetSet 的 context 版本
+func (r *Redis) GetSetContext(ctx context.Context, key string, value string) (string, error) {
+	return r.bind(ctx).GetSet(key, value)
+}
+
+// IncrBy 的 context 版本
+func (r *Redis) IncrByContext(ctx context.Context, key string, delta int64, expire time.Duration) (int64, error) {
+	return r.bind(ctx).IncrBy(key, delta, expire)
+}
+
+// IncrByFloat 的 context 版本
+func (r *Redis) IncrByFloatContext(ctx context.Context, key string, delta float64, expire time.Duration) (float64, error) {
+	return r.bind(ctx).IncrByFloat(key, delta, expire)
+}
+
+// Exists 的 context 版本
+func (r *Redis) ExistsContext(ctx context.Context, key string) (bool, error) {
+	return r.bind(ctx).Exists(key)
+}
+
+// Expire 的 context 版本
+func (r *Redis) ExpireContext(ctx context.Context, key string, expire time.Duration) (bool, error) {
+	return r.bind(ctx).Expire(key, expire)
+}
+
+// TTL 的 context 版本
+func (r *Redis) TTLContext(ctx context.Context, key string) (time.Duration, error) {
+	return r.bind(ctx).TTL(key)
+}
+
+// Persist 的 context 版本
+func (r *Redis) PersistContext(ctx context.Context, key string) (bool, error) {
+	return r.bind(ctx).Persist(key)
+}
+
+// MGet 的 context 版本
+func (r *Redis) MGetContext(ctx context.Context, keys ...string) ([]*string, error) {
+	return r.bind(ctx).MGet(keys...)
+}
+
+// MSet 的 context 版本
+func (r *Redis) MSetContext(ctx context.Context, values map[string]string) error {
+	return r.bind(ctx).MSet(values)
+}
+
+// MDel 的 context 版本
+func (r *Redis) MDelContext(ctx context.Context, keys ...string) (int, error) {
+	return r.bind(ctx).MDel(keys...)
+}
+
+// HGet 的 context 版本
+func (r *Redis) HGetContext(ctx context.Context, key string, field string) (string, error) {
+	return r.bind(ctx).HGet(key, field)
+}
+
+// HSet 的 context 版本
+func (r *Redis) HSetContext(ctx context.Context, key string, field string, value string) error {
+	return r.bind(ctx).HSet(key, field, value)
+}
+
+// HMSet 的 context 版本
+func (r *Redis) HMSetContext(ctx context.Context, key string, fields map[string]string) error {
+	return r.bind(ctx).HMSet(key, fields)
+}
+
+// HGetAll 的 context 版本
+func (r *Redis) HGetAllContext(ctx context.Context, key string) (map[string]string, error) {
+	return r.bind(ctx).HGetAll(key)
+}
+
+// HDel 的 context 版本
+func (r *Redis) HDelContext(ctx context.Context, key string, fields ...string) (int, error) {
+	return r.bind(ctx).HDel(key, fields...)
+}
+
+// HExists 的 context 版本
+func (r *Redis) HExistsContext(ctx context.Context, key string, field string) (bool, error) {
+	return r.bind(ctx).HExists(key, field)
+}
+
+// HScanStruct 的 context 版本
+func (r *Redis) HScanStructContext(ctx context.Context, key string, dest interface{}) error {
+	return r.bind(ctx).HScanStruct(key, dest)
+}
+
+// HSetStruct 的 context 版本
+func (r *Redis) HSetStructContext(ctx context.Context, key string, src interface{}) error {
+	return r.bind(ctx).HSetStruct(key, src)
+}
+
+// LPush 的 context 版本
+func (r *Redis) LPushContext(ctx context.Context, key string, values ...string) (int, error) {
+	return r.bind(ctx).LPush(key, values...)
+}
+
+// RPush 的 context 版本
+func (r *Redis) RPushContext(ctx context.Context, key string, values ...string) (int, error) {
+	return r.bind(ctx).RPush(key, values...)
+}
+
+// LPop 的 context 版本
+func (r *Redis) LPopContext(ctx context.Context, key string) (string, error) {
+	return r.bind(ctx).LPop(key)
+}
+
+// RPop 的 context 版本
+func (r *Redis) RPopContext(ctx context.Context, key string) (string, error) {
+	return r.bind(ctx).RPop(key)
+}
+
+// LRange 的 context 版本
+func (r *Redis) LRangeContext(ctx context.Context, key string, start int, stop int) ([]string, error) {
+	return r.bind(ctx).LRange(key, start, stop)
+}
+
+// LLen 的 context 版本
+func (r *Redis) LLenContext(ctx context.Context, key string) (int, error) {
+	return r.bind(ctx).LLen(key)
+}
+
+// SAdd 的 context 版本
+func (r *Redis) SAddContext(ctx context.Context, key string, members ...string) (int, error) {
+	return r.bind(ctx).SAdd(key, members...)
+}
+
+// SRem 的 context 版本
+func (r *Redis) SRemContext(ctx context.Context, key string, members ...string) (int, error) {
+	return r.bind(ctx).SRem(key, members...)
+}
+
+// SMembers 的 context 版本
+func (r *Redis) SMembersContext(ctx context.Context, key string) ([]string, error) {
+	return r.bind(ctx).SMembers(key)
+}
+
+// SIsMember 的 context 版本
+func (r *Redis) SIsMemberContext(ctx context.Context, key string, member string) (bool, error) {
+	return r.bind(ctx).SIsMember(key, member)
+}
+
+// SCard 的 context 版本
+func (r *Redis) SCardContext(ctx context.Context, key string) (int, error) {
+	return r.bind(ctx).SCard(key)
+}
+
+// ZAdd 的 context 版本
+func (r *Redis) ZAddContext(ctx context.Context, key string, members ...Z) (int, error) {
+	return r.bind(ctx).ZAdd(key, members...)
+}
+
+// ZRem 的 context 版本
+func (r *Redis) ZRemContext(ctx context.Context, key string, members ...string) (int, error) {
+	return r.bind(ctx).ZRem(key, members...)
+}
+
+// ZIncrBy 的 context 版本
+func (r *Redis) ZIncrByContext(ctx context.Context, key string, increment float64, member string) (float64, error) {
+	return r.bind(ctx).ZIncrBy(key, increment, member)
+}
+
+// ZScore 的 context 版本
+func (r *Redis) ZScoreContext(ctx context.Context, key string, member string) (float64, bool, error) {
+	return r.bind(ctx).ZScore(key, member)
+}
+
+// ZCard 的 context 版本
+func (r *Redis) ZCardContext(ctx context.Context, key string) (int, error) {
+	return r.bind(ctx).ZCard(key)
+}
+
+// ZRangeByScore 的 context 版本
+func (r *Redis) ZRangeByScoreContext(ctx context.Context, key string, min string, max string, offset int, count int) ([]Z, error) {
+	return r.bind(ctx).ZRangeByScore(key, min, max, offset, count)
+}
+
+// PFAdd 的 context 版本
+func (r *Redis) PFAddContext(ctx context.Context, key string, elements ...string) (bool, error) {
+	return r.bind(ctx).PFAdd(key, elements...)
+}
+
+// PFCount 的 context 版本
+func (r *Redis) PFCountContext(ctx context.Context, keys ...string) (int64, error) {
+	return r.bind(ctx).PFCount(keys...)
+}
+
+// PFMerge 的 context 版本
+func (r *Redis) PFMergeContext(ctx context.Context, destKey string, sourceKeys ...string) error {
+	return r.bind(ctx).PFMerge(destKey, sourceKeys...)
+}
+
+// GeoAdd 的 context 版本
+func (r *Redis) GeoAddContext(ctx context.Context, key string, locations ...*GeoLocation) (int, error) {
+	return r.bind(ctx).GeoAdd(key, locations...)
+}
+
+// GeoAddStructs 的 context 版本
+func (r *Redis) GeoAddStructsContext(ctx context.Context, key string, items interface{}) (int, error) {
+	return r.bind(ctx).GeoAddStructs(key, items)
+}
+
+// GeoDist 的 context 版本
+func (r *Redis) GeoDistContext(ctx context.Context, key string, member1 string, member2 string, unit string) (float64, error) {
+	return r.bind(ctx).GeoDist(key, member1, member2, unit)
+}
+
+// GeoPos 的 context 版本
+func (r *Redis) GeoPosContext(ctx context.Context, key string, members ...string) ([]*GeoLocation, error) {
+	return r.bind(ctx).GeoPos(key, members...)
+}
+
+// GeoSearch 的 context 版本
+func (r *Redis) GeoSearchContext(ctx context.Context, key string, query *GeoSearchQuery) ([]*GeoLocation, error) {
+	return r.bind(ctx).GeoSearch(key, query)
+}
+
+// XAdd 的 context 版本
+func (r *Redis) XAddContext(ctx context.Context, stream string, maxLen int64, values map[string]string) (string, error) {
+	return r.bind(ctx).XAdd(stream, maxLen, values)
+}
+
+// XLen 的 context 版本
+func (r *Redis) XLenContext(ctx context.Context, stream string) (int64, error) {
+	return r.bind(ctx).XLen(stream)
+}
+
+// Publish 的 context 版本
+func (r *Redis) PublishContext(ctx context.Context, channel string, message string) (int, error) {
+	return r.bind(ctx).Publish(channel, message)
+}
+
+// Eval 的 context 版本
+func (r *Redis) EvalContext(ctx context.Context, script *Script, keysAndArgs ...interface{}) (interface{}, error) {
+	return r.bind(ctx).Eval(script, keysAndArgs...)
+}
+
+// Pipeline 的 context 版本，ctx 的截止时间对 Exec 生效
+func (r *Redis) PipelineContext(ctx context.Context) *Pipeline {
+	return r.bind(ctx).Pipeline()
+}
+
+// Scan 的 context 版本，遍历中的命令使用 ctx 的截止时间和日志
+func (r *Redis) ScanContext(ctx context.Context, match string, count int) *ScanIterator {
+	return r.bind(ctx).Scan(match, count)
+}
+
+// HScan 的 context 版本
+func (r *Redis) HScanContext(ctx context.Context, key string, match string, count int) *ScanIterator {
+	return r.bind(ctx).HScan(key, match, count)
+}
+
+// SScan 的 context 版本
+func (r *Redis) SScanContext(ctx context.Context, key string, match string, count int) *ScanIterator {
+	return r.bind(ctx).SScan(key, match, count)
+}
+
+// ZScan 的 context 版本
+func (r *Redis) ZScanContext(ctx context.Context, key string, match string, count int) *ScanIterator {
+	return r.bind(ctx).ZScan(key, match, count)
+}
+
+// LoadScripts 的 context 版本
+func (r *Redis) LoadScriptsContext(ctx context.Context) error {
+	return r.bind(ctx).LoadScripts()
+}
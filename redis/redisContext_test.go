@@ -0,0 +1,265 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis context 支持
+package redis
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-tools/common"
+	"github.com/liuchonglin/go-tools/logs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 记录 DoWithTimeout 收到的超时时间
+type timeoutConn struct {
+	redis.Conn
+	timeout time.Duration
+}
+
+func (c *timeoutConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	c.timeout = 0
+	return "OK", nil
+}
+
+func (c *timeoutConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	c.timeout = timeout
+	return "OK", nil
+}
+
+func (c *timeoutConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	c.timeout = timeout
+	return nil, nil
+}
+
+func TestCtxConnTimeout(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	canceled, cancel2 := context.WithCancel(context.Background())
+	cancel2()
+	short, cancel3 := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel3()
+	long, cancel4 := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel4()
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		readTimeout time.Duration
+		timeout     time.Duration
+		wantMin     time.Duration
+		wantMax     time.Duration
+		wantErr     error
+	}{
+		{
+			name:        "no deadline",
+			ctx:         context.Background(),
+			readTimeout: time.Second,
+		}, {
+			name:        "no deadline with timeout",
+			ctx:         context.Background(),
+			readTimeout: time.Second,
+			timeout:     3 * time.Second,
+			wantMin:     3 * time.Second,
+			wantMax:     3 * time.Second,
+		}, {
+			name:        "deadline before read timeout",
+			ctx:         short,
+			readTimeout: time.Second,
+			wantMin:     50 * time.Millisecond,
+			wantMax:     100 * time.Millisecond,
+		}, {
+			name:        "read timeout before deadline",
+			ctx:         long,
+			readTimeout: time.Second,
+			wantMin:     time.Second,
+			wantMax:     time.Second,
+		}, {
+			name:    "no read timeout",
+			ctx:     long,
+			wantMin: 50 * time.Second,
+			wantMax: time.Minute,
+		}, {
+			name:    "expired",
+			ctx:     expired,
+			wantErr: context.DeadlineExceeded,
+		}, {
+			name:    "canceled",
+			ctx:     canceled,
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &timeoutConn{}
+			c := &ctxConn{Conn: conn, ctx: tt.ctx, readTimeout: tt.readTimeout}
+			_, err := c.DoWithTimeout(tt.timeout, "get", "key")
+			if err != tt.wantErr {
+				t.Errorf("DoWithTimeout() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if conn.timeout < tt.wantMin || conn.timeout > tt.wantMax {
+				t.Errorf("timeout = %v, want [%v, %v]", conn.timeout, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+// 命令阻塞到 release 关闭
+type blockingConn struct {
+	redis.Conn
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func (c *blockingConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	<-c.release
+	return "OK", nil
+}
+
+func (c *blockingConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+// 没有截止时间的 ctx 取消后，阻塞中的命令立即返回，命令返回后连接才被关闭
+func TestCtxConnCancel(t *testing.T) {
+	conn := &blockingConn{release: make(chan struct{}), closed: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &ctxConn{Conn: conn, ctx: ctx}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := c.Do("blpop", "key", 0); err != context.Canceled {
+		t.Fatalf("Do() error = %v, want %v", err, context.Canceled)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Do() returned after %v", d)
+	}
+	if err := c.Send("get", "key"); err != context.Canceled {
+		t.Errorf("Send() error = %v, want %v", err, context.Canceled)
+	}
+	if err := c.Err(); err != context.Canceled {
+		t.Errorf("Err() error = %v, want %v", err, context.Canceled)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	select {
+	case <-conn.closed:
+		t.Fatalf("conn closed while command in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(conn.release)
+	select {
+	case <-conn.closed:
+	case <-time.After(time.Second):
+		t.Errorf("conn not closed after command returned")
+	}
+}
+
+func TestContextVariants(t *testing.T) {
+	var buf bytes.Buffer
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.DebugLevel)
+	redisTool.SetLogger(&logs.Logger{Logger: zap.New(core)})
+	defer redisTool.SetLogger(nil)
+
+	ctx := context.WithValue(context.Background(), common.TraceIdKey, "trace-123")
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	tests := []struct {
+		name    string
+		run     func() error
+		wantErr bool
+	}{
+		{
+			name: "set",
+			run:  func() error { return redisTool.SetContext(ctx, "ctx", "a") },
+		}, {
+			name: "get",
+			run: func() error {
+				_, err := redisTool.GetContext(ctx, "ctx")
+				return err
+			},
+		}, {
+			name: "pipeline",
+			run: func() error {
+				p := redisTool.PipelineContext(ctx)
+				defer p.Close()
+				reply := p.Get("ctx")
+				if _, err := p.Exec(); err != nil {
+					return err
+				}
+				return reply.Err
+			},
+		}, {
+			name: "canceled",
+			run: func() error {
+				_, err := redisTool.GetContext(canceled, "ctx")
+				return err
+			},
+			wantErr: true,
+		}, {
+			name: "scan",
+			run: func() error {
+				it := redisTool.ScanContext(ctx, "ctx*", 10)
+				for it.Next(context.Background()) {
+				}
+				return it.Err()
+			},
+		}, {
+			name: "tx",
+			run: func() error {
+				return redisTool.Tx(ctx, []string{"ctx"}, func(tx *Tx) error {
+					tx.Set("ctx", "b", 0)
+					return nil
+				})
+			},
+		}, {
+			name: "delete by pattern",
+			run: func() error {
+				_, err := redisTool.DeleteByPattern(ctx, "ctx:none*", 10, nil)
+				return err
+			},
+		}, {
+			name: "nil ctx",
+			run:  func() error { return redisTool.DelContext(nil, "ctx") },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); (err != nil) != tt.wantErr {
+				t.Errorf("run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	log := buf.String()
+	if !strings.Contains(log, `"traceId":"trace-123"`) {
+		t.Errorf("log = %s, want debug logs with traceId", log)
+	}
+	for _, want := range []string{"redis command: get ctx", "redis command: scan", "redis command: watch ctx",
+		"redis command: exec"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log = %s, want %q", log, want)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis延迟队列
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 将到期的任务从延迟集合移入就绪列表
+var delayPromoteScript = NewScript(2, `
+local ids = redis.call("zrangebyscore", KEYS[1], "-inf", ARGV[1], "limit", 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call("zrem", KEYS[1], id)
+	redis.call("rpush", KEYS[2], id)
+end
+return #ids`)
+
+// 从就绪列表取出一个任务，投递次数加一，并在 ARGV[1] 之后重新到期（处理超时后重新投递）
+// 已取消的任务会被跳过
+var delayReserveScript = NewScript(3, `
+while true do
+	local id = redis.call("lpop", KEYS[1])
+	if not id then
+		return false
+	end
+	local raw = redis.call("hget", KEYS[2], id)
+	if raw then
+		local job = cjson.decode(raw)
+		job.attempts = (job.attempts or 0) + 1
+		raw = cjson.encode(job)
+		redis.call("hset", KEYS[2], id, raw)
+		redis.call("zadd", KEYS[3], ARGV[1], id)
+		return raw
+	end
+end`)
+
+// 任务仍存在时（未被取消）重新安排到期时间
+var delayRetryScript = NewScript(2, `
+if redis.call("hexists", KEYS[1], ARGV[1]) == 1 then
+	redis.call("zadd", KEYS[2], ARGV[2], ARGV[1])
+	return 1
+end
+return 0`)
+
+// 删除任务，ARGV[2] 不为空时写入死信列表
+var delayFinishScript = NewScript(3, `
+redis.call("zrem", KEYS[1], ARGV[1])
+local raw = redis.call("hget", KEYS[2], ARGV[1])
+redis.call("hdel", KEYS[2], ARGV[1])
+if raw and ARGV[2] ~= "" then
+	redis.call("rpush", KEYS[3], raw)
+end
+return 1`)
+
+// 取消任务，返回任务是否存在
+var delayCancelScript = NewScript(3, `
+redis.call("zrem", KEYS[1], ARGV[1])
+redis.call("lrem", KEYS[2], 0, ARGV[1])
+return redis.call("hdel", KEYS[3], ARGV[1])`)
+
+// 延迟任务
+type DelayJob struct {
+	// 任务 id
+	Id string `json:"id"`
+	// 任务内容
+	Payload string `json:"payload"`
+	// 已投递次数，包括本次
+	Attempts int `json:"attempts"`
+}
+
+// 延迟队列配置
+type DelayQueueConfig struct {
+	// 队列名称
+	Name string `json:"name" yaml:"name"`
+	// 并发处理的 worker 数量
+	// 默认值：1
+	Workers int `json:"workers" yaml:"workers"`
+	// 队列为空时的轮询间隔，单位：毫秒
+	// 默认值：1000
+	PollInterval int `json:"pollInterval" yaml:"pollInterval"`
+	// 每次移入就绪列表的最大任务数
+	// 默认值：100
+	BatchSize int `json:"batchSize" yaml:"batchSize"`
+	// 处理超时时间，超过后任务被重新投递，单位：秒
+	// 默认值：60
+	Timeout int `json:"timeout" yaml:"timeout"`
+	// 最大重试次数，超过后转入死信列表
+	// 默认值：5
+	MaxRetries int `json:"maxRetries" yaml:"maxRetries"`
+	// 首次重试的等待时间，之后每次翻倍，单位：秒
+	// 默认值：1
+	MinBackoff int `json:"minBackoff" yaml:"minBackoff"`
+	// 重试的最大等待时间，单位：秒
+	// 默认值：300
+	MaxBackoff int `json:"maxBackoff" yaml:"maxBackoff"`
+}
+
+func (d *DelayQueueConfig) defaultValue() {
+	if d.Workers == 0 {
+		d.Workers = 1
+	}
+	if d.PollInterval == 0 {
+		d.PollInterval = 1000
+	}
+	if d.BatchSize == 0 {
+		d.BatchSize = 100
+	}
+	if d.Timeout == 0 {
+		d.Timeout = 60
+	}
+	if d.MaxRetries == 0 {
+		d.MaxRetries = 5
+	}
+	if d.MinBackoff == 0 {
+		d.MinBackoff = 1
+	}
+	if d.MaxBackoff == 0 {
+		d.MaxBackoff = 300
+	}
+}
+
+// 延迟队列，任务至少被成功处理一次
+// 数据保存在同一 hash tag 下的 4 个 key 中，集群模式下位于同一节点：
+// {name}:delayed 按到期时间排序的任务 id，{name}:ready 已到期待处理的任务 id，
+// {name}:jobs 任务内容，{name}:dead 重试次数用尽的任务
+type DelayQueue struct {
+	redis   *Redis
+	config  DelayQueueConfig
+	handler func(ctx context.Context, job *DelayJob) error
+
+	delayedKey string
+	readyKey   string
+	jobsKey    string
+	deadKey    string
+}
+
+// 创建延迟队列，handler 返回错误时按指数退避重试
+func (r *Redis) NewDelayQueue(config *DelayQueueConfig,
+	handler func(ctx context.Context, job *DelayJob) error) (*DelayQueue, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config 不能为空")
+	}
+	if utils.IsEmpty(config.Name) {
+		return nil, fmt.Errorf("name 不能为空")
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("handler 不能为空")
+	}
+	q := &DelayQueue{redis: r, config: *config, handler: handler}
+	q.config.defaultValue()
+	prefix := "{" + config.Name + "}"
+	q.delayedKey = prefix + ":delayed"
+	q.readyKey = prefix + ":ready"
+	q.jobsKey = prefix + ":jobs"
+	q.deadKey = prefix + ":dead"
+	return q, nil
+}
+
+// 添加任务，delay 后到期，返回任务 id
+func (q *DelayQueue) Schedule(payload string, delay time.Duration) (string, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(&DelayJob{Id: id, Payload: payload})
+	if err != nil {
+		return "", err
+	}
+	conn := q.redis.conn()
+	defer conn.Close()
+	conn.Send("multi")
+	conn.Send("hset", q.jobsKey, id, raw)
+	conn.Send("zadd", q.delayedKey, unixMilli(time.Now().Add(delay)), id)
+	if _, err := conn.Do("exec"); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// 取消尚未处理完成的任务，任务不存在时返回 false
+func (q *DelayQueue) Cancel(id string) (bool, error) {
+	if utils.IsEmpty(id) {
+		return false, fmt.Errorf("id 不能为空")
+	}
+	n, err := redis.Int(q.redis.Eval(delayCancelScript, q.delayedKey, q.readyKey, q.jobsKey, id))
+	return n > 0, err
+}
+
+// 获取死信列表中的任务
+func (q *DelayQueue) DeadJobs() ([]*DelayJob, error) {
+	values, err := redis.Strings(q.redis.do("lrange", q.deadKey, 0, -1))
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*DelayJob, 0, len(values))
+	for _, v := range values {
+		job := &DelayJob{}
+		if err := json.Unmarshal([]byte(v), job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// 开始处理任务，阻塞直到 ctx 结束
+// ctx 结束后不再取新任务，等待正在处理的任务完成后返回
+func (q *DelayQueue) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	wg.Add(q.config.Workers + 1)
+	go func() {
+		defer wg.Done()
+		q.promoteLoop(ctx)
+	}()
+	for i := 0; i < q.config.Workers; i++ {
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// 定期将到期任务移入就绪列表
+func (q *DelayQueue) promoteLoop(ctx context.Context) {
+	for {
+		n, err := redis.Int(q.redis.Eval(delayPromoteScript, q.delayedKey, q.readyKey,
+			unixMilli(time.Now()), q.config.BatchSize))
+		// 一批未处理完时立即继续
+		if err == nil && n >= q.config.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		if !q.wait(ctx) {
+			return
+		}
+	}
+}
+
+func (q *DelayQueue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := q.reserve()
+		if err != nil || job == nil {
+			if !q.wait(ctx) {
+				return
+			}
+			continue
+		}
+		q.handle(ctx, job)
+	}
+}
+
+// 取出一个就绪任务，没有时返回 nil
+func (q *DelayQueue) reserve() (*DelayJob, error) {
+	deadline := unixMilli(time.Now().Add(time.Duration(q.config.Timeout) * time.Second))
+	raw, err := q.redis.Eval(delayReserveScript, q.readyKey, q.jobsKey, q.delayedKey, deadline)
+	if raw == nil || err != nil {
+		return nil, err
+	}
+	b, err := redis.Bytes(raw, nil)
+	if err != nil {
+		return nil, err
+	}
+	job := &DelayJob{}
+	if err := json.Unmarshal(b, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// 处理任务，成功后删除，失败时重试或转入死信
+func (q *DelayQueue) handle(ctx context.Context, job *DelayJob) {
+	err := q.safeHandle(ctx, job)
+	if err == nil {
+		q.redis.Eval(delayFinishScript, q.delayedKey, q.jobsKey, q.deadKey, job.Id, "")
+		return
+	}
+	if job.Attempts > q.config.MaxRetries {
+		q.redis.Eval(delayFinishScript, q.delayedKey, q.jobsKey, q.deadKey, job.Id, "dead")
+		return
+	}
+	due := unixMilli(time.Now().Add(q.backoff(job.Attempts)))
+	q.redis.Eval(delayRetryScript, q.jobsKey, q.delayedKey, job.Id, due)
+}
+
+func (q *DelayQueue) safeHandle(ctx context.Context, job *DelayJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("got panic in delay queue handler: %+v", r)
+		}
+	}()
+	return q.handler(ctx, job)
+}
+
+// 第 attempts 次失败后的等待时间
+func (q *DelayQueue) backoff(attempts int) time.Duration {
+	backoff := time.Duration(q.config.MinBackoff) * time.Second
+	max := time.Duration(q.config.MaxBackoff) * time.Second
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// 等待一个轮询间隔，ctx 结束时返回 false
+func (q *DelayQueue) wait(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(time.Duration(q.config.PollInterval) * time.Millisecond):
+		return true
+	}
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
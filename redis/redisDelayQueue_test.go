@@ -0,0 +1,129 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis延迟队列
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewDelayQueue(t *testing.T) {
+	handler := func(ctx context.Context, job *DelayJob) error { return nil }
+	tests := []struct {
+		name    string
+		config  *DelayQueueConfig
+		handler func(ctx context.Context, job *DelayJob) error
+		wantErr bool
+	}{
+		{
+			name:    "all",
+			config:  &DelayQueueConfig{Name: "delay"},
+			handler: handler,
+		}, {
+			name:    "config nil",
+			handler: handler,
+			wantErr: true,
+		}, {
+			name:    "name nil",
+			config:  &DelayQueueConfig{},
+			handler: handler,
+			wantErr: true,
+		}, {
+			name:    "handler nil",
+			config:  &DelayQueueConfig{Name: "delay"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := redisTool.NewDelayQueue(tt.config, tt.handler); (err != nil) != tt.wantErr {
+				t.Errorf("NewDelayQueue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 到期后处理，失败的任务重试，重试用尽后进入死信，取消的任务不会被处理
+func TestDelayQueue(t *testing.T) {
+	requireRedisServer(t)
+	redisTool.MDel("{delay:jobs}:delayed", "{delay:jobs}:ready", "{delay:jobs}:jobs", "{delay:jobs}:dead")
+	var mu sync.Mutex
+	handled := make(map[string]int)
+	queue, err := redisTool.NewDelayQueue(&DelayQueueConfig{
+		Name:         "delay:jobs",
+		Workers:      2,
+		PollInterval: 50,
+		MaxRetries:   1,
+		MinBackoff:   1,
+	}, func(ctx context.Context, job *DelayJob) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[job.Payload]++
+		if job.Payload == "fail" || (job.Payload == "retry" && job.Attempts == 1) {
+			return errors.New("handle error")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("NewDelayQueue() error = %v", err)
+	}
+	queue.Schedule("ok", 200*time.Millisecond)
+	queue.Schedule("retry", 0)
+	queue.Schedule("fail", 0)
+	id, _ := queue.Schedule("cancel", 200*time.Millisecond)
+	if ok, err := queue.Cancel(id); err != nil || !ok {
+		t.Fatalf("Cancel() = %v, %v, want true, nil", ok, err)
+	}
+	if ok, _ := queue.Cancel(id); ok {
+		t.Errorf("Cancel() twice = true, want false")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+	queue.Run(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if handled["ok"] != 1 || handled["retry"] != 2 || handled["fail"] != 2 || handled["cancel"] != 0 {
+		t.Errorf("handled = %v", handled)
+	}
+	dead, err := queue.DeadJobs()
+	if err != nil || len(dead) != 1 || dead[0].Payload != "fail" {
+		t.Errorf("DeadJobs() = %v, %v, want [fail]", dead, err)
+	}
+}
+
+func TestDelayQueueBackoff(t *testing.T) {
+	q := &DelayQueue{config: DelayQueueConfig{MinBackoff: 1, MaxBackoff: 5}}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 3, want: 4 * time.Second},
+		{attempts: 4, want: 5 * time.Second},
+		{attempts: 10, want: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := q.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%v) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
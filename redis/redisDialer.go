@@ -0,0 +1,146 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis连接
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 建立到 redis 节点的连接，所有部署模式共用相同的连接参数
+type dialer struct {
+	options        []redis.DialOption
+	username       string
+	password       string
+	db             int
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+}
+
+func newDialer(redisConfig *RedisConfig) (*dialer, error) {
+	d := &dialer{
+		username:       redisConfig.Username,
+		password:       redisConfig.Password,
+		db:             redisConfig.DB,
+		connectTimeout: time.Duration(redisConfig.ConnectTimeout) * time.Second,
+		readTimeout:    time.Duration(redisConfig.ReadTimeout) * time.Second,
+		writeTimeout:   time.Duration(redisConfig.WriteTimeout) * time.Second,
+	}
+	d.options = []redis.DialOption{
+		redis.DialConnectTimeout(d.connectTimeout),
+		redis.DialReadTimeout(d.readTimeout),
+		redis.DialWriteTimeout(d.writeTimeout),
+		redis.DialKeepAlive(time.Duration(redisConfig.KeepAlive) * time.Second),
+	}
+	// 有用户名时在连接后通过 AUTH username password 认证，SELECT 必须在 AUTH 之后，因此同样由 dial 发送
+	if utils.IsEmpty(redisConfig.Username) {
+		d.options = append(d.options, redis.DialDatabase(redisConfig.DB))
+		if !utils.IsEmpty(redisConfig.Password) {
+			d.options = append(d.options, redis.DialPassword(redisConfig.Password))
+		}
+	}
+	if redisConfig.TLS != nil {
+		tlsConfig, err := newTLSConfig(redisConfig.TLS)
+		if err != nil {
+			return nil, err
+		}
+		d.options = append(d.options, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig),
+			redis.DialTLSSkipVerify(redisConfig.TLS.InsecureSkipVerify))
+	}
+	return d, nil
+}
+
+// 连接指定地址的 redis 节点
+func (d *dialer) dial(address string) (redis.Conn, error) {
+	conn, err := redis.Dial("tcp", address, d.options...)
+	if err != nil {
+		return nil, err
+	}
+	if utils.IsEmpty(d.username) {
+		return conn, nil
+	}
+	if _, err := conn.Do("auth", d.username, d.password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if d.db != 0 {
+		if _, err := conn.Do("select", d.db); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// 创建连接池，连接池参数对所有部署模式的节点通用
+// MaxIdle：最大的空闲连接数，表示即使没有redis连接时依然可以保持N个空闲的连接，而不被清除，随时处于待命状态。
+// MaxActive：最大的激活连接数，表示同时最多有N个连接
+// IdleTimeout：最大的空闲连接等待时间，超过此时间后，空闲连接将被关闭
+// MaxConnLifetime：连接最大存活时间，超过此时间后连接将被关闭
+func newPool(redisConfig *RedisConfig, dial func() (redis.Conn, error)) *redis.Pool {
+	pool := &redis.Pool{
+		MaxIdle:         redisConfig.MaxIdle,
+		MaxActive:       redisConfig.MaxActive,
+		Wait:            redisConfig.Wait,
+		IdleTimeout:     time.Duration(redisConfig.IdleTimeout) * time.Second,
+		MaxConnLifetime: time.Duration(redisConfig.MaxConnLifetime) * time.Second,
+		Dial:            dial,
+	}
+	if redisConfig.HealthCheckInterval > 0 {
+		interval := time.Duration(redisConfig.HealthCheckInterval) * time.Second
+		pool.TestOnBorrow = func(conn redis.Conn, t time.Time) error {
+			if time.Since(t) < interval {
+				return nil
+			}
+			_, err := conn.Do("ping")
+			return err
+		}
+	}
+	return pool
+}
+
+func newTLSConfig(redisTLSConfig *RedisTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         redisTLSConfig.ServerName,
+		InsecureSkipVerify: redisTLSConfig.InsecureSkipVerify,
+	}
+	if !utils.IsEmpty(redisTLSConfig.CAFile) {
+		ca, err := ioutil.ReadFile(redisTLSConfig.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("redis 读取 CA 证书失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("redis CA 证书格式错误: %s", redisTLSConfig.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if !utils.IsEmpty(redisTLSConfig.CertFile) || !utils.IsEmpty(redisTLSConfig.KeyFile) {
+		cert, err := tls.LoadX509KeyPair(redisTLSConfig.CertFile, redisTLSConfig.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("redis 读取客户端证书失败: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
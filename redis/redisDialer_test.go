@@ -0,0 +1,166 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis连接
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *RedisTLSConfig
+		wantErr bool
+	}{
+		{
+			name:   "all",
+			config: &RedisTLSConfig{ServerName: "redis.local", InsecureSkipVerify: true},
+		}, {
+			name:    "ca not exist",
+			config:  &RedisTLSConfig{CAFile: "not_exist_ca.pem"},
+			wantErr: true,
+		}, {
+			name:    "cert not exist",
+			config:  &RedisTLSConfig{CertFile: "not_exist_cert.pem", KeyFile: "not_exist_key.pem"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTLSConfig(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != nil && got.ServerName != tt.config.ServerName {
+				t.Errorf("newTLSConfig() ServerName = %v, want %v", got.ServerName, tt.config.ServerName)
+			}
+		})
+	}
+}
+
+func TestNewRedisDialOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *RedisConfig
+		wantErr bool
+		// 需要真实的 redis，内存服务不区分用户
+		realServer bool
+	}{
+		{
+			name: "username",
+			config: &RedisConfig{
+				Address:  config.Address,
+				Username: "default",
+				Password: config.Password,
+			},
+		}, {
+			name: "username err",
+			config: &RedisConfig{
+				Address:  config.Address,
+				Username: "user_not_exist",
+				Password: config.Password,
+			},
+			wantErr:    true,
+			realServer: true,
+		}, {
+			name: "timeouts",
+			config: &RedisConfig{
+				Address:         config.Address,
+				Password:        config.Password,
+				ConnectTimeout:  1,
+				ReadTimeout:     3,
+				WriteTimeout:    3,
+				MaxConnLifetime: 60,
+			},
+		}, {
+			name: "tls err",
+			config: &RedisConfig{
+				Address:  config.Address,
+				Password: config.Password,
+				TLS:      &RedisTLSConfig{CAFile: "not_exist_ca.pem"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.realServer {
+				requireRedisServer(t)
+			}
+			if _, err := NewRedis(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("NewRedis() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewRedisDB(t *testing.T) {
+	db := *config
+	db.DB = 1
+	r, err := NewRedis(&db)
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	redisTool.Del("dialer:db")
+	if err := r.Set("dialer:db", "1"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	defer r.Del("dialer:db")
+	if got, _ := redisTool.Get("dialer:db"); got != "" {
+		t.Errorf("Get() db 0 = %v, want empty", got)
+	}
+	if got, _ := r.Get("dialer:db"); got != "1" {
+		t.Errorf("Get() db 1 = %v, want 1", got)
+	}
+}
+
+// 有用户名时先 AUTH 再 SELECT
+func TestNewRedisUsernameDB(t *testing.T) {
+	db := *config
+	db.Username = "default"
+	db.DB = 1
+	r, err := NewRedis(&db)
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	if err := r.Set("dialer:username:db", "1"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	defer r.Del("dialer:username:db")
+	if got, _ := redisTool.Get("dialer:username:db"); got != "" {
+		t.Errorf("Get() db 0 = %v, want empty", got)
+	}
+	if got, _ := r.Get("dialer:username:db"); got != "1" {
+		t.Errorf("Get() db 1 = %v, want 1", got)
+	}
+}
+
+func TestNewPoolHealthCheck(t *testing.T) {
+	pool := newPool(&RedisConfig{HealthCheckInterval: 1}, nil)
+	if pool.TestOnBorrow == nil {
+		t.Fatalf("newPool() TestOnBorrow is nil")
+	}
+	conn := redisTool.RedisPool.Get()
+	defer conn.Close()
+	if err := pool.TestOnBorrow(conn, time.Now().Add(-time.Minute)); err != nil {
+		t.Errorf("TestOnBorrow() error = %v", err)
+	}
+	if pool := newPool(&RedisConfig{HealthCheckInterval: -1}, nil); pool.TestOnBorrow != nil {
+		t.Errorf("newPool() TestOnBorrow = not nil, want nil")
+	}
+}
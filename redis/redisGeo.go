@@ -0,0 +1,387 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis 地理位置操作
+package redis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 距离单位
+const (
+	GeoUnitM  = "m"
+	GeoUnitKM = "km"
+	GeoUnitMI = "mi"
+	GeoUnitFT = "ft"
+)
+
+// 搜索结果的排序方式
+const (
+	GeoSortAsc  = "asc"
+	GeoSortDesc = "desc"
+)
+
+// GeoAddStructs 每条 GEOADD 命令包含的最大位置数
+const geoBatchSize = 500
+
+// 地理位置
+type GeoLocation struct {
+	// 成员名称
+	Name string
+	// 经度
+	Longitude float64
+	// 纬度
+	Latitude float64
+	// 到搜索中心的距离，单位与查询的 Unit 一致，只在 GeoSearchQuery.WithDist 为 true 时有值
+	Dist float64
+}
+
+// GEOSEARCH 查询条件
+type GeoSearchQuery struct {
+	// 以已有成员为中心，为空时使用 Longitude、Latitude
+	Member string
+	// 中心点经度
+	Longitude float64
+	// 中心点纬度
+	Latitude float64
+	// 半径，大于 0 时按圆形区域搜索
+	Radius float64
+	// 矩形区域的宽、高，Radius 为 0 时按以中心点为中心的矩形区域搜索
+	Width  float64
+	Height float64
+	// 距离单位，可选值：m|km|mi|ft
+	// 默认值：m
+	Unit string
+	// 按距离排序，可选值：asc|desc，为空时不排序
+	Sort string
+	// 返回的最大数量，小于等于 0 时不限制
+	Count int
+	// 为 true 时返回经纬度
+	WithCoord bool
+	// 为 true 时返回到中心的距离
+	WithDist bool
+}
+
+// 添加地理位置，返回新增成员的数量，已存在的成员会更新位置
+func (r *Redis) GeoAdd(key string, locations ...*GeoLocation) (int, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	if len(locations) == 0 {
+		return 0, fmt.Errorf("locations 不能为空")
+	}
+	args := redis.Args{}.Add(key)
+	for _, location := range locations {
+		if location == nil || utils.IsEmpty(location.Name) {
+			return 0, fmt.Errorf("location name 不能为空")
+		}
+		args = args.Add(location.Longitude, location.Latitude, location.Name)
+	}
+	return redis.Int(r.do("geoadd", args...))
+}
+
+// 从结构体切片批量添加地理位置，返回新增成员的数量
+// items 为结构体或结构体指针的切片，字段通过 geo 标签指定，例如：
+//
+//	type Store struct {
+//		Id        int64   `geo:"name"`
+//		Longitude float64 `geo:"longitude"`
+//		Latitude  float64 `geo:"latitude"`
+//	}
+//
+// 数据量较大时分多条 GEOADD 执行，中途出错时已执行的部分不会回滚
+func (r *Redis) GeoAddStructs(key string, items interface{}) (int, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	locations, err := geoLocations(items)
+	if err != nil {
+		return 0, err
+	}
+	if len(locations) == 0 {
+		return 0, fmt.Errorf("items 不能为空")
+	}
+	added := 0
+	for start := 0; start < len(locations); start += geoBatchSize {
+		end := start + geoBatchSize
+		if end > len(locations) {
+			end = len(locations)
+		}
+		n, err := r.GeoAdd(key, locations[start:end]...)
+		if err != nil {
+			return added, err
+		}
+		added += n
+	}
+	return added, nil
+}
+
+// 获取两个成员之间的距离，unit 为空时单位为米，任一成员不存在时返回 ErrNotFound
+func (r *Redis) GeoDist(key string, member1 string, member2 string, unit string) (float64, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	if unit == "" {
+		unit = GeoUnitM
+	}
+	if err := validateGeoUnit(unit); err != nil {
+		return 0, err
+	}
+	reply, err := r.do("geodist", key, member1, member2, unit)
+	if reply == nil && err == nil {
+		return 0, ErrNotFound
+	}
+	return redis.Float64(reply, err)
+}
+
+// 获取成员的经纬度，结果与 members 一一对应，成员不存在时为 nil
+func (r *Redis) GeoPos(key string, members ...string) ([]*GeoLocation, error) {
+	if utils.IsEmpty(key) {
+		return nil, fmt.Errorf("key 不能为空")
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("members 不能为空")
+	}
+	values, err := redis.Values(r.do("geopos", redis.Args{}.Add(key).AddFlat(members)...))
+	if err != nil {
+		return nil, err
+	}
+	locations := make([]*GeoLocation, len(values))
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		location := &GeoLocation{Name: members[i]}
+		if err := scanGeoCoord(value, location); err != nil {
+			return nil, err
+		}
+		locations[i] = location
+	}
+	return locations, nil
+}
+
+// 搜索圆形或矩形区域内的成员，需要 redis 6.2 及以上版本
+func (r *Redis) GeoSearch(key string, query *GeoSearchQuery) ([]*GeoLocation, error) {
+	if utils.IsEmpty(key) {
+		return nil, fmt.Errorf("key 不能为空")
+	}
+	args, err := query.args()
+	if err != nil {
+		return nil, err
+	}
+	values, err := redis.Values(r.do("geosearch", redis.Args{}.Add(key).AddFlat(args)...))
+	if err != nil {
+		return nil, err
+	}
+	locations := make([]*GeoLocation, 0, len(values))
+	for _, value := range values {
+		location, err := query.parse(value)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
+
+// 转换为 GEOSEARCH 的参数
+func (q *GeoSearchQuery) args() ([]interface{}, error) {
+	if q == nil {
+		return nil, fmt.Errorf("query 不能为空")
+	}
+	unit := q.Unit
+	if unit == "" {
+		unit = GeoUnitM
+	}
+	if err := validateGeoUnit(unit); err != nil {
+		return nil, err
+	}
+	var args redis.Args
+	if q.Member != "" {
+		args = args.Add("frommember", q.Member)
+	} else {
+		args = args.Add("fromlonlat", q.Longitude, q.Latitude)
+	}
+	switch {
+	case q.Radius > 0:
+		args = args.Add("byradius", q.Radius, unit)
+	case q.Width > 0 && q.Height > 0:
+		args = args.Add("bybox", q.Width, q.Height, unit)
+	default:
+		return nil, fmt.Errorf("radius 或 width、height 必须大于 0")
+	}
+	switch strings.ToLower(q.Sort) {
+	case "":
+	case GeoSortAsc, GeoSortDesc:
+		args = args.Add(q.Sort)
+	default:
+		return nil, fmt.Errorf("sort 只能是 asc 或 desc: %s", q.Sort)
+	}
+	if q.Count > 0 {
+		args = args.Add("count", q.Count)
+	}
+	if q.WithCoord {
+		args = args.Add("withcoord")
+	}
+	if q.WithDist {
+		args = args.Add("withdist")
+	}
+	return args, nil
+}
+
+// 解析 GEOSEARCH 返回的单个结果
+// 没有 WITHCOORD、WITHDIST 时为成员名称，否则为 [name, dist?, [longitude, latitude]?]
+func (q *GeoSearchQuery) parse(value interface{}) (*GeoLocation, error) {
+	if !q.WithCoord && !q.WithDist {
+		name, err := redis.String(value, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &GeoLocation{Name: name}, nil
+	}
+	fields, err := redis.Values(value, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("redis geosearch 返回值格式错误")
+	}
+	location := &GeoLocation{}
+	if location.Name, err = redis.String(fields[0], nil); err != nil {
+		return nil, err
+	}
+	fields = fields[1:]
+	if q.WithDist {
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("redis geosearch 返回值格式错误")
+		}
+		if location.Dist, err = redis.Float64(fields[0], nil); err != nil {
+			return nil, err
+		}
+		fields = fields[1:]
+	}
+	if q.WithCoord {
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("redis geosearch 返回值格式错误")
+		}
+		if err := scanGeoCoord(fields[0], location); err != nil {
+			return nil, err
+		}
+	}
+	return location, nil
+}
+
+// 解析 [longitude, latitude]
+func scanGeoCoord(value interface{}, location *GeoLocation) error {
+	coord, err := redis.Float64s(value, nil)
+	if err != nil {
+		return err
+	}
+	if len(coord) != 2 {
+		return fmt.Errorf("redis 经纬度格式错误: %v", coord)
+	}
+	location.Longitude, location.Latitude = coord[0], coord[1]
+	return nil
+}
+
+func validateGeoUnit(unit string) error {
+	switch unit {
+	case GeoUnitM, GeoUnitKM, GeoUnitMI, GeoUnitFT:
+		return nil
+	}
+	return fmt.Errorf("unit 只能是 m、km、mi 或 ft: %s", unit)
+}
+
+// 通过 geo 标签从结构体切片中读取地理位置
+func geoLocations(items interface{}) ([]*GeoLocation, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("items 必须是切片: %T", items)
+	}
+	locations := make([]*GeoLocation, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i)
+		for item.Kind() == reflect.Ptr {
+			if item.IsNil() {
+				return nil, fmt.Errorf("items[%d] 不能为空", i)
+			}
+			item = item.Elem()
+		}
+		if item.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("items 的元素必须是结构体: %s", item.Type())
+		}
+		location, err := geoLocation(item)
+		if err != nil {
+			return nil, fmt.Errorf("items[%d]: %v", i, err)
+		}
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
+
+func geoLocation(item reflect.Value) (*GeoLocation, error) {
+	location := &GeoLocation{}
+	var hasName, hasLongitude, hasLatitude bool
+	t := item.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("geo")
+		if tag == "" {
+			continue
+		}
+		if t.Field(i).PkgPath != "" {
+			return nil, fmt.Errorf("geo 标签字段必须是导出的: %s", t.Field(i).Name)
+		}
+		field := item.Field(i)
+		switch tag {
+		case "name":
+			location.Name = fmt.Sprint(field.Interface())
+			hasName = true
+		case "longitude":
+			f, err := geoFloat(field)
+			if err != nil {
+				return nil, err
+			}
+			location.Longitude = f
+			hasLongitude = true
+		case "latitude":
+			f, err := geoFloat(field)
+			if err != nil {
+				return nil, err
+			}
+			location.Latitude = f
+			hasLatitude = true
+		}
+	}
+	if !hasName || !hasLongitude || !hasLatitude {
+		return nil, fmt.Errorf("%s 缺少 geo:\"name\"、geo:\"longitude\" 或 geo:\"latitude\" 标签", t)
+	}
+	if utils.IsEmpty(location.Name) {
+		return nil, fmt.Errorf("name 不能为空")
+	}
+	return location, nil
+}
+
+func geoFloat(field reflect.Value) (float64, error) {
+	switch field.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return field.Float(), nil
+	}
+	return 0, fmt.Errorf("经纬度字段必须是浮点数: %s", field.Type())
+}
@@ -0,0 +1,264 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis 地理位置操作
+package redis
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+type testStore struct {
+	Id        int64   `geo:"name"`
+	Longitude float64 `geo:"longitude"`
+	Latitude  float64 `geo:"latitude"`
+	Address   string
+}
+
+func TestGeoAdd(t *testing.T) {
+	redisTool.Del("geo")
+	defer redisTool.Del("geo")
+	tests := []struct {
+		name      string
+		key       string
+		locations []*GeoLocation
+		want      int
+		wantErr   bool
+	}{
+		{
+			name: "all",
+			key:  "geo",
+			locations: []*GeoLocation{
+				{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556},
+				{Name: "Catania", Longitude: 15.087269, Latitude: 37.502669},
+			},
+			want: 2,
+		}, {
+			name:      "update",
+			key:       "geo",
+			locations: []*GeoLocation{{Name: "Palermo", Longitude: 13.4, Latitude: 38.1}},
+			want:      0,
+		}, {
+			name:      "key nil",
+			key:       "",
+			locations: []*GeoLocation{{Name: "Palermo"}},
+			wantErr:   true,
+		}, {
+			name:    "locations nil",
+			key:     "geo",
+			wantErr: true,
+		}, {
+			name:      "name nil",
+			key:       "geo",
+			locations: []*GeoLocation{{Longitude: 13.4, Latitude: 38.1}},
+			wantErr:   true,
+		}, {
+			name:      "invalid",
+			key:       "geo",
+			locations: []*GeoLocation{{Name: "x", Longitude: 200, Latitude: 38.1}},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisTool.GeoAdd(tt.key, tt.locations...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GeoAdd() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GeoAdd() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeoAddStructs(t *testing.T) {
+	redisTool.Del("geo:stores")
+	defer redisTool.Del("geo:stores")
+	stores := make([]*testStore, geoBatchSize+10)
+	for i := range stores {
+		stores[i] = &testStore{Id: int64(i + 1), Longitude: 116 + float64(i)/1000, Latitude: 39.9}
+	}
+	tests := []struct {
+		name    string
+		items   interface{}
+		want    int
+		wantErr bool
+	}{
+		{
+			name:  "pointers",
+			items: stores,
+			want:  len(stores),
+		}, {
+			name:  "values",
+			items: []testStore{{Id: 100000, Longitude: 116.3, Latitude: 39.9}},
+			want:  1,
+		}, {
+			name:    "not slice",
+			items:   testStore{},
+			wantErr: true,
+		}, {
+			name:    "empty",
+			items:   []testStore{},
+			wantErr: true,
+		}, {
+			name:    "no tag",
+			items:   []struct{ Name string }{{Name: "a"}},
+			wantErr: true,
+		}, {
+			name: "not float",
+			items: []struct {
+				Name      string `geo:"name"`
+				Longitude string `geo:"longitude"`
+				Latitude  string `geo:"latitude"`
+			}{{Name: "a", Longitude: "116", Latitude: "39"}},
+			wantErr: true,
+		}, {
+			name:    "nil item",
+			items:   []*testStore{nil},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisTool.GeoAddStructs("geo:stores", tt.items)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GeoAddStructs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GeoAddStructs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeoDistAndPos(t *testing.T) {
+	redisTool.Del("geo")
+	defer redisTool.Del("geo")
+	redisTool.GeoAdd("geo", &GeoLocation{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556},
+		&GeoLocation{Name: "Catania", Longitude: 15.087269, Latitude: 37.502669})
+
+	distTests := []struct {
+		name    string
+		member  string
+		unit    string
+		want    float64
+		wantErr error
+	}{
+		{name: "m", member: "Catania", want: 166274.1516},
+		{name: "km", member: "Catania", unit: GeoUnitKM, want: 166.2742},
+		{name: "not exist", member: "Rome", wantErr: ErrNotFound},
+	}
+	for _, tt := range distTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisTool.GeoDist("geo", "Palermo", tt.member, tt.unit)
+			if err != tt.wantErr {
+				t.Errorf("GeoDist() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GeoDist() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := redisTool.GeoDist("geo", "Palermo", "Catania", "yard"); err == nil {
+		t.Errorf("GeoDist() unit error = nil, want error")
+	}
+
+	got, err := redisTool.GeoPos("geo", "Palermo", "Rome")
+	if err != nil {
+		t.Fatalf("GeoPos() error = %v", err)
+	}
+	if len(got) != 2 || got[0] == nil || got[1] != nil {
+		t.Fatalf("GeoPos() = %v, want [Palermo, nil]", got)
+	}
+	if math.Abs(got[0].Longitude-13.361389) > 1e-5 || math.Abs(got[0].Latitude-38.115556) > 1e-5 {
+		t.Errorf("GeoPos() = %+v, want about 13.361389, 38.115556", got[0])
+	}
+}
+
+func TestGeoSearch(t *testing.T) {
+	redisTool.Del("geo")
+	defer redisTool.Del("geo")
+	redisTool.GeoAdd("geo", &GeoLocation{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556},
+		&GeoLocation{Name: "Catania", Longitude: 15.087269, Latitude: 37.502669})
+	tests := []struct {
+		name    string
+		query   *GeoSearchQuery
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "radius",
+			query: &GeoSearchQuery{Longitude: 15, Latitude: 37, Radius: 200, Unit: GeoUnitKM, Sort: GeoSortAsc},
+			want:  []string{"Catania", "Palermo"},
+		}, {
+			name:  "radius desc count",
+			query: &GeoSearchQuery{Longitude: 15, Latitude: 37, Radius: 200, Unit: GeoUnitKM, Sort: GeoSortDesc, Count: 1},
+			want:  []string{"Palermo"},
+		}, {
+			name:  "member",
+			query: &GeoSearchQuery{Member: "Palermo", Radius: 100, Unit: GeoUnitKM},
+			want:  []string{"Palermo"},
+		}, {
+			name:  "box",
+			query: &GeoSearchQuery{Longitude: 15, Latitude: 37, Width: 200, Height: 200, Unit: GeoUnitKM},
+			want:  []string{"Catania"},
+		}, {
+			name:    "query nil",
+			wantErr: true,
+		}, {
+			name:    "no shape",
+			query:   &GeoSearchQuery{Longitude: 15, Latitude: 37},
+			wantErr: true,
+		}, {
+			name:    "sort",
+			query:   &GeoSearchQuery{Longitude: 15, Latitude: 37, Radius: 1, Sort: "near"},
+			wantErr: true,
+		}, {
+			name:    "unit",
+			query:   &GeoSearchQuery{Longitude: 15, Latitude: 37, Radius: 1, Unit: "yard"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisTool.GeoSearch("geo", tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GeoSearch() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var names []string
+			for _, location := range got {
+				names = append(names, location.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("GeoSearch() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+
+	got, err := redisTool.GeoSearch("geo", &GeoSearchQuery{Longitude: 15, Latitude: 37, Radius: 200,
+		Unit: GeoUnitKM, Sort: GeoSortAsc, WithCoord: true, WithDist: true})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("GeoSearch() = %v, %v, want 2 locations", got, err)
+	}
+	if got[0].Dist != 56.4413 || math.Abs(got[0].Longitude-15.087269) > 1e-5 || math.Abs(got[0].Latitude-37.502669) > 1e-5 {
+		t.Errorf("GeoSearch() = %+v, want Catania at 56.4413km", got[0])
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis hash 操作
+package redis
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 获取 hash 中 field 对应的值，field 不存在时返回空字符串
+func (r *Redis) HGet(key string, field string) (string, error) {
+	if utils.IsEmpty(key) || utils.IsEmpty(field) {
+		return "", fmt.Errorf("key or field 不能为空")
+	}
+	result, err := r.do("hget", key, field)
+	if result == nil && err == nil {
+		return "", nil
+	}
+	return redis.String(result, err)
+}
+
+// 设置 hash 中 field 的值
+func (r *Redis) HSet(key string, field string, value string) error {
+	if utils.IsEmpty(key) || utils.IsEmpty(field) {
+		return fmt.Errorf("key or field 不能为空")
+	}
+	_, err := r.do("hset", key, field, value)
+	return err
+}
+
+// 批量设置 hash 中多个 field 的值
+func (r *Redis) HMSet(key string, fields map[string]string) error {
+	if utils.IsEmpty(key) {
+		return fmt.Errorf("key 不能为空")
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("fields 不能为空")
+	}
+	_, err := r.do("hmset", redis.Args{}.Add(key).AddFlat(fields)...)
+	return err
+}
+
+// 获取 hash 中所有的 field 和值
+func (r *Redis) HGetAll(key string) (map[string]string, error) {
+	if utils.IsEmpty(key) {
+		return nil, fmt.Errorf("key 不能为空")
+	}
+	return redis.StringMap(r.do("hgetall", key))
+}
+
+// 删除 hash 中的 field，返回实际删除的数量
+func (r *Redis) HDel(key string, fields ...string) (int, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("fields 不能为空")
+	}
+	return redis.Int(r.do("hdel", redis.Args{}.Add(key).AddFlat(fields)...))
+}
+
+// 判断 hash 中 field 是否存在
+func (r *Redis) HExists(key string, field string) (bool, error) {
+	if utils.IsEmpty(key) || utils.IsEmpty(field) {
+		return false, fmt.Errorf("key or field 不能为空")
+	}
+	return redis.Bool(r.do("hexists", key, field))
+}
+
+// 将 hash 读取到结构体中，dest 必须是结构体指针
+// 字段名通过 `redis:"name"` 标签指定，未指定时使用字段名
+func (r *Redis) HScanStruct(key string, dest interface{}) error {
+	if utils.IsEmpty(key) {
+		return fmt.Errorf("key 不能为空")
+	}
+	values, err := redis.Values(r.do("hgetall", key))
+	if err != nil {
+		return err
+	}
+	return redis.ScanStruct(values, dest)
+}
+
+// 将结构体写入 hash，src 可以是结构体或结构体指针
+// 字段名通过 `redis:"name"` 标签指定，`redis:",omitempty"` 忽略零值字段
+func (r *Redis) HSetStruct(key string, src interface{}) error {
+	if utils.IsEmpty(key) {
+		return fmt.Errorf("key 不能为空")
+	}
+	args := redis.Args{}.Add(key).AddFlat(src)
+	if len(args) < 3 {
+		return fmt.Errorf("src 不是结构体或没有可写入的字段")
+	}
+	_, err := r.do("hmset", args...)
+	return err
+}
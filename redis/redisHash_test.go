@@ -0,0 +1,177 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis hash 操作
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testUser struct {
+	Name string `redis:"name"`
+	Age  int    `redis:"age"`
+	Vip  bool   `redis:"vip"`
+}
+
+func TestHSet(t *testing.T) {
+	type args struct {
+		key   string
+		field string
+		value string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name:    "all",
+			args:    args{key: "hash", field: "name", value: "xiaoliu"},
+			wantErr: false,
+		}, {
+			name:    "key nil",
+			args:    args{key: "", field: "name", value: "xiaoliu"},
+			wantErr: true,
+		}, {
+			name:    "field nil",
+			args:    args{key: "hash", field: "", value: "xiaoliu"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := redisTool.HSet(tt.args.key, tt.args.field, tt.args.value); (err != nil) != tt.wantErr {
+				t.Errorf("HSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHGet(t *testing.T) {
+	redisTool.HSet("hash", "name", "xiaoliu")
+	type args struct {
+		key   string
+		field string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		wantValue string
+		wantErr   bool
+	}{
+		{
+			name:      "all",
+			args:      args{key: "hash", field: "name"},
+			wantValue: "xiaoliu",
+			wantErr:   false,
+		}, {
+			name:      "key nil",
+			args:      args{key: "", field: "name"},
+			wantValue: "",
+			wantErr:   true,
+		}, {
+			name:      "field not exist",
+			args:      args{key: "hash", field: "name12345"},
+			wantValue: "",
+			wantErr:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotValue, err := redisTool.HGet(tt.args.key, tt.args.field)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("HGet() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotValue != tt.wantValue {
+				t.Errorf("HGet() = %v, want %v", gotValue, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestHMSetAndHGetAll(t *testing.T) {
+	redisTool.Del("hash:all")
+	fields := map[string]string{"name": "xiaoliu", "age": "20"}
+	if err := redisTool.HMSet("hash:all", fields); err != nil {
+		t.Fatalf("HMSet() error = %v", err)
+	}
+	got, err := redisTool.HGetAll("hash:all")
+	if err != nil {
+		t.Fatalf("HGetAll() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, fields) {
+		t.Errorf("HGetAll() = %v, want %v", got, fields)
+	}
+	if n, err := redisTool.HDel("hash:all", "name", "name12345"); err != nil || n != 1 {
+		t.Errorf("HDel() = %v, %v, want 1, nil", n, err)
+	}
+	if ok, err := redisTool.HExists("hash:all", "name"); err != nil || ok {
+		t.Errorf("HExists() = %v, %v, want false, nil", ok, err)
+	}
+	if err := redisTool.HMSet("hash:all", nil); err == nil {
+		t.Errorf("HMSet() error = nil, wantErr true")
+	}
+}
+
+func TestHSetStruct(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		src     interface{}
+		wantErr bool
+	}{
+		{
+			name: "all",
+			key:  "hash:user",
+			src:  &testUser{Name: "xiaoliu", Age: 20, Vip: true},
+		}, {
+			name:    "key nil",
+			key:     "",
+			src:     &testUser{Name: "xiaoliu"},
+			wantErr: true,
+		}, {
+			name:    "src not struct",
+			key:     "hash:user",
+			src:     "xiaoliu",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := redisTool.HSetStruct(tt.key, tt.src); (err != nil) != tt.wantErr {
+				t.Errorf("HSetStruct() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHScanStruct(t *testing.T) {
+	want := testUser{Name: "xiaoliu", Age: 20, Vip: true}
+	if err := redisTool.HSetStruct("hash:user", want); err != nil {
+		t.Fatalf("HSetStruct() error = %v", err)
+	}
+	var got testUser
+	if err := redisTool.HScanStruct("hash:user", &got); err != nil {
+		t.Fatalf("HScanStruct() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("HScanStruct() = %v, want %v", got, want)
+	}
+	if err := redisTool.HScanStruct("", &got); err == nil {
+		t.Errorf("HScanStruct() error = nil, wantErr true")
+	}
+}
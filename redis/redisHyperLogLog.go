@@ -0,0 +1,68 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis HyperLogLog 基数统计
+package redis
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 向 HyperLogLog 添加元素，基数估算值发生变化时返回 true
+func (r *Redis) PFAdd(key string, elements ...string) (bool, error) {
+	if utils.IsEmpty(key) {
+		return false, fmt.Errorf("key 不能为空")
+	}
+	if len(elements) == 0 {
+		return false, fmt.Errorf("elements 不能为空")
+	}
+	return redis.Bool(r.do("pfadd", redis.Args{}.Add(key).AddFlat(elements)...))
+}
+
+// 获取基数估算值（标准误差 0.81%），多个 key 时返回并集的基数
+// 集群模式下多个 key 位于不同 slot 时通过临时 key 合并统计
+func (r *Redis) PFCount(keys ...string) (int64, error) {
+	if err := validateKeys(keys); err != nil {
+		return 0, err
+	}
+	return redis.Int64(r.do("pfcount", redis.Args{}.AddFlat(keys)...))
+}
+
+// 将多个 HyperLogLog 合并到 destKey，destKey 已存在时一并合并
+// 集群模式下所有 key 需要在同一个 slot
+func (r *Redis) PFMerge(destKey string, sourceKeys ...string) error {
+	if utils.IsEmpty(destKey) {
+		return fmt.Errorf("destKey 不能为空")
+	}
+	if err := validateKeys(sourceKeys); err != nil {
+		return err
+	}
+	_, err := r.do("pfmerge", redis.Args{}.Add(destKey).AddFlat(sourceKeys)...)
+	return err
+}
+
+func validateKeys(keys []string) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("keys 不能为空")
+	}
+	for _, key := range keys {
+		if utils.IsEmpty(key) {
+			return fmt.Errorf("key 不能为空")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis HyperLogLog 基数统计
+package redis
+
+import (
+	"testing"
+)
+
+func TestPFAdd(t *testing.T) {
+	requireRedisServer(t)
+	redisTool.Del("hll")
+	tests := []struct {
+		name     string
+		key      string
+		elements []string
+		want     bool
+		wantErr  bool
+	}{
+		{
+			name:     "all",
+			key:      "hll",
+			elements: []string{"a", "b"},
+			want:     true,
+		}, {
+			name:     "exists",
+			key:      "hll",
+			elements: []string{"a"},
+			want:     false,
+		}, {
+			name:     "key nil",
+			key:      "",
+			elements: []string{"a"},
+			wantErr:  true,
+		}, {
+			name:    "elements nil",
+			key:     "hll",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisTool.PFAdd(tt.key, tt.elements...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PFAdd() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("PFAdd() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	redisTool.Del("hll")
+}
+
+func TestPFCountAndMerge(t *testing.T) {
+	requireRedisServer(t)
+	redisTool.MDel("hll:1", "hll:2", "hll:all")
+	redisTool.PFAdd("hll:1", "a", "b", "c")
+	redisTool.PFAdd("hll:2", "c", "d")
+	if err := redisTool.PFMerge("hll:all", "hll:1", "hll:2"); err != nil {
+		t.Fatalf("PFMerge() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		keys    []string
+		want    int64
+		wantErr bool
+	}{
+		{
+			name: "single",
+			keys: []string{"hll:1"},
+			want: 3,
+		}, {
+			name: "union",
+			keys: []string{"hll:1", "hll:2"},
+			want: 4,
+		}, {
+			name: "merged",
+			keys: []string{"hll:all"},
+			want: 4,
+		}, {
+			name: "not exist",
+			keys: []string{"hll:none"},
+			want: 0,
+		}, {
+			name:    "keys nil",
+			wantErr: true,
+		}, {
+			name:    "key nil",
+			keys:    []string{""},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisTool.PFCount(tt.keys...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PFCount() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("PFCount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if err := redisTool.PFMerge("", "hll:1"); err == nil {
+		t.Errorf("PFMerge() error = nil, want error")
+	}
+	redisTool.MDel("hll:1", "hll:2", "hll:all")
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis list 操作
+package redis
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 从列表头部插入，返回插入后列表的长度
+func (r *Redis) LPush(key string, values ...string) (int, error) {
+	return r.push("lpush", key, values)
+}
+
+// 从列表尾部插入，返回插入后列表的长度
+func (r *Redis) RPush(key string, values ...string) (int, error) {
+	return r.push("rpush", key, values)
+}
+
+// 从列表头部弹出，列表为空时返回空字符串
+func (r *Redis) LPop(key string) (string, error) {
+	return r.pop("lpop", key)
+}
+
+// 从列表尾部弹出，列表为空时返回空字符串
+func (r *Redis) RPop(key string) (string, error) {
+	return r.pop("rpop", key)
+}
+
+// 获取列表指定区间内的元素，stop 为 -1 表示最后一个元素
+func (r *Redis) LRange(key string, start int, stop int) ([]string, error) {
+	if utils.IsEmpty(key) {
+		return nil, fmt.Errorf("key 不能为空")
+	}
+	return redis.Strings(r.do("lrange", key, start, stop))
+}
+
+// 获取列表长度
+func (r *Redis) LLen(key string) (int, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	return redis.Int(r.do("llen", key))
+}
+
+func (r *Redis) push(commandName string, key string, values []string) (int, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	if len(values) == 0 {
+		return 0, fmt.Errorf("values 不能为空")
+	}
+	return redis.Int(r.do(commandName, redis.Args{}.Add(key).AddFlat(values)...))
+}
+
+func (r *Redis) pop(commandName string, key string) (string, error) {
+	if utils.IsEmpty(key) {
+		return "", fmt.Errorf("key 不能为空")
+	}
+	result, err := r.do(commandName, key)
+	if result == nil && err == nil {
+		return "", nil
+	}
+	return redis.String(result, err)
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis list 操作
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPushAndPop(t *testing.T) {
+	redisTool.Del("list")
+	if n, err := redisTool.RPush("list", "b", "c"); err != nil || n != 2 {
+		t.Fatalf("RPush() = %v, %v, want 2, nil", n, err)
+	}
+	if n, err := redisTool.LPush("list", "a"); err != nil || n != 3 {
+		t.Fatalf("LPush() = %v, %v, want 3, nil", n, err)
+	}
+	got, err := redisTool.LRange("list", 0, -1)
+	if err != nil {
+		t.Fatalf("LRange() error = %v", err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LRange() = %v, want %v", got, want)
+	}
+	if v, err := redisTool.LPop("list"); err != nil || v != "a" {
+		t.Errorf("LPop() = %v, %v, want a, nil", v, err)
+	}
+	if v, err := redisTool.RPop("list"); err != nil || v != "c" {
+		t.Errorf("RPop() = %v, %v, want c, nil", v, err)
+	}
+	if n, err := redisTool.LLen("list"); err != nil || n != 1 {
+		t.Errorf("LLen() = %v, %v, want 1, nil", n, err)
+	}
+}
+
+func TestPop(t *testing.T) {
+	redisTool.Del("list:empty")
+	tests := []struct {
+		name      string
+		key       string
+		wantValue string
+		wantErr   bool
+	}{
+		{
+			name:      "list empty",
+			key:       "list:empty",
+			wantValue: "",
+			wantErr:   false,
+		}, {
+			name:      "key nil",
+			key:       "",
+			wantValue: "",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotValue, err := redisTool.RPop(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RPop() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotValue != tt.wantValue {
+				t.Errorf("RPop() = %v, want %v", gotValue, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestPush(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		values  []string
+		wantErr bool
+	}{
+		{
+			name:    "key nil",
+			key:     "",
+			values:  []string{"a"},
+			wantErr: true,
+		}, {
+			name:    "values nil",
+			key:     "list",
+			values:  nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := redisTool.LPush(tt.key, tt.values...); (err != nil) != tt.wantErr {
+				t.Errorf("LPush() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
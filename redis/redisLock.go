@@ -0,0 +1,377 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis分布式锁
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 当前锁未被持有或已过期
+var ErrLockNotHeld = errors.New("redis lock not held")
+
+const (
+	// 默认锁过期时间
+	defaultLockExpire = 30 * time.Second
+	// 默认获取锁的重试间隔
+	defaultLockRetryDelay = 100 * time.Millisecond
+	// 时钟漂移系数，参考 redlock 算法
+	lockClockDriftFactor = 0.01
+	// 单个节点加锁、续期、释放的最长等待时间，实际取该值与 1/10 租约中较小的一个
+	lockMaxNodeTimeout = time.Second
+)
+
+// 持有者一致时才删除锁
+var unlockScript = NewScript(1, `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+else
+	return 0
+end`)
+
+// 持有者一致时才续期
+var renewScript = NewScript(1, `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+else
+	return 0
+end`)
+
+// 分布式锁
+// 单节点模式通过 Redis.NewLock 创建，多节点 redlock 模式通过 Redlock.NewLock 创建
+type Lock struct {
+	pools      []*redis.Pool
+	key        string
+	expire     time.Duration
+	retryDelay time.Duration
+
+	mu     sync.Mutex
+	token  string
+	cancel context.CancelFunc
+	done   chan struct{}
+	// 锁丢失或释放后关闭，见 Done
+	lost chan struct{}
+}
+
+// 未持有锁时 Done 返回的 channel
+var closedChan = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// 多节点 redlock，各节点相互独立
+type Redlock struct {
+	pools []*redis.Pool
+}
+
+// 创建单节点锁，expire 为锁的租约时间，持有期间由看门狗自动续期，key 会加上当前的前缀
+func (r *Redis) NewLock(key string, expire time.Duration) *Lock {
+	return newLock([]*redis.Pool{r.RedisPool}, r.prefix+key, expire)
+}
+
+// 根据多个独立节点的配置创建 redlock
+func NewRedlock(redisConfigs ...*RedisConfig) (*Redlock, error) {
+	if len(redisConfigs) == 0 {
+		return nil, fmt.Errorf("redisConfigs 不能为空")
+	}
+	pools := make([]*redis.Pool, 0, len(redisConfigs))
+	for _, redisConfig := range redisConfigs {
+		r, err := NewRedis(redisConfig)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, r.RedisPool)
+	}
+	return &Redlock{pools: pools}, nil
+}
+
+// 创建多节点锁，超过半数节点加锁成功才视为持有
+func (rl *Redlock) NewLock(key string, expire time.Duration) *Lock {
+	return newLock(rl.pools, key, expire)
+}
+
+func newLock(pools []*redis.Pool, key string, expire time.Duration) *Lock {
+	if expire <= 0 {
+		expire = defaultLockExpire
+	}
+	return &Lock{pools: pools, key: key, expire: expire, retryDelay: defaultLockRetryDelay}
+}
+
+// 设置 Lock 获取失败后的重试间隔
+func (l *Lock) SetRetryDelay(retryDelay time.Duration) {
+	if retryDelay > 0 {
+		l.retryDelay = retryDelay
+	}
+}
+
+// 尝试加锁一次，锁被占用时返回 false；节点异常导致无法达到法定数量时返回错误
+// ctx 取消后看门狗停止续期，锁将在租约到期后自动释放
+func (l *Lock) TryLock(ctx context.Context) (bool, error) {
+	if utils.IsEmpty(l.key) {
+		return false, fmt.Errorf("key 不能为空")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clearLost()
+	if l.token != "" {
+		return false, fmt.Errorf("redis lock 已被当前实例持有: %s", l.key)
+	}
+	token, err := randomToken()
+	if err != nil {
+		return false, err
+	}
+	ok, err := l.acquire(ctx, token)
+	if err != nil || !ok {
+		return false, err
+	}
+	l.token = token
+	l.startWatchdog(ctx, token)
+	return true, nil
+}
+
+// 阻塞加锁，直到成功、节点异常或 ctx 结束
+func (l *Lock) Lock(ctx context.Context) error {
+	for {
+		ok, err := l.TryLock(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.retryDelay):
+		}
+	}
+}
+
+// 锁丢失（看门狗续期失败）或释放后被关闭，持有者应在关闭后立即停止依赖锁的工作
+// 未持有锁时返回已关闭的 channel
+func (l *Lock) Done() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.token == "" {
+		return closedChan
+	}
+	return l.lost
+}
+
+// 释放锁，只会删除自己持有的锁；锁已丢失时返回 ErrLockNotHeld
+func (l *Lock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clearLost()
+	if l.token == "" {
+		return ErrLockNotHeld
+	}
+	l.stopWatchdog()
+	select {
+	case <-l.lost:
+	default:
+		close(l.lost)
+	}
+	token := l.token
+	l.token = ""
+
+	released, lastErr := l.evalAll(context.Background(), unlockScript, l.key, token)
+	if released < l.quorum() {
+		if lastErr != nil {
+			return lastErr
+		}
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// 在所有节点上并行尝试加锁，未达到法定数量或耗时超过租约时在所有节点上释放
+// 正常应答的节点不足法定数量时返回最后一个节点错误，与锁被占用区分
+func (l *Lock) acquire(ctx context.Context, token string) (bool, error) {
+	start := time.Now()
+	type result struct {
+		ok  bool
+		err error
+	}
+	results := make(chan result, len(l.pools))
+	for _, pool := range l.pools {
+		go func(pool *redis.Pool) {
+			ok, err := l.setNX(ctx, pool, token)
+			results <- result{ok: ok, err: err}
+		}(pool)
+	}
+	acquired, failed := 0, 0
+	var lastErr error
+	for range l.pools {
+		r := <-results
+		if r.err != nil {
+			failed++
+			lastErr = r.err
+			continue
+		}
+		if r.ok {
+			acquired++
+		}
+	}
+	drift := time.Duration(float64(l.expire)*lockClockDriftFactor) + 2*time.Millisecond
+	validity := l.expire - time.Since(start) - drift
+	if acquired >= l.quorum() && validity > 0 {
+		return true, nil
+	}
+	// 超时的节点可能已经加锁成功，同样需要释放
+	l.evalAll(context.Background(), unlockScript, l.key, token)
+	if len(l.pools)-failed < l.quorum() {
+		return false, lastErr
+	}
+	return false, nil
+}
+
+// 加锁，锁已被占用时返回 false
+func (l *Lock) setNX(ctx context.Context, pool *redis.Pool, token string) (ok bool, err error) {
+	err = l.withNode(ctx, pool, func(conn redis.Conn) error {
+		reply, err := redis.String(conn.Do("set", l.key, token, "px", int64(l.expire/time.Millisecond), "nx"))
+		if err == redis.ErrNil {
+			return nil
+		}
+		ok = reply == "OK"
+		return err
+	})
+	return ok, err
+}
+
+func (l *Lock) renew(token string) bool {
+	renewed, _ := l.evalAll(context.Background(), renewScript, l.key, token, int64(l.expire/time.Millisecond))
+	return renewed >= l.quorum()
+}
+
+// 在所有节点上并行执行脚本，返回结果之和及最后一个节点错误
+func (l *Lock) evalAll(ctx context.Context, script *Script, keysAndArgs ...interface{}) (int, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	total := 0
+	var lastErr error
+	for _, pool := range l.pools {
+		wg.Add(1)
+		go func(pool *redis.Pool) {
+			defer wg.Done()
+			var n int
+			err := l.withNode(ctx, pool, func(conn redis.Conn) (err error) {
+				n, err = redis.Int(script.Do(conn, keysAndArgs...))
+				return err
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				lastErr = err
+				return
+			}
+			total += n
+		}(pool)
+	}
+	wg.Wait()
+	return total, lastErr
+}
+
+// 在单个节点上执行 f，获取连接和执行命令的总时间不超过 nodeTimeout
+// 避免个别慢节点拖长加锁耗时，导致获得的锁剩余有效时间过短
+func (l *Lock) withNode(ctx context.Context, pool *redis.Pool, f func(conn redis.Conn) error) error {
+	ctx, cancel := context.WithTimeout(ctx, l.nodeTimeout())
+	defer cancel()
+	conn, err := pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	c := &ctxConn{Conn: conn, ctx: ctx}
+	defer c.Close()
+	return f(c)
+}
+
+func (l *Lock) nodeTimeout() time.Duration {
+	if timeout := l.expire / 10; timeout < lockMaxNodeTimeout {
+		return timeout
+	}
+	return lockMaxNodeTimeout
+}
+
+// 看门狗：每 1/3 租约续期一次，续期失败视为锁已丢失并关闭 lost
+func (l *Lock) startWatchdog(ctx context.Context, token string) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	lost := make(chan struct{})
+	l.cancel = cancel
+	l.done = done
+	l.lost = lost
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(l.expire / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !l.renew(token) {
+					close(lost)
+					return
+				}
+			}
+		}
+	}()
+}
+
+func (l *Lock) stopWatchdog() {
+	if l.cancel != nil {
+		l.cancel()
+		<-l.done
+		l.cancel = nil
+		l.done = nil
+	}
+}
+
+// 看门狗已判定锁丢失时清除持有状态，调用方需持有 l.mu
+func (l *Lock) clearLost() {
+	if l.token == "" {
+		return
+	}
+	select {
+	case <-l.lost:
+		l.stopWatchdog()
+		l.token = ""
+	default:
+	}
+}
+
+func (l *Lock) quorum() int {
+	return len(l.pools)/2 + 1
+}
+
+// 生成随机的持有者标识
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
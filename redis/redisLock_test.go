@@ -0,0 +1,284 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis分布式锁
+package redis
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-tools/redis/redistest"
+)
+
+func TestTryLock(t *testing.T) {
+	requireRedisServer(t)
+	tests := []struct {
+		name    string
+		key     string
+		hold    bool
+		wantOk  bool
+		wantErr bool
+	}{
+		{
+			name:   "all",
+			key:    "lock:all",
+			wantOk: true,
+		}, {
+			name:    "key nil",
+			key:     "",
+			wantErr: true,
+		}, {
+			name:   "lock held",
+			key:    "lock:held",
+			hold:   true,
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.hold {
+				holder := redisTool.NewLock(tt.key, time.Second)
+				if err := holder.Lock(context.Background()); err != nil {
+					t.Fatalf("Lock() error = %v", err)
+				}
+				defer func() {
+					if err := holder.Unlock(); err != nil {
+						t.Errorf("Unlock() error = %v", err)
+					}
+				}()
+			}
+			lock := redisTool.NewLock(tt.key, time.Second)
+			ok, err := lock.TryLock(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TryLock() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if ok != tt.wantOk {
+				t.Errorf("TryLock() = %v, want %v", ok, tt.wantOk)
+			}
+			if ok {
+				if err := lock.Unlock(); err != nil {
+					t.Errorf("Unlock() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestLockContext(t *testing.T) {
+	requireRedisServer(t)
+	holder := redisTool.NewLock("lock:ctx", time.Second)
+	if err := holder.Lock(context.Background()); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer func() {
+		if err := holder.Unlock(); err != nil {
+			t.Errorf("Unlock() error = %v", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := redisTool.NewLock("lock:ctx", time.Second).Lock(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Lock() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// 节点异常时返回错误，不能当作锁被占用
+func TestTryLockServerDown(t *testing.T) {
+	server, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	r, err := NewRedis(&RedisConfig{Address: server.Addr(), MaxIdle: 1, MaxActive: 1})
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	server.Close()
+	lock := r.NewLock("lock:down", time.Second)
+	if ok, err := lock.TryLock(context.Background()); ok || err == nil {
+		t.Errorf("TryLock() = %v, %v, want false, error", ok, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := lock.Lock(ctx); err == nil || err == context.DeadlineExceeded {
+		t.Errorf("Lock() error = %v, want node error", err)
+	}
+}
+
+// 续期失败后 Done 被关闭，锁可以重新获取
+func TestLockDone(t *testing.T) {
+	requireRedisServer(t)
+	lock := redisTool.NewLock("lock:done", 300*time.Millisecond)
+	select {
+	case <-lock.Done():
+	default:
+		t.Errorf("Done() should be closed before locked")
+	}
+	if ok, err := lock.TryLock(context.Background()); err != nil || !ok {
+		t.Fatalf("TryLock() = %v, %v", ok, err)
+	}
+	done := lock.Done()
+	// 锁被他人删除，续期失败
+	if err := redisTool.Del("lock:done"); err != nil {
+		t.Fatalf("Del() error = %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Done() not closed after lock lost")
+	}
+	if err := lock.Unlock(); err != ErrLockNotHeld {
+		t.Errorf("Unlock() error = %v, want %v", err, ErrLockNotHeld)
+	}
+	if ok, err := lock.TryLock(context.Background()); err != nil || !ok {
+		t.Errorf("TryLock() after lost = %v, %v, want true", ok, err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+}
+
+func TestLockWatchdog(t *testing.T) {
+	requireRedisServer(t)
+	lock := redisTool.NewLock("lock:watchdog", 300*time.Millisecond)
+	if err := lock.Lock(context.Background()); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	// 超过租约时间后仍被续期持有
+	time.Sleep(time.Second)
+	ok, err := redisTool.NewLock("lock:watchdog", time.Second).TryLock(context.Background())
+	if err != nil || ok {
+		t.Errorf("TryLock() = %v, %v, want false, nil", ok, err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	requireRedisServer(t)
+	lock := redisTool.NewLock("lock:unlock", time.Second)
+	if err := lock.Unlock(); err != ErrLockNotHeld {
+		t.Errorf("Unlock() error = %v, want %v", err, ErrLockNotHeld)
+	}
+
+	// 锁过期后被他人持有，不能误删
+	if ok, _ := lock.TryLock(context.Background()); !ok {
+		t.Fatalf("TryLock() = false")
+	}
+	lock.stopWatchdog()
+	if err := redisTool.Del("lock:unlock"); err != nil {
+		t.Fatalf("Del() error = %v", err)
+	}
+	other := redisTool.NewLock("lock:unlock", time.Second)
+	if ok, _ := other.TryLock(context.Background()); !ok {
+		t.Fatalf("TryLock() = false")
+	}
+	if err := lock.Unlock(); err != ErrLockNotHeld {
+		t.Errorf("Unlock() error = %v, want %v", err, ErrLockNotHeld)
+	}
+	if err := other.Unlock(); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+}
+
+func TestRedlock(t *testing.T) {
+	requireRedisServer(t)
+	rl, err := NewRedlock(config)
+	if err != nil {
+		t.Fatalf("NewRedlock() error = %v", err)
+	}
+	lock := rl.NewLock("lock:redlock", time.Second)
+	ok, err := lock.TryLock(context.Background())
+	if err != nil || !ok {
+		t.Fatalf("TryLock() = %v, %v", ok, err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+	if _, err := NewRedlock(); err == nil {
+		t.Errorf("NewRedlock() error = nil, wantErr true")
+	}
+}
+
+// 不应答的节点只会拖慢到单节点超时，不会阻塞整个加锁过程
+func TestRedlockSlowNode(t *testing.T) {
+	// 接受连接但从不应答
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	pool := func(addr string) *redis.Pool {
+		return &redis.Pool{Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr, redis.DialReadTimeout(time.Second))
+		}}
+	}
+	var servers []*redistest.Server
+	for i := 0; i < 2; i++ {
+		server, err := redistest.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+		servers = append(servers, server)
+	}
+
+	tests := []struct {
+		name    string
+		pools   []*redis.Pool
+		wantOk  bool
+		wantErr bool
+	}{
+		{
+			name:   "quorum",
+			pools:  []*redis.Pool{pool(servers[0].Addr()), pool(ln.Addr().String()), pool(servers[1].Addr())},
+			wantOk: true,
+		}, {
+			name:    "no quorum",
+			pools:   []*redis.Pool{pool(ln.Addr().String()), pool(servers[0].Addr()), pool(ln.Addr().String())},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			lock := newLock(tt.pools, "lock:slow:"+tt.name, 2*time.Second)
+			start := time.Now()
+			ok, err := lock.TryLock(ctx)
+			if ok != tt.wantOk || (err != nil) != tt.wantErr {
+				t.Errorf("TryLock() = %v, %v, want %v, wantErr %v", ok, err, tt.wantOk, tt.wantErr)
+			}
+			// 单节点超时为 200ms，各节点并行，失败时的释放同样受单节点超时限制
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("TryLock() took %v", elapsed)
+			}
+		})
+	}
+}
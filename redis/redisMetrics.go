@@ -0,0 +1,306 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis连接池统计及命令监控
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// 默认的命令耗时直方图桶上限
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond, time.Second,
+}
+
+// 监控指标的接收者，可对接 prometheus 等监控系统，实现需要是并发安全的
+type Metrics interface {
+	// 每条命令执行后调用，err 为 redis 返回的错误或网络错误，key 不存在不视为错误
+	// 只统计 Do 执行的命令，管道中的命令不单独统计
+	ObserveCommand(commandName string, duration time.Duration, err error)
+	// 由 Redis.ReportPoolStats 定期调用
+	ObservePool(stats PoolStats)
+}
+
+// 连接池统计，集群模式下为所有节点连接池的合计
+type PoolStats struct {
+	// 连接总数，包括使用中和空闲的连接
+	ActiveCount int
+	// 空闲连接数
+	IdleCount int
+	// 连接数达到 MaxActive 后等待空闲连接的次数，只在 RedisConfig.Wait 为 true 时产生
+	WaitCount int64
+	// 等待空闲连接的总时间
+	WaitDuration time.Duration
+}
+
+// 同一个实例的所有视图共享的监控状态
+type monitor struct {
+	maxActive    int
+	waitCount    int64
+	waitDuration int64
+	metrics      atomic.Value
+	logger       atomic.Value
+}
+
+type metricsHolder struct {
+	metrics Metrics
+}
+
+func newMonitor(maxActive int) *monitor {
+	return &monitor{maxActive: maxActive}
+}
+
+func (m *monitor) getMetrics() Metrics {
+	if holder, ok := m.metrics.Load().(metricsHolder); ok {
+		return holder.metrics
+	}
+	return nil
+}
+
+// 从连接池获取连接，连接池已满时记录等待次数和等待时间
+// ActiveCount 包含空闲连接，有空闲连接时不会等待，因此只统计正在使用的连接
+func (m *monitor) get(pool *redis.Pool, get func() (redis.Conn, error)) (redis.Conn, error) {
+	if m.maxActive <= 0 || !pool.Wait || pool.ActiveCount()-pool.IdleCount() < m.maxActive {
+		return get()
+	}
+	start := time.Now()
+	conn, err := get()
+	atomic.AddInt64(&m.waitCount, 1)
+	atomic.AddInt64(&m.waitDuration, int64(time.Since(start)))
+	return conn, err
+}
+
+// 设置监控指标的接收者，nil 表示关闭监控
+// 对实例及其所有命名空间视图生效
+func (r *Redis) SetMetrics(metrics Metrics) {
+	if r.monitor != nil {
+		r.monitor.metrics.Store(metricsHolder{metrics: metrics})
+	}
+}
+
+// 获取连接池统计，集群模式下为各节点连接池之和
+func (r *Redis) PoolStats() PoolStats {
+	var stats PoolStats
+	pools := []*redis.Pool{r.RedisPool}
+	if r.cluster != nil {
+		// 路由连接池中的连接不持有网络连接，不计入统计
+		pools = r.cluster.allPools()
+	}
+	for _, pool := range pools {
+		s := pool.Stats()
+		stats.ActiveCount += s.ActiveCount
+		stats.IdleCount += s.IdleCount
+	}
+	if r.monitor != nil {
+		stats.WaitCount = atomic.LoadInt64(&r.monitor.waitCount)
+		stats.WaitDuration = time.Duration(atomic.LoadInt64(&r.monitor.waitDuration))
+	}
+	return stats
+}
+
+// 每隔 interval 将连接池统计上报给 Metrics，阻塞直到 ctx 结束
+func (r *Redis) ReportPoolStats(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval 必须大于 0")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if r.monitor == nil {
+				continue
+			}
+			if metrics := r.monitor.getMetrics(); metrics != nil {
+				metrics.ObservePool(r.PoolStats())
+			}
+		}
+	}
+}
+
+// 检查连接是否可用，ctx 的截止时间同时作为获取连接和等待回复的超时时间
+func (r *Redis) Ping(ctx context.Context) error {
+	conn, err := r.connContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var reply string
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+		reply, err = redis.String(redis.DoWithTimeout(conn, timeout, "ping"))
+	} else {
+		reply, err = redis.String(conn.Do("ping"))
+	}
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("redis ping 返回值错误: %s", reply)
+	}
+	return nil
+}
+
+// 关闭连接池，空闲连接立即关闭，使用中的连接归还时关闭
+// 关闭后实例及其所有视图都不可再使用
+func (r *Redis) Close() error {
+	var firstErr error
+	for _, pool := range r.pools() {
+		if err := pool.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// 实例使用的所有连接池，集群模式下包括各节点的连接池
+func (r *Redis) pools() []*redis.Pool {
+	pools := []*redis.Pool{r.RedisPool}
+	if r.cluster != nil {
+		pools = append(pools, r.cluster.allPools()...)
+	}
+	return pools
+}
+
+// 统计 Do 命令的耗时和错误
+type metricsConn struct {
+	redis.Conn
+	metrics Metrics
+}
+
+func (c *metricsConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if commandName == "" {
+		return c.Conn.Do(commandName, args...)
+	}
+	start := time.Now()
+	reply, err := c.Conn.Do(commandName, args...)
+	c.observe(commandName, start, err)
+	return reply, err
+}
+
+func (c *metricsConn) DoWithTimeout(timeout time.Duration, commandName string,
+	args ...interface{}) (interface{}, error) {
+	if commandName == "" {
+		return redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+	}
+	start := time.Now()
+	reply, err := redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+	c.observe(commandName, start, err)
+	return reply, err
+}
+
+func (c *metricsConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+func (c *metricsConn) observe(commandName string, start time.Time, err error) {
+	c.metrics.ObserveCommand(strings.ToLower(commandName), time.Since(start), err)
+}
+
+// 内存中的监控指标，用于调试或由调用方自行导出
+type MemoryMetrics struct {
+	buckets []time.Duration
+
+	mu       sync.Mutex
+	commands map[string]*CommandStats
+	pool     PoolStats
+}
+
+// 单个命令的统计
+type CommandStats struct {
+	// 执行次数
+	Count int64
+	// 出错次数
+	Errors int64
+	// 总耗时
+	Total time.Duration
+	// Buckets[i] 为耗时不超过第 i 个桶上限的次数（不累加），最后一个元素为超过所有上限的次数
+	Buckets []int64
+}
+
+// 创建内存监控指标，buckets 为直方图桶上限，需要按升序排列，为空时使用 DefaultLatencyBuckets
+func NewMemoryMetrics(buckets ...time.Duration) *MemoryMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	return &MemoryMetrics{
+		buckets:  append([]time.Duration(nil), buckets...),
+		commands: make(map[string]*CommandStats),
+	}
+}
+
+func (m *MemoryMetrics) ObserveCommand(commandName string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.commands[commandName]
+	if stats == nil {
+		stats = &CommandStats{Buckets: make([]int64, len(m.buckets)+1)}
+		m.commands[commandName] = stats
+	}
+	stats.Count++
+	stats.Total += duration
+	if err != nil && err != redis.ErrNil {
+		stats.Errors++
+	}
+	i := 0
+	for i < len(m.buckets) && duration > m.buckets[i] {
+		i++
+	}
+	stats.Buckets[i]++
+}
+
+func (m *MemoryMetrics) ObservePool(stats PoolStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pool = stats
+}
+
+// 直方图桶上限
+func (m *MemoryMetrics) LatencyBuckets() []time.Duration {
+	return append([]time.Duration(nil), m.buckets...)
+}
+
+// 所有命令的统计快照，key 为小写的命令名
+func (m *MemoryMetrics) Commands() map[string]CommandStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	commands := make(map[string]CommandStats, len(m.commands))
+	for name, stats := range m.commands {
+		snapshot := *stats
+		snapshot.Buckets = append([]int64(nil), stats.Buckets...)
+		commands[name] = snapshot
+	}
+	return commands
+}
+
+// 最近一次上报的连接池统计
+func (m *MemoryMetrics) Pool() PoolStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pool
+}
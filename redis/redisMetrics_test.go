@@ -0,0 +1,244 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis连接池统计及命令监控
+package redis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestMemoryMetrics(t *testing.T) {
+	buckets := []time.Duration{time.Millisecond, 10 * time.Millisecond}
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		errs      []error
+		want      CommandStats
+	}{
+		{
+			name:      "buckets",
+			durations: []time.Duration{time.Millisecond, 2 * time.Millisecond, time.Second},
+			errs:      []error{nil, nil, nil},
+			want:      CommandStats{Count: 3, Total: time.Second + 3*time.Millisecond, Buckets: []int64{1, 1, 1}},
+		}, {
+			name:      "errors",
+			durations: []time.Duration{time.Microsecond, time.Microsecond},
+			errs:      []error{errors.New("ERR"), nil},
+			want:      CommandStats{Count: 2, Errors: 1, Total: 2 * time.Microsecond, Buckets: []int64{2, 0, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryMetrics(buckets...)
+			for i, d := range tt.durations {
+				m.ObserveCommand("get", d, tt.errs[i])
+			}
+			if got := m.Commands()["get"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Commands() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetMetrics(t *testing.T) {
+	m := NewMemoryMetrics()
+	redisTool.SetMetrics(m)
+	defer redisTool.SetMetrics(nil)
+
+	view := redisTool.WithNamespace("metrics")
+	tests := []struct {
+		name       string
+		run        func() error
+		command    string
+		wantErrors int64
+	}{
+		{
+			name:    "set",
+			run:     func() error { return redisTool.Set("metrics", "1") },
+			command: "set",
+		}, {
+			name:    "view",
+			run:     func() error { return view.Set("metrics", "1") },
+			command: "set",
+		}, {
+			name: "error",
+			run: func() error {
+				if err := redisTool.Set("metrics:text", "a"); err != nil {
+					return err
+				}
+				if _, err := redisTool.do("incr", "metrics:text"); err == nil {
+					return errors.New("incr should fail")
+				}
+				return nil
+			},
+			command:    "incr",
+			wantErrors: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := m.Commands()[tt.command]
+			if err := tt.run(); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			after := m.Commands()[tt.command]
+			if after.Count <= before.Count {
+				t.Errorf("Count = %d, want > %d", after.Count, before.Count)
+			}
+			if got := after.Errors - before.Errors; got != tt.wantErrors {
+				t.Errorf("Errors = %d, want %d", got, tt.wantErrors)
+			}
+		})
+	}
+	redisTool.Del("metrics")
+	view.Del("metrics")
+	redisTool.Del("metrics:text")
+}
+
+func TestPoolStats(t *testing.T) {
+	r, err := NewRedis(&RedisConfig{Address: config.Address, Password: config.Password, MaxIdle: 2,
+		MaxActive: 1, Wait: true})
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	defer r.Close()
+	m := NewMemoryMetrics()
+	r.SetMetrics(m)
+
+	conn := r.conn()
+	if got := r.PoolStats().ActiveCount; got != 1 {
+		t.Errorf("ActiveCount = %d, want 1", got)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		conn.Close()
+	}()
+	if err := r.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	stats := r.PoolStats()
+	if stats.WaitCount != 1 || stats.WaitDuration < 40*time.Millisecond {
+		t.Errorf("PoolStats() = %+v, want 1 wait of about 50ms", stats)
+	}
+	if stats.IdleCount != 1 {
+		t.Errorf("IdleCount = %d, want 1", stats.IdleCount)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		cancel()
+	}()
+	r.ReportPoolStats(ctx, 10*time.Millisecond)
+	if got := m.Pool(); got != stats {
+		t.Errorf("Pool() = %+v, want %+v", got, stats)
+	}
+}
+
+// 有空闲连接时获取连接不会等待
+func TestPoolStatsNoContention(t *testing.T) {
+	r, err := NewRedis(&RedisConfig{Address: config.Address, Password: config.Password, MaxIdle: 2,
+		MaxActive: 2, Wait: true})
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	defer r.Close()
+	for i := 0; i < 5; i++ {
+		if err := r.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping() error = %v", err)
+		}
+	}
+	if stats := r.PoolStats(); stats.WaitCount != 0 {
+		t.Errorf("PoolStats() = %+v, want no wait", stats)
+	}
+}
+
+// 集群模式只统计节点连接池，不包含路由连接池
+func TestPoolStatsCluster(t *testing.T) {
+	node := newPool(&RedisConfig{MaxIdle: 2}, func() (redis.Conn, error) {
+		return redis.Dial("tcp", config.Address, redis.DialPassword(config.Password))
+	})
+	defer node.Close()
+	c := &cluster{pools: map[string]*redis.Pool{config.Address: node}}
+	r := &Redis{RedisPool: newPool(&RedisConfig{MaxIdle: 2}, c.dial), cluster: c, monitor: newMonitor(0)}
+	routing := r.RedisPool.Get()
+	defer routing.Close()
+	nodeConn := node.Get()
+	defer nodeConn.Close()
+	if _, err := nodeConn.Do("ping"); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if got := r.PoolStats().ActiveCount; got != 1 {
+		t.Errorf("ActiveCount = %d, want 1", got)
+	}
+}
+
+func TestPing(t *testing.T) {
+	timeout, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	canceled, cancel2 := context.WithCancel(context.Background())
+	cancel2()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantErr bool
+	}{
+		{
+			name:    "background",
+			ctx:     context.Background(),
+			wantErr: false,
+		}, {
+			name:    "deadline",
+			ctx:     timeout,
+			wantErr: false,
+		}, {
+			name:    "canceled",
+			ctx:     canceled,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := redisTool.Ping(tt.ctx); (err != nil) != tt.wantErr {
+				t.Errorf("Ping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClose(t *testing.T) {
+	r, err := NewRedis(config)
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	if err := r.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := r.PoolStats(); got.ActiveCount != 0 || got.IdleCount != 0 {
+		t.Errorf("PoolStats() = %+v, want empty pool", got)
+	}
+	if err := r.WithNamespace("closed").Ping(context.Background()); err == nil {
+		t.Errorf("Ping() after Close() error = nil, want error")
+	}
+}
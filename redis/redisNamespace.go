@@ -0,0 +1,420 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis key命名空间
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+type namespaceKey struct{}
+
+// 将命名空间（如租户 id）保存到 ctx 中，之后通过 Redis.WithContext 使用
+func ContextWithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceKey{}, namespace)
+}
+
+// 获取 ctx 中的命名空间
+func NamespaceFromContext(ctx context.Context) (string, bool) {
+	namespace, ok := ctx.Value(namespaceKey{}).(string)
+	return namespace, ok && namespace != ""
+}
+
+// 返回命名空间视图，所有 key 和频道自动加上 "namespace:" 前缀，多次调用时前缀依次叠加
+// 视图与原实例共用连接池；直接通过 RedisPool 获取的连接不会加前缀
+func (r *Redis) WithNamespace(namespace string) *Redis {
+	if namespace == "" {
+		return r
+	}
+	view := *r
+	view.prefix = r.prefix + namespace + ":"
+	return &view
+}
+
+// 返回 ctx 中命名空间的视图，ctx 中没有命名空间时返回 r 本身
+func (r *Redis) WithContext(ctx context.Context) *Redis {
+	if namespace, ok := NamespaceFromContext(ctx); ok {
+		return r.WithNamespace(namespace)
+	}
+	return r
+}
+
+// 当前的 key 前缀
+func (r *Redis) KeyPrefix() string {
+	return r.prefix
+}
+
+// 从连接池获取连接，有前缀时对连接进行包装
+func (r *Redis) conn() redis.Conn {
+	if r.ctx != nil {
+		conn, err := r.connContext(r.ctx)
+		if err != nil {
+			return errorConn{err: err}
+		}
+		return conn
+	}
+	if r.monitor == nil {
+		return r.wrap(r.RedisPool.Get())
+	}
+	conn, _ := r.monitor.get(r.RedisPool, func() (redis.Conn, error) {
+		return r.RedisPool.Get(), nil
+	})
+	return r.wrap(conn)
+}
+
+func (r *Redis) connContext(ctx context.Context) (redis.Conn, error) {
+	// 有空闲连接时 GetContext 不检查 ctx
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	get := func() (redis.Conn, error) {
+		return r.RedisPool.GetContext(ctx)
+	}
+	var conn redis.Conn
+	var err error
+	if r.monitor == nil {
+		conn, err = get()
+	} else {
+		conn, err = r.monitor.get(r.RedisPool, get)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.wrap(conn), nil
+}
+
+// 按需加上命令监控、ctx 和前缀
+func (r *Redis) wrap(conn redis.Conn) redis.Conn {
+	if r.monitor != nil {
+		if metrics := r.monitor.getMetrics(); metrics != nil {
+			conn = &metricsConn{Conn: conn, metrics: metrics}
+		}
+	}
+	if r.ctx != nil {
+		conn = &ctxConn{Conn: conn, ctx: r.ctx, readTimeout: r.readTimeout, logs: r.logs(r.ctx)}
+	}
+	if r.prefix == "" {
+		return conn
+	}
+	return &prefixConn{Conn: conn, prefix: r.prefix}
+}
+
+// 为命令中的 key 和频道加上前缀，并去掉返回值中 key 和频道的前缀
+// MULTI/EXEC 中 KEYS、SCAN 等命令的返回值不会去掉前缀
+type prefixConn struct {
+	redis.Conn
+	prefix string
+	// 已发送、尚未读取返回值的命令
+	pending []string
+	// 订阅状态下的返回值均按消息处理
+	subscribed bool
+}
+
+func (c *prefixConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	args, err := prefixArgs(c.prefix, commandName, args)
+	if err != nil {
+		return nil, err
+	}
+	c.pending = nil
+	reply, err := c.Conn.Do(commandName, args...)
+	return c.strip(commandName, reply), err
+}
+
+func (c *prefixConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	args, err := prefixArgs(c.prefix, commandName, args)
+	if err != nil {
+		return nil, err
+	}
+	c.pending = nil
+	reply, err := redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+	return c.strip(commandName, reply), err
+}
+
+func (c *prefixConn) Send(commandName string, args ...interface{}) error {
+	args, err := prefixArgs(c.prefix, commandName, args)
+	if err != nil {
+		return err
+	}
+	name := strings.ToLower(commandName)
+	if name == "subscribe" || name == "psubscribe" {
+		c.subscribed = true
+	}
+	c.pending = append(c.pending, name)
+	return c.Conn.Send(commandName, args...)
+}
+
+func (c *prefixConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	return c.stripReceived(reply), err
+}
+
+func (c *prefixConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	reply, err := redis.ReceiveWithTimeout(c.Conn, timeout)
+	return c.stripReceived(reply), err
+}
+
+func (c *prefixConn) stripReceived(reply interface{}) interface{} {
+	if c.subscribed {
+		return c.stripMessage(reply)
+	}
+	if len(c.pending) == 0 {
+		return reply
+	}
+	commandName := c.pending[0]
+	c.pending = c.pending[1:]
+	return c.strip(commandName, reply)
+}
+
+// 去掉 KEYS、SCAN 和阻塞弹出命令返回值中 key 的前缀
+func (c *prefixConn) strip(commandName string, reply interface{}) interface{} {
+	values, ok := reply.([]interface{})
+	if !ok {
+		return reply
+	}
+	switch strings.ToLower(commandName) {
+	case "keys":
+		for i := range values {
+			values[i] = c.trim(values[i])
+		}
+	case "scan":
+		if len(values) == 2 {
+			if keys, ok := values[1].([]interface{}); ok {
+				for i := range keys {
+					keys[i] = c.trim(keys[i])
+				}
+			}
+		}
+	case "blpop", "brpop", "bzpopmin", "bzpopmax", "lmpop", "blmpop", "zmpop", "bzmpop":
+		if len(values) > 0 {
+			values[0] = c.trim(values[0])
+		}
+	}
+	return reply
+}
+
+// 去掉订阅消息中频道和模式的前缀
+// 格式为 [message, channel, data]、[pmessage, pattern, channel, data] 或 [subscribe, channel, count]
+func (c *prefixConn) stripMessage(reply interface{}) interface{} {
+	values, ok := reply.([]interface{})
+	if !ok || len(values) < 3 {
+		return reply
+	}
+	kind, _ := redis.String(values[0], nil)
+	values[1] = c.trim(values[1])
+	if kind == "pmessage" {
+		values[2] = c.trim(values[2])
+	}
+	return reply
+}
+
+func (c *prefixConn) trim(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		return []byte(strings.TrimPrefix(string(b), c.prefix))
+	}
+	return value
+}
+
+// 第一个参数为 key、其余参数都不是 key 的命令
+var namespaceKeyFirstCommands = toSet(
+	// string
+	"get", "set", "setnx", "setex", "psetex", "getset", "getdel", "getex", "append", "strlen",
+	"incr", "incrby", "incrbyfloat", "decr", "decrby", "getrange", "setrange",
+	"setbit", "getbit", "bitcount", "bitpos", "bitfield", "bitfield_ro",
+	// key
+	"expire", "pexpire", "expireat", "pexpireat", "expiretime", "pexpiretime", "ttl", "pttl",
+	"persist", "type", "dump", "restore",
+	// hash
+	"hget", "hset", "hsetnx", "hmset", "hmget", "hdel", "hlen", "hexists", "hgetall", "hkeys", "hvals",
+	"hincrby", "hincrbyfloat", "hscan", "hstrlen", "hrandfield",
+	// list
+	"lpush", "rpush", "lpushx", "rpushx", "lpop", "rpop", "llen", "lrange", "lindex", "lset", "lrem",
+	"ltrim", "linsert", "lpos",
+	// set
+	"sadd", "srem", "smembers", "sismember", "smismember", "scard", "spop", "srandmember", "sscan",
+	// sorted set
+	"zadd", "zrem", "zscore", "zmscore", "zincrby", "zcard", "zcount", "zrange", "zrangebyscore",
+	"zrevrangebyscore", "zrangebylex", "zrevrangebylex", "zlexcount", "zrevrange", "zrank", "zrevrank",
+	"zremrangebyrank", "zremrangebyscore", "zremrangebylex", "zpopmin", "zpopmax", "zrandmember", "zscan",
+	// hyperloglog、geo、stream
+	"pfadd", "geoadd", "geopos", "geodist", "geohash", "geosearch", "georadius_ro", "georadiusbymember_ro",
+	"xadd", "xlen", "xrange", "xrevrange", "xdel", "xtrim", "xack", "xpending", "xclaim", "xautoclaim", "xsetid",
+	// 发布的频道与订阅的频道使用相同的前缀
+	"publish",
+)
+
+// 前两个参数都是 key 的命令
+var namespaceTwoKeyCommands = toSet("rename", "renamenx", "rpoplpush", "brpoplpush", "smove",
+	"lmove", "blmove", "copy", "zrangestore", "geosearchstore", "lcs")
+
+// 为命令参数中的 key 加上前缀，返回新的参数
+// 不认识的命令无法确定哪些参数是 key，返回错误而不是猜测
+func prefixArgs(prefix string, commandName string, args []interface{}) ([]interface{}, error) {
+	if len(args) == 0 {
+		return args, nil
+	}
+	name := strings.ToLower(commandName)
+	out := make([]interface{}, len(args))
+	copy(out, args)
+	add := func(i int) {
+		if i >= 0 && i < len(out) {
+			out[i] = prefix + argString(out[i])
+		}
+	}
+	// numkeys 位于 i 时，为之后的 numkeys 个 key 加上前缀
+	addNumKeys := func(i int) {
+		if i < len(out) {
+			if n, err := strconv.Atoi(argString(out[i])); err == nil {
+				for j := 0; j < n; j++ {
+					add(i + 1 + j)
+				}
+			}
+		}
+	}
+	// 为 option 之后的参数加上前缀，如 STORE destination
+	addAfter := func(options ...string) {
+		for i := 0; i+1 < len(out); i++ {
+			for _, option := range options {
+				if strings.EqualFold(argString(out[i]), option) {
+					add(i + 1)
+					i++
+					break
+				}
+			}
+		}
+	}
+	switch {
+	case namespaceKeyFirstCommands[name]:
+		add(0)
+		return out, nil
+	case namespaceTwoKeyCommands[name]:
+		add(0)
+		add(1)
+		return out, nil
+	}
+	switch name {
+	case "del", "unlink", "exists", "touch", "mget", "watch", "sinter", "sunion", "sdiff",
+		"sinterstore", "sunionstore", "sdiffstore", "pfcount", "pfmerge", "subscribe", "unsubscribe":
+		for i := range out {
+			add(i)
+		}
+	case "mset", "msetnx":
+		for i := 0; i < len(out); i += 2 {
+			add(i)
+		}
+	case "blpop", "brpop", "bzpopmin", "bzpopmax":
+		// 最后一个参数为超时时间
+		for i := 0; i < len(out)-1; i++ {
+			add(i)
+		}
+	case "eval", "evalsha", "eval_ro", "evalsha_ro", "fcall", "fcall_ro":
+		// EVAL script numkeys key [key ...] arg [arg ...]
+		addNumKeys(1)
+	case "zunionstore", "zinterstore", "zdiffstore":
+		// ZUNIONSTORE destination numkeys key [key ...]
+		add(0)
+		addNumKeys(1)
+	case "zunion", "zinter", "zdiff", "sintercard", "zintercard", "lmpop", "zmpop":
+		// ZUNION numkeys key [key ...]
+		addNumKeys(0)
+	case "blmpop", "bzmpop":
+		// BLMPOP timeout numkeys key [key ...]
+		addNumKeys(1)
+	case "georadius", "georadiusbymember":
+		add(0)
+		addAfter("store", "storedist")
+	case "sort", "sort_ro":
+		// BY 和 GET 的模式同样是 key，# 表示元素本身
+		add(0)
+		for i := 1; i+1 < len(out); i++ {
+			option := argString(out[i])
+			if strings.EqualFold(option, "store") ||
+				(strings.EqualFold(option, "by") || strings.EqualFold(option, "get")) && argString(out[i+1]) != "#" {
+				add(i + 1)
+				i++
+			}
+		}
+	case "bitop":
+		for i := 1; i < len(out); i++ {
+			add(i)
+		}
+	case "xread", "xreadgroup":
+		// XREAD ... STREAMS key [key ...] id [id ...]
+		for i, arg := range out {
+			if strings.EqualFold(argString(arg), "streams") {
+				n := (len(out) - i - 1) / 2
+				for j := 0; j < n; j++ {
+					add(i + 1 + j)
+				}
+				break
+			}
+		}
+	case "xgroup", "xinfo", "object":
+		add(1)
+	case "memory":
+		if strings.EqualFold(argString(out[0]), "usage") {
+			add(1)
+		}
+	case "psubscribe", "punsubscribe":
+		for i := range out {
+			out[i] = escapePattern(prefix) + argString(out[i])
+		}
+	case "keys":
+		out[0] = escapePattern(prefix) + argString(out[0])
+	case "scan":
+		// SCAN cursor [MATCH pattern] [COUNT count]
+		matched := false
+		for i := 1; i+1 < len(out); i += 2 {
+			if strings.EqualFold(argString(out[i]), "match") {
+				out[i+1] = escapePattern(prefix) + argString(out[i+1])
+				matched = true
+			}
+		}
+		if !matched {
+			out = append(out, "match", escapePattern(prefix)+"*")
+		}
+	default:
+		if !clusterKeylessCommands[name] {
+			return nil, fmt.Errorf("redis 命名空间不支持的命令: %s", commandName)
+		}
+	}
+	return out, nil
+}
+
+func toSet(values ...string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// 转义 glob 模式中的特殊字符
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
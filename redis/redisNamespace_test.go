@@ -0,0 +1,236 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis key命名空间
+package redis
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPrefixArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		commandName string
+		args        []interface{}
+		want        []interface{}
+		wantErr     bool
+	}{
+		{
+			name:        "single key",
+			commandName: "SET",
+			args:        []interface{}{"k", "v", "ex", 10},
+			want:        []interface{}{"t:k", "v", "ex", 10},
+		}, {
+			name:        "all keys",
+			commandName: "del",
+			args:        []interface{}{"a", "b"},
+			want:        []interface{}{"t:a", "t:b"},
+		}, {
+			name:        "mset",
+			commandName: "mset",
+			args:        []interface{}{"a", "1", "b", "2"},
+			want:        []interface{}{"t:a", "1", "t:b", "2"},
+		}, {
+			name:        "evalsha",
+			commandName: "evalsha",
+			args:        []interface{}{"sha", 2, "a", "b", "arg"},
+			want:        []interface{}{"sha", 2, "t:a", "t:b", "arg"},
+		}, {
+			name:        "xreadgroup",
+			commandName: "xreadgroup",
+			args:        []interface{}{"group", "g", "c", "streams", "s1", "s2", ">", ">"},
+			want:        []interface{}{"group", "g", "c", "streams", "t:s1", "t:s2", ">", ">"},
+		}, {
+			name:        "xgroup",
+			commandName: "xgroup",
+			args:        []interface{}{"create", "s", "g", "0"},
+			want:        []interface{}{"create", "t:s", "g", "0"},
+		}, {
+			name:        "scan match",
+			commandName: "scan",
+			args:        []interface{}{"0", "match", "user:*", "count", 10},
+			want:        []interface{}{"0", "match", "t:user:*", "count", 10},
+		}, {
+			name:        "scan without match",
+			commandName: "scan",
+			args:        []interface{}{"0"},
+			want:        []interface{}{"0", "match", "t:*"},
+		}, {
+			name:        "blpop",
+			commandName: "blpop",
+			args:        []interface{}{"a", "b", 1},
+			want:        []interface{}{"t:a", "t:b", 1},
+		}, {
+			name:        "keyless",
+			commandName: "ping",
+			args:        []interface{}{"hello"},
+			want:        []interface{}{"hello"},
+		}, {
+			name:        "zunion numkeys first",
+			commandName: "zunion",
+			args:        []interface{}{2, "a", "b", "withscores"},
+			want:        []interface{}{2, "t:a", "t:b", "withscores"},
+		}, {
+			name:        "sintercard",
+			commandName: "sintercard",
+			args:        []interface{}{2, "a", "b", "limit", 1},
+			want:        []interface{}{2, "t:a", "t:b", "limit", 1},
+		}, {
+			name:        "zmpop",
+			commandName: "zmpop",
+			args:        []interface{}{1, "a", "min"},
+			want:        []interface{}{1, "t:a", "min"},
+		}, {
+			name:        "bzmpop",
+			commandName: "bzmpop",
+			args:        []interface{}{0, 2, "a", "b", "max"},
+			want:        []interface{}{0, 2, "t:a", "t:b", "max"},
+		}, {
+			name:        "lmove",
+			commandName: "lmove",
+			args:        []interface{}{"a", "b", "left", "right"},
+			want:        []interface{}{"t:a", "t:b", "left", "right"},
+		}, {
+			name:        "copy",
+			commandName: "copy",
+			args:        []interface{}{"a", "b", "replace"},
+			want:        []interface{}{"t:a", "t:b", "replace"},
+		}, {
+			name:        "zrangestore",
+			commandName: "zrangestore",
+			args:        []interface{}{"dst", "src", 0, -1},
+			want:        []interface{}{"t:dst", "t:src", 0, -1},
+		}, {
+			name:        "geosearchstore",
+			commandName: "geosearchstore",
+			args:        []interface{}{"dst", "src", "frommember", "m", "byradius", 1, "km"},
+			want:        []interface{}{"t:dst", "t:src", "frommember", "m", "byradius", 1, "km"},
+		}, {
+			name:        "sort store",
+			commandName: "sort",
+			args:        []interface{}{"a", "by", "w_*", "get", "#", "get", "o_*", "store", "b"},
+			want:        []interface{}{"t:a", "by", "t:w_*", "get", "#", "get", "t:o_*", "store", "t:b"},
+		}, {
+			name:        "georadius store",
+			commandName: "georadius",
+			args:        []interface{}{"a", 15, 37, 200, "km", "store", "b"},
+			want:        []interface{}{"t:a", 15, 37, 200, "km", "store", "t:b"},
+		}, {
+			name:        "unknown command",
+			commandName: "migrate",
+			args:        []interface{}{"host", 6379, "a", 0, 1000},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := prefixArgs("t:", tt.commandName, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("prefixArgs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("prefixArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapePattern(t *testing.T) {
+	if got := escapePattern("a*b?[c]\\"); got != `a\*b\?\[c\]\\` {
+		t.Errorf("escapePattern() = %v", got)
+	}
+}
+
+func TestWithNamespace(t *testing.T) {
+	tenant := redisTool.WithNamespace("tenant1")
+	if tenant.KeyPrefix() != "tenant1:" {
+		t.Fatalf("KeyPrefix() = %v, want tenant1:", tenant.KeyPrefix())
+	}
+	if err := tenant.Set("config", "a"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got, err := redisTool.Get("tenant1:config"); err != nil || got != "a" {
+		t.Errorf("Get() = %v, %v, want a", got, err)
+	}
+
+	// 管道中的 key 同样加上前缀
+	p := tenant.Pipeline()
+	p.Set("token", "b", 0)
+	get := p.Get("config")
+	if _, err := p.Exec(); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if got, _ := get.String(); got != "a" {
+		t.Errorf("Pipeline Get() = %v, want a", got)
+	}
+
+	// 遍历的结果不包含前缀
+	var keys []string
+	it := tenant.Scan("", 0)
+	for it.Next(context.Background()) {
+		keys = append(keys, it.Val())
+	}
+	sort.Strings(keys)
+	if want := []string{"config", "token"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Scan() = %v, want %v", keys, want)
+	}
+
+	// 命名空间可以从 ctx 中获取
+	ctx := ContextWithNamespace(context.Background(), "tenant1")
+	if got, err := redisTool.WithContext(ctx).Get("token"); err != nil || got != "b" {
+		t.Errorf("WithContext().Get() = %v, %v, want b", got, err)
+	}
+	if redisTool.WithContext(context.Background()) != redisTool {
+		t.Errorf("WithContext() without namespace should return itself")
+	}
+	// 无法确定 key 位置的命令返回错误
+	if _, err := tenant.do("migrate", "host", 6379, "config", 0, 1000); err == nil {
+		t.Errorf("do() unknown command error = nil")
+	}
+	if n, err := tenant.DeleteByPattern(context.Background(), "*", 0, nil); err != nil || n != 2 {
+		t.Errorf("DeleteByPattern() = %v, %v, want 2, nil", n, err)
+	}
+}
+
+// 频道同样加上前缀，收到的消息中不包含前缀
+func TestNamespacePubSub(t *testing.T) {
+	tenant := redisTool.WithNamespace("tenant2")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := tenant.SubscribeChan(ctx, "events")
+	if err != nil {
+		t.Fatalf("SubscribeChan() error = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n, err := redisTool.Publish("events", "other"); err != nil || n != 0 {
+		t.Errorf("Publish() without namespace = %v, %v, want 0", n, err)
+	}
+	if n, err := tenant.Publish("events", "hello"); err != nil || n != 1 {
+		t.Fatalf("Publish() = %v, %v, want 1", n, err)
+	}
+	select {
+	case msg := <-ch:
+		if msg.Channel != "events" || string(msg.Data) != "hello" {
+			t.Errorf("message = %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("message not received")
+	}
+}
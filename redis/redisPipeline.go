@@ -0,0 +1,219 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis管道及批量操作
+package redis
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 管道，命令先在一个连接上排队，Exec 时一次性发送并读取所有返回值
+// Pipeline 不是并发安全的，Exec 或 Close 之后不能再使用
+type Pipeline struct {
+	conn    redis.Conn
+	replies []*Reply
+	err     error
+}
+
+// 管道命令的返回值，Exec 之后才可读取
+type Reply struct {
+	Value interface{}
+	Err   error
+}
+
+// 创建管道
+func (r *Redis) Pipeline() *Pipeline {
+	return &Pipeline{conn: r.conn()}
+}
+
+// 将命令加入管道，返回的 Reply 在 Exec 之后填充
+func (p *Pipeline) Send(commandName string, args ...interface{}) *Reply {
+	reply := &Reply{}
+	if p.err != nil {
+		reply.Err = p.err
+		return reply
+	}
+	if err := p.conn.Send(commandName, args...); err != nil {
+		p.err = err
+		reply.Err = err
+		return reply
+	}
+	p.replies = append(p.replies, reply)
+	return reply
+}
+
+// 获取 key 对应的 string 值
+func (p *Pipeline) Get(key string) *Reply {
+	if utils.IsEmpty(key) {
+		return p.fail(fmt.Errorf("key 不能为空"))
+	}
+	return p.Send("get", key)
+}
+
+// 设置 string 值，ex 大于 0 时同时设置超时时间（秒）
+func (p *Pipeline) Set(key string, value string, ex int) *Reply {
+	if utils.IsEmpty(key) {
+		return p.fail(fmt.Errorf("key 不能为空"))
+	}
+	if ex > 0 {
+		return p.Send("set", key, value, "ex", ex)
+	}
+	return p.Send("set", key, value)
+}
+
+// 删除 key
+func (p *Pipeline) Del(key string) *Reply {
+	if utils.IsEmpty(key) {
+		return p.fail(fmt.Errorf("key 不能为空"))
+	}
+	return p.Send("del", key)
+}
+
+// 发送管道中的所有命令并读取返回值，执行完毕后归还连接
+// 返回的 error 为连接级别的错误，单条命令的错误在对应 Reply.Err 中
+func (p *Pipeline) Exec() ([]*Reply, error) {
+	defer p.Close()
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(p.replies) == 0 {
+		return nil, nil
+	}
+	if err := p.conn.Flush(); err != nil {
+		return nil, err
+	}
+	for _, reply := range p.replies {
+		reply.Value, reply.Err = p.conn.Receive()
+		if reply.Err == nil {
+			continue
+		}
+		// 命令错误不影响后续返回值的读取，连接错误则直接返回
+		if _, ok := reply.Err.(redis.Error); !ok {
+			return nil, reply.Err
+		}
+	}
+	return p.replies, nil
+}
+
+// 放弃管道并归还连接，重复调用是安全的
+func (p *Pipeline) Close() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	if p.err == nil {
+		p.err = fmt.Errorf("redis pipeline 已关闭")
+	}
+	return err
+}
+
+func (p *Pipeline) fail(err error) *Reply {
+	if p.err == nil {
+		p.err = err
+	}
+	return &Reply{Err: err}
+}
+
+// 返回 string 值，值为 nil 时返回空字符串
+func (r *Reply) String() (string, error) {
+	if r.Value == nil && r.Err == nil {
+		return "", nil
+	}
+	return redis.String(r.Value, r.Err)
+}
+
+// 返回 int64 值
+func (r *Reply) Int64() (int64, error) {
+	return redis.Int64(r.Value, r.Err)
+}
+
+// 返回 float64 值
+func (r *Reply) Float64() (float64, error) {
+	return redis.Float64(r.Value, r.Err)
+}
+
+// 返回 bool 值
+func (r *Reply) Bool() (bool, error) {
+	return redis.Bool(r.Value, r.Err)
+}
+
+// 返回 []string 值
+func (r *Reply) Strings() ([]string, error) {
+	return redis.Strings(r.Value, r.Err)
+}
+
+// 返回 map[string]string 值
+func (r *Reply) StringMap() (map[string]string, error) {
+	return redis.StringMap(r.Value, r.Err)
+}
+
+// 批量获取 key 对应的 string 值，结果与 keys 一一对应，key 不存在时为 nil，以便与空字符串区分
+func (r *Redis) MGet(keys ...string) ([]*string, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("keys 不能为空")
+	}
+	for _, key := range keys {
+		if utils.IsEmpty(key) {
+			return nil, fmt.Errorf("key 不能为空")
+		}
+	}
+	values, err := redis.Values(r.do("mget", redis.Args{}.AddFlat(keys)...))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*string, len(values))
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		s, err := redis.String(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = &s
+	}
+	return result, nil
+}
+
+// 批量设置 string 值
+func (r *Redis) MSet(values map[string]string) error {
+	if len(values) == 0 {
+		return fmt.Errorf("values 不能为空")
+	}
+	for key := range values {
+		if utils.IsEmpty(key) {
+			return fmt.Errorf("key 不能为空")
+		}
+	}
+	_, err := r.do("mset", redis.Args{}.AddFlat(values)...)
+	return err
+}
+
+// 批量删除 key，返回实际删除的数量
+func (r *Redis) MDel(keys ...string) (int, error) {
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("keys 不能为空")
+	}
+	for _, key := range keys {
+		if utils.IsEmpty(key) {
+			return 0, fmt.Errorf("key 不能为空")
+		}
+	}
+	return redis.Int(r.do("del", redis.Args{}.AddFlat(keys)...))
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis管道及批量操作
+package redis
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	p := redisTool.Pipeline()
+	set := p.Set("pipeline:name", "xiaoliu", 60)
+	get := p.Get("pipeline:name")
+	incr := p.Send("incr", "pipeline:name")
+	del := p.Del("pipeline:name")
+	replies, err := p.Exec()
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if len(replies) != 4 {
+		t.Fatalf("Exec() len = %v, want 4", len(replies))
+	}
+	if v, err := set.String(); err != nil || v != "OK" {
+		t.Errorf("Set() = %v, %v, want OK, nil", v, err)
+	}
+	if v, err := get.String(); err != nil || v != "xiaoliu" {
+		t.Errorf("Get() = %v, %v, want xiaoliu, nil", v, err)
+	}
+	if _, err := incr.Int64(); err == nil {
+		t.Errorf("Send(incr) error = nil, wantErr true")
+	}
+	if n, err := del.Int64(); err != nil || n != 1 {
+		t.Errorf("Del() = %v, %v, want 1, nil", n, err)
+	}
+}
+
+func TestPipelineKeyNil(t *testing.T) {
+	p := redisTool.Pipeline()
+	p.Get("")
+	if _, err := p.Exec(); err == nil {
+		t.Errorf("Exec() error = nil, wantErr true")
+	}
+	if _, err := p.Exec(); err == nil {
+		t.Errorf("Exec() after close error = nil, wantErr true")
+	}
+}
+
+func TestMSetAndMGet(t *testing.T) {
+	values := map[string]string{"mget:a": "1", "mget:b": "2", "mget:empty": ""}
+	if err := redisTool.MSet(values); err != nil {
+		t.Fatalf("MSet() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		keys    []string
+		want    []*string
+		wantErr bool
+	}{
+		{
+			name: "all",
+			keys: []string{"mget:a", "mget:b", "mget:c", "mget:empty"},
+			want: []*string{stringPtr("1"), stringPtr("2"), nil, stringPtr("")},
+		}, {
+			name:    "keys nil",
+			keys:    nil,
+			wantErr: true,
+		}, {
+			name:    "key nil",
+			keys:    []string{"mget:a", ""},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisTool.MGet(tt.keys...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MGet() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MGet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if n, err := redisTool.MDel("mget:a", "mget:b", "mget:c", "mget:empty"); err != nil || n != 3 {
+		t.Errorf("MDel() = %v, %v, want 3, nil", n, err)
+	}
+}
+
+const benchmarkKeys = 100
+
+func benchmarkSetup(b *testing.B) []string {
+	keys := make([]string, benchmarkKeys)
+	values := make(map[string]string, benchmarkKeys)
+	for i := range keys {
+		keys[i] = "bench:" + strconv.Itoa(i)
+		values[keys[i]] = strconv.Itoa(i)
+	}
+	if err := redisTool.MSet(values); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	return keys
+}
+
+func BenchmarkGetPerKey(b *testing.B) {
+	keys := benchmarkSetup(b)
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			if _, err := redisTool.Get(key); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkPipelineGet(b *testing.B) {
+	keys := benchmarkSetup(b)
+	for i := 0; i < b.N; i++ {
+		p := redisTool.Pipeline()
+		for _, key := range keys {
+			p.Get(key)
+		}
+		if _, err := p.Exec(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMGet(b *testing.B) {
+	keys := benchmarkSetup(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := redisTool.MGet(keys...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,220 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis发布订阅
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+const (
+	// 订阅连接的心跳间隔
+	pubSubPingInterval = 10 * time.Second
+	// 订阅连接的读超时，超过该时间未收到任何消息（包括心跳回复）视为连接已断开
+	pubSubReadTimeout = pubSubPingInterval + 5*time.Second
+	// 重连的最小、最大等待时间
+	pubSubMinBackoff = 100 * time.Millisecond
+	pubSubMaxBackoff = 30 * time.Second
+	// SubscribeChan 返回的 channel 缓冲大小
+	pubSubChanSize = 100
+)
+
+// 订阅收到的消息
+type Message struct {
+	// 消息所在的频道
+	Channel string
+	// PSubscribe 匹配到的模式，Subscribe 时为空
+	Pattern string
+	// 消息内容
+	Data []byte
+}
+
+// 发布消息，返回收到消息的订阅者数量
+func (r *Redis) Publish(channel string, message string) (int, error) {
+	if utils.IsEmpty(channel) {
+		return 0, fmt.Errorf("channel 不能为空")
+	}
+	return redis.Int(r.do("publish", channel, message))
+}
+
+// 订阅频道，消息交给 handler 处理
+// 阻塞直到 ctx 结束，连接断开后按指数退避自动重连并重新订阅
+// ctx 结束时立即关闭订阅连接，每次订阅的结果以 debug 级别记录并带上 ctx 中的 traceId
+func (r *Redis) Subscribe(ctx context.Context, handler func(msg *Message), channels ...string) error {
+	return r.subscribe(ctx, false, channels, handler, nil)
+}
+
+// 订阅频道，用法同 Subscribe，每次订阅（包括断线重连后重新订阅）成功后调用 onSubscribe
+// 断线期间发布的消息会丢失，依赖消息维护的本地状态可以在 onSubscribe 中重置
+func (r *Redis) SubscribeWithNotify(ctx context.Context, handler func(msg *Message), onSubscribe func(),
+	channels ...string) error {
+	return r.subscribe(ctx, false, channels, handler, onSubscribe)
+}
+
+// 按模式订阅频道，用法同 Subscribe
+func (r *Redis) PSubscribe(ctx context.Context, handler func(msg *Message), patterns ...string) error {
+	return r.subscribe(ctx, true, patterns, handler, nil)
+}
+
+// 订阅频道，消息通过返回的 channel 传递，ctx 结束后 channel 被关闭
+func (r *Redis) SubscribeChan(ctx context.Context, channels ...string) (<-chan *Message, error) {
+	return r.subscribeChan(ctx, false, channels)
+}
+
+// 按模式订阅频道，用法同 SubscribeChan
+func (r *Redis) PSubscribeChan(ctx context.Context, patterns ...string) (<-chan *Message, error) {
+	return r.subscribeChan(ctx, true, patterns)
+}
+
+func (r *Redis) subscribeChan(ctx context.Context, pattern bool, names []string) (<-chan *Message, error) {
+	if err := validateChannels(names); err != nil {
+		return nil, err
+	}
+	ch := make(chan *Message, pubSubChanSize)
+	go func() {
+		defer close(ch)
+		r.subscribe(ctx, pattern, names, func(msg *Message) {
+			select {
+			case ch <- msg:
+			case <-ctx.Done():
+			}
+		}, nil)
+	}()
+	return ch, nil
+}
+
+func (r *Redis) subscribe(ctx context.Context, pattern bool, names []string, handler func(msg *Message),
+	onSubscribe func()) error {
+	if err := validateChannels(names); err != nil {
+		return err
+	}
+	if handler == nil {
+		return fmt.Errorf("handler 不能为空")
+	}
+	backoff := pubSubMinBackoff
+	for {
+		subscribed, _ := r.receive(ctx, pattern, names, handler, onSubscribe)
+		if ctx.Err() != nil {
+			return nil
+		}
+		// 订阅成功过说明服务端可用，重新从最小等待时间开始
+		if subscribed {
+			backoff = pubSubMinBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > pubSubMaxBackoff {
+			backoff = pubSubMaxBackoff
+		}
+	}
+}
+
+// 建立一个独立的订阅连接并接收消息，直到连接出错或 ctx 结束
+// subscribed 表示本次连接是否订阅成功
+func (r *Redis) receive(ctx context.Context, pattern bool, names []string,
+	handler func(msg *Message), onSubscribe func()) (subscribed bool, err error) {
+	dial := r.RedisPool.Dial
+	if r.cluster != nil {
+		dial = r.cluster.dialNode
+	}
+	conn, err := dial()
+	if err != nil {
+		return false, err
+	}
+	psc := redis.PubSubConn{Conn: r.wrap(conn)}
+	defer psc.Close()
+
+	args := redis.Args{}.AddFlat(names)
+	if pattern {
+		err = psc.PSubscribe(args...)
+	} else {
+		err = psc.Subscribe(args...)
+	}
+	if l := r.logs(ctx); l != nil {
+		l.Debug("redis subscribe: %v, pattern: %v, error: %v", names, pattern, err)
+		defer func() {
+			l.Debug("redis subscription closed: %v, subscribed: %v, error: %v", names, subscribed, err)
+		}()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	done := make(chan error, 1)
+	ready := make(chan struct{})
+	go func() {
+		confirmed := 0
+		for {
+			switch v := psc.ReceiveWithTimeout(pubSubReadTimeout).(type) {
+			case redis.Message:
+				handler(&Message{Channel: v.Channel, Pattern: v.Pattern, Data: v.Data})
+			case redis.Subscription:
+				// 每个频道都会收到一次订阅确认
+				if confirmed++; confirmed == len(names) {
+					close(ready)
+				}
+			case error:
+				done <- v
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(pubSubPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ready:
+			subscribed = true
+			ready = nil
+			if onSubscribe != nil {
+				onSubscribe()
+			}
+		case <-ctx.Done():
+			// 关闭连接使接收协程退出
+			psc.Close()
+			<-done
+			return subscribed, nil
+		case err := <-done:
+			return subscribed, err
+		case <-ticker.C:
+			if err := psc.Ping(""); err != nil {
+				psc.Close()
+				<-done
+				return subscribed, err
+			}
+		}
+	}
+}
+
+func validateChannels(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("channels 不能为空")
+	}
+	for _, name := range names {
+		if utils.IsEmpty(name) {
+			return fmt.Errorf("channel 不能为空")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis发布订阅
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/liuchonglin/go-tools/redis/redistest"
+)
+
+// 持续发布消息直到订阅生效
+func waitSubscribers(t *testing.T, channel string, message string) {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if n, err := redisTool.Publish(channel, message); err == nil && n > 0 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("Publish() no subscribers on %s", channel)
+}
+
+func TestPublish(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel string
+		wantErr bool
+	}{
+		{
+			name:    "all",
+			channel: "pubsub:publish",
+		}, {
+			name:    "channel nil",
+			channel: "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := redisTool.Publish(tt.channel, "hello"); (err != nil) != tt.wantErr {
+				t.Errorf("Publish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan *Message, 10)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- redisTool.Subscribe(ctx, func(msg *Message) {
+			received <- msg
+		}, "pubsub:subscribe")
+	}()
+	waitSubscribers(t, "pubsub:subscribe", "hello")
+	select {
+	case msg := <-received:
+		if msg.Channel != "pubsub:subscribe" || string(msg.Data) != "hello" {
+			t.Errorf("Subscribe() message = %+v", msg)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Subscribe() no message received")
+	}
+	cancel()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("Subscribe() error = %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Errorf("Subscribe() not stopped after cancel")
+	}
+}
+
+// 断线重连后重新订阅成功时再次通知
+func TestSubscribeWithNotify(t *testing.T) {
+	server, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer server.Close()
+	r, err := NewRedis(&RedisConfig{Address: server.Addr(), MaxIdle: 1})
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	defer r.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notified := make(chan struct{}, 10)
+	go r.SubscribeWithNotify(ctx, func(msg *Message) {}, func() {
+		notified <- struct{}{}
+	}, "pubsub:notify")
+	for i := 0; i < 2; i++ {
+		select {
+		case <-notified:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("onSubscribe not called, round %d", i)
+		}
+		server.CloseClients()
+	}
+}
+
+func TestPSubscribeChan(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := redisTool.PSubscribeChan(ctx, "pubsub:pattern:*")
+	if err != nil {
+		t.Fatalf("PSubscribeChan() error = %v", err)
+	}
+	waitSubscribers(t, "pubsub:pattern:a", "hello")
+	msg := <-ch
+	if msg.Pattern != "pubsub:pattern:*" || msg.Channel != "pubsub:pattern:a" {
+		t.Errorf("PSubscribeChan() message = %+v", msg)
+	}
+	cancel()
+	for range ch {
+	}
+}
+
+func TestSubscribeValidate(t *testing.T) {
+	if err := redisTool.Subscribe(context.Background(), func(msg *Message) {}); err == nil {
+		t.Errorf("Subscribe() channels nil error = nil, wantErr true")
+	}
+	if err := redisTool.Subscribe(context.Background(), nil, "pubsub"); err == nil {
+		t.Errorf("Subscribe() handler nil error = nil, wantErr true")
+	}
+	if _, err := redisTool.SubscribeChan(context.Background(), ""); err == nil {
+		t.Errorf("SubscribeChan() channel nil error = nil, wantErr true")
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis游标遍历及按模式批量操作
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 每次 SCAN 的默认 COUNT，也是批量操作的默认批大小
+const defaultScanCount = 100
+
+// 游标迭代器，通过 Redis.Scan/HScan/SScan/ZScan 创建
+// SCAN 在集群模式下依次遍历所有主节点
+// 与 redis 的游标语义一致：遍历期间一直存在的元素至少返回一次，可能重复返回
+type ScanIterator struct {
+	pools       []*redis.Pool
+	wrap        func(ctx context.Context, conn redis.Conn) redis.Conn
+	commandName string
+	key         string
+	match       string
+	count       int
+
+	node   int
+	cursor string
+	values []string
+	value  string
+	err    error
+}
+
+// 遍历匹配 match 的 key，match 为空时遍历所有 key，count 小于等于 0 时使用默认值
+func (r *Redis) Scan(match string, count int) *ScanIterator {
+	it := newScanIterator(r.masterPools(), "scan", "", match, count)
+	it.wrap = r.wrapContext
+	return it
+}
+
+// 需要在每个主节点上执行的命令使用的连接池，集群模式下为所有主节点的连接池
+func (r *Redis) masterPools() []*redis.Pool {
+	if r.cluster == nil {
+		return []*redis.Pool{r.RedisPool}
+	}
+	var pools []*redis.Pool
+	for _, address := range r.cluster.masters() {
+		pools = append(pools, r.cluster.pool(address))
+	}
+	return pools
+}
+
+// 遍历 hash 的字段，Next 依次返回 field、value
+func (r *Redis) HScan(key string, match string, count int) *ScanIterator {
+	return r.scanKey("hscan", key, match, count)
+}
+
+// 遍历 set 的成员
+func (r *Redis) SScan(key string, match string, count int) *ScanIterator {
+	return r.scanKey("sscan", key, match, count)
+}
+
+// 遍历 sorted set 的成员，Next 依次返回 member、score
+func (r *Redis) ZScan(key string, match string, count int) *ScanIterator {
+	return r.scanKey("zscan", key, match, count)
+}
+
+func (r *Redis) scanKey(commandName string, key string, match string, count int) *ScanIterator {
+	it := newScanIterator([]*redis.Pool{r.RedisPool}, commandName, key, match, count)
+	it.wrap = r.wrapContext
+	if utils.IsEmpty(key) {
+		it.err = fmt.Errorf("key 不能为空")
+	}
+	return it
+}
+
+// 使用 Next 的 ctx 包装连接，通过 ScanContext 等方法创建时使用创建时的 ctx
+func (r *Redis) wrapContext(ctx context.Context, conn redis.Conn) redis.Conn {
+	if r.ctx != nil {
+		return r.wrap(conn)
+	}
+	return r.bind(ctx).wrap(conn)
+}
+
+func newScanIterator(pools []*redis.Pool, commandName string, key string, match string, count int) *ScanIterator {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+	return &ScanIterator{pools: pools, commandName: commandName, key: key, match: match, count: count, cursor: "0"}
+}
+
+// 移动到下一个元素，遍历结束、出错或 ctx 结束时返回 false，之后通过 Err 获取错误
+func (it *ScanIterator) Next(ctx context.Context) bool {
+	for len(it.values) == 0 {
+		if it.err != nil || it.node >= len(it.pools) {
+			return false
+		}
+		if err := ctx.Err(); err != nil {
+			it.err = err
+			return false
+		}
+		it.fetch(ctx)
+	}
+	it.value, it.values = it.values[0], it.values[1:]
+	return true
+}
+
+// 当前元素
+func (it *ScanIterator) Val() string {
+	return it.value
+}
+
+// 遍历中出现的错误
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+// 执行一次 SCAN，游标回到 0 时切换到下一个节点
+func (it *ScanIterator) fetch(ctx context.Context) {
+	conn, err := it.pools[it.node].GetContext(ctx)
+	if err != nil {
+		it.err = err
+		return
+	}
+	defer conn.Close()
+	if it.wrap != nil {
+		conn = it.wrap(ctx, conn)
+	}
+	args := redis.Args{}
+	if it.key != "" {
+		args = args.Add(it.key)
+	}
+	args = args.Add(it.cursor)
+	if it.match != "" {
+		args = args.Add("match", it.match)
+	}
+	args = args.Add("count", it.count)
+	// 返回值的结构为 [cursor, [element, ...]]
+	values, err := redis.Values(conn.Do(it.commandName, args...))
+	if err == nil && len(values) != 2 {
+		err = fmt.Errorf("redis %s 返回值格式错误", it.commandName)
+	}
+	if err != nil {
+		it.err = err
+		return
+	}
+	if it.cursor, err = redis.String(values[0], nil); err != nil {
+		it.err = err
+		return
+	}
+	if it.values, err = redis.Strings(values[1], nil); err != nil {
+		it.err = err
+		return
+	}
+	if it.cursor == "0" {
+		it.node++
+	}
+}
+
+// 删除匹配 pattern 的 key，每 batchSize 个 key 通过 UNLINK 删除一次，并通过 progress 报告已删除的数量
+// ctx 结束时停止，返回已删除的数量和 ctx 的错误，progress 可以为 nil
+// 所有命令都使用 ctx 的截止时间和日志
+func (r *Redis) DeleteByPattern(ctx context.Context, pattern string, batchSize int,
+	progress func(processed int64)) (int64, error) {
+	view := r.bind(ctx)
+	return view.byPattern(ctx, pattern, batchSize, progress, func(keys []string) (int64, error) {
+		// 集群模式下 key 不在同一个 slot 时由集群路由按 slot 拆分执行
+		return redis.Int64(view.do("unlink", redis.Args{}.AddFlat(keys)...))
+	})
+}
+
+// 为匹配 pattern 的 key 设置过期时间，用法同 DeleteByPattern，返回设置成功的数量
+func (r *Redis) ExpireByPattern(ctx context.Context, pattern string, ttl time.Duration, batchSize int,
+	progress func(processed int64)) (int64, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("ttl 必须大于 0")
+	}
+	ms := int64(ttl / time.Millisecond)
+	view := r.bind(ctx)
+	return view.byPattern(ctx, pattern, batchSize, progress, func(keys []string) (int64, error) {
+		return view.pipelineKeys(keys, "pexpire", ms)
+	})
+}
+
+func (r *Redis) byPattern(ctx context.Context, pattern string, batchSize int, progress func(processed int64),
+	apply func(keys []string) (int64, error)) (int64, error) {
+	if utils.IsEmpty(pattern) {
+		return 0, fmt.Errorf("pattern 不能为空")
+	}
+	if batchSize <= 0 {
+		batchSize = defaultScanCount
+	}
+	var processed int64
+	batch := make([]string, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := apply(batch)
+		processed += n
+		batch = batch[:0]
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(processed)
+		}
+		return nil
+	}
+	it := r.Scan(pattern, batchSize)
+	for it.Next(ctx) {
+		if batch = append(batch, it.Val()); len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return processed, err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return processed, err
+	}
+	return processed, flush()
+}
+
+// 通过管道对每个 key 执行一次命令，返回结果为 1 的数量
+func (r *Redis) pipelineKeys(keys []string, commandName string, args ...interface{}) (int64, error) {
+	p := r.Pipeline()
+	for _, key := range keys {
+		p.Send(commandName, append([]interface{}{key}, args...)...)
+	}
+	replies, err := p.Exec()
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, reply := range replies {
+		if v, err := reply.Int64(); err == nil && v == 1 {
+			n++
+		}
+	}
+	return n, nil
+}
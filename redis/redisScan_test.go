@@ -0,0 +1,114 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis游标遍历及按模式批量操作
+package redis
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	redisTool.DeleteByPattern(context.Background(), "scan:*", 0, nil)
+	redisTool.MSet(map[string]string{"scan:a": "1", "scan:b": "2", "scan:c": "3"})
+	redisTool.HMSet("scan:hash", map[string]string{"f1": "1", "f2": "2"})
+	tests := []struct {
+		name    string
+		it      *ScanIterator
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "scan",
+			it:   redisTool.Scan("scan:?", 1),
+			want: []string{"scan:a", "scan:b", "scan:c"},
+		}, {
+			name: "hscan",
+			it:   redisTool.HScan("scan:hash", "f*", 0),
+			want: []string{"1", "2", "f1", "f2"},
+		}, {
+			name:    "key nil",
+			it:      redisTool.SScan("", "", 0),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for tt.it.Next(context.Background()) {
+				got = append(got, tt.it.Val())
+			}
+			if err := tt.it.Err(); (err != nil) != tt.wantErr {
+				t.Fatalf("Err() = %v, wantErr %v", err, tt.wantErr)
+			}
+			sort.Strings(got)
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	it := redisTool.Scan("", 0)
+	if it.Next(ctx) {
+		t.Errorf("Next() = true, want false")
+	}
+	if it.Err() != context.Canceled {
+		t.Errorf("Err() = %v, want %v", it.Err(), context.Canceled)
+	}
+}
+
+func TestDeleteByPattern(t *testing.T) {
+	values := make(map[string]string)
+	for _, key := range []string{"user:1:session", "user:2:session", "user:3:session", "user:1:profile"} {
+		values[key] = "1"
+	}
+	redisTool.MSet(values)
+	var progress []int64
+	n, err := redisTool.DeleteByPattern(context.Background(), "user:*:session", 2, func(processed int64) {
+		progress = append(progress, processed)
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("DeleteByPattern() = %v, %v, want 3, nil", n, err)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != 3 {
+		t.Errorf("DeleteByPattern() progress = %v", progress)
+	}
+	if v, _ := redisTool.Get("user:1:profile"); v != "1" {
+		t.Errorf("Get() = %v, want 1", v)
+	}
+	if _, err := redisTool.DeleteByPattern(context.Background(), "", 0, nil); err == nil {
+		t.Errorf("DeleteByPattern() pattern nil error = nil, wantErr true")
+	}
+	redisTool.Del("user:1:profile")
+}
+
+func TestExpireByPattern(t *testing.T) {
+	redisTool.MSet(map[string]string{"expire:a": "1", "expire:b": "2"})
+	n, err := redisTool.ExpireByPattern(context.Background(), "expire:*", time.Minute, 0, nil)
+	if err != nil || n != 2 {
+		t.Fatalf("ExpireByPattern() = %v, %v, want 2, nil", n, err)
+	}
+	if _, err := redisTool.ExpireByPattern(context.Background(), "expire:*", 0, 0, nil); err == nil {
+		t.Errorf("ExpireByPattern() ttl zero error = nil, wantErr true")
+	}
+	redisTool.MDel("expire:a", "expire:b")
+}
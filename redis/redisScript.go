@@ -0,0 +1,99 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis lua脚本
+package redis
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// 已注册的脚本
+var scriptRegistry = struct {
+	sync.Mutex
+	scripts []*Script
+}{}
+
+// lua 脚本，通过 NewScript 注册后可由 Redis.LoadScripts 统一预加载
+type Script struct {
+	script *redis.Script
+}
+
+// 创建并注册脚本，keyCount 为 KEYS 的数量
+// 一般定义为包级变量，保证在 NewRedis 之前完成注册
+func NewScript(keyCount int, src string) *Script {
+	s := &Script{script: redis.NewScript(keyCount, src)}
+	scriptRegistry.Lock()
+	scriptRegistry.scripts = append(scriptRegistry.scripts, s)
+	scriptRegistry.Unlock()
+	return s
+}
+
+// 脚本的 sha1
+func (s *Script) Hash() string {
+	return s.script.Hash()
+}
+
+// 通过 SCRIPT LOAD 加载脚本
+func (s *Script) Load(conn redis.Conn) error {
+	return s.script.Load(conn)
+}
+
+// 通过 EVALSHA 执行脚本，服务端返回 NOSCRIPT（如主从切换后）时回退到 EVAL，
+// EVAL 会把脚本重新缓存到服务端，之后的调用继续使用 EVALSHA
+func (s *Script) Do(conn redis.Conn, keysAndArgs ...interface{}) (interface{}, error) {
+	return s.script.Do(conn, keysAndArgs...)
+}
+
+// 执行脚本
+func (r *Redis) Eval(script *Script, keysAndArgs ...interface{}) (interface{}, error) {
+	if script == nil {
+		return nil, fmt.Errorf("script 不能为空")
+	}
+	conn := r.conn()
+	defer conn.Close()
+	return script.Do(conn, keysAndArgs...)
+}
+
+// 预加载所有已注册的脚本，集群模式下加载到每个主节点
+func (r *Redis) LoadScripts() error {
+	scriptRegistry.Lock()
+	scripts := make([]*Script, len(scriptRegistry.scripts))
+	copy(scripts, scriptRegistry.scripts)
+	scriptRegistry.Unlock()
+
+	if r.cluster == nil {
+		return loadScripts(r.conn(), scripts)
+	}
+	for _, pool := range r.masterPools() {
+		if err := loadScripts(r.wrap(pool.Get()), scripts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 在 conn 上加载脚本，完成后关闭 conn
+func loadScripts(conn redis.Conn, scripts []*Script) error {
+	defer conn.Close()
+	for _, s := range scripts {
+		if err := s.Load(conn); err != nil {
+			return fmt.Errorf("redis 加载脚本失败 %s: %v", s.Hash(), err)
+		}
+	}
+	return nil
+}
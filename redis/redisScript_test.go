@@ -0,0 +1,90 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis lua脚本
+package redis
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var testScript = NewScript(1, `return redis.call("incrby", KEYS[1], ARGV[1])`)
+
+func TestEval(t *testing.T) {
+	requireRedisServer(t)
+	redisTool.Del("script:counter")
+	tests := []struct {
+		name    string
+		script  *Script
+		want    int64
+		wantErr bool
+	}{
+		{
+			name:   "all",
+			script: testScript,
+			want:   2,
+		}, {
+			name:    "script nil",
+			script:  nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redis.Int64(redisTool.Eval(tt.script, "script:counter", 2))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 服务端脚本缓存被清空后自动回退到 EVAL
+func TestEvalNoScript(t *testing.T) {
+	requireRedisServer(t)
+	redisTool.Del("script:noscript")
+	if _, err := redisTool.do("script", "flush"); err != nil {
+		t.Fatalf("script flush error = %v", err)
+	}
+	if got, err := redis.Int64(redisTool.Eval(testScript, "script:noscript", 1)); err != nil || got != 1 {
+		t.Errorf("Eval() = %v, %v, want 1, nil", got, err)
+	}
+	exists, err := redis.Ints(redisTool.do("script", "exists", testScript.Hash()))
+	if err != nil || len(exists) != 1 || exists[0] != 1 {
+		t.Errorf("script exists = %v, %v, want [1], nil", exists, err)
+	}
+}
+
+func TestLoadScripts(t *testing.T) {
+	requireRedisServer(t)
+	if _, err := redisTool.do("script", "flush"); err != nil {
+		t.Fatalf("script flush error = %v", err)
+	}
+	preload := *config
+	preload.PreloadScripts = true
+	r, err := NewRedis(&preload)
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	exists, err := redis.Ints(r.do("script", "exists", testScript.Hash(), unlockScript.Hash()))
+	if err != nil || len(exists) != 2 || exists[0] != 1 || exists[1] != 1 {
+		t.Errorf("script exists = %v, %v, want [1 1], nil", exists, err)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis哨兵模式
+package redis
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 空闲超过该时间的连接在借出前检查是否仍然是主节点
+const sentinelRoleCheckIdle = time.Second
+
+// 通过哨兵发现主节点，每次建立连接时重新查询，主从切换后新连接自动指向新的主节点
+type sentinel struct {
+	redisConfig *RedisConfig
+	dialer      *dialer
+	mu          sync.Mutex
+	addresses   []string
+}
+
+func newSentinel(redisConfig *RedisConfig, d *dialer) (*sentinel, error) {
+	if utils.IsEmpty(redisConfig.MasterName) {
+		return nil, fmt.Errorf("redis 哨兵模式 masterName 不能为空")
+	}
+	if len(redisConfig.SentinelAddresses) == 0 {
+		return nil, fmt.Errorf("redis 哨兵模式 sentinelAddresses 不能为空")
+	}
+	addresses := make([]string, len(redisConfig.SentinelAddresses))
+	copy(addresses, redisConfig.SentinelAddresses)
+	return &sentinel{redisConfig: redisConfig, dialer: d, addresses: addresses}, nil
+}
+
+// 连接当前的主节点
+func (s *sentinel) dial() (redis.Conn, error) {
+	address, err := s.masterAddress()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.dialer.dial(address)
+	if err != nil {
+		return nil, err
+	}
+	// 哨兵返回的地址可能尚未完成切换，确认角色后再使用
+	if err := checkMasterRole(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// 长时间空闲的连接可能指向已经降级的旧主节点
+func (s *sentinel) testOnBorrow(conn redis.Conn, t time.Time) error {
+	if time.Since(t) < sentinelRoleCheckIdle {
+		return nil
+	}
+	return checkMasterRole(conn)
+}
+
+// 依次询问哨兵获取主节点地址，成功的哨兵移到最前面
+func (s *sentinel) masterAddress() (string, error) {
+	s.mu.Lock()
+	addresses := make([]string, len(s.addresses))
+	copy(addresses, s.addresses)
+	s.mu.Unlock()
+
+	var lastErr error
+	for i, address := range addresses {
+		master, err := s.queryMaster(address)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if i > 0 {
+			s.mu.Lock()
+			s.addresses[0], s.addresses[i] = s.addresses[i], s.addresses[0]
+			s.mu.Unlock()
+		}
+		return master, nil
+	}
+	return "", fmt.Errorf("redis 哨兵获取主节点失败: %v", lastErr)
+}
+
+func (s *sentinel) queryMaster(address string) (string, error) {
+	options := []redis.DialOption{
+		redis.DialConnectTimeout(s.dialer.connectTimeout),
+		redis.DialReadTimeout(s.dialer.readTimeout),
+		redis.DialWriteTimeout(s.dialer.writeTimeout),
+	}
+	if !utils.IsEmpty(s.redisConfig.SentinelPassword) {
+		options = append(options, redis.DialPassword(s.redisConfig.SentinelPassword))
+	}
+	conn, err := redis.Dial("tcp", address, options...)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	values, err := redis.Strings(conn.Do("sentinel", "get-master-addr-by-name", s.redisConfig.MasterName))
+	if err != nil {
+		return "", err
+	}
+	if len(values) != 2 {
+		return "", fmt.Errorf("redis 哨兵返回的主节点地址错误: %v", values)
+	}
+	return net.JoinHostPort(values[0], values[1]), nil
+}
+
+// 确认连接的节点是主节点
+func checkMasterRole(conn redis.Conn) error {
+	values, err := redis.Values(conn.Do("role"))
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("redis role 返回值为空")
+	}
+	role, err := redis.String(values[0], nil)
+	if err != nil {
+		return err
+	}
+	if role != "master" {
+		return fmt.Errorf("redis 节点不是主节点: %s", role)
+	}
+	return nil
+}
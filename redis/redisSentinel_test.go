@@ -0,0 +1,62 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis哨兵模式
+package redis
+
+import (
+	"testing"
+)
+
+func TestNewRedisSentinel(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *RedisConfig
+		wantErr bool
+	}{
+		{
+			name:    "masterName nil",
+			config:  &RedisConfig{Mode: SENTINEL, SentinelAddresses: []string{"localhost:26379"}},
+			wantErr: true,
+		}, {
+			name:    "sentinelAddresses nil",
+			config:  &RedisConfig{Mode: SENTINEL, MasterName: "mymaster"},
+			wantErr: true,
+		}, {
+			name: "sentinel not available",
+			config: &RedisConfig{
+				Mode:              SENTINEL,
+				MasterName:        "mymaster",
+				SentinelAddresses: []string{"localhost:1"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRedis(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("NewRedis() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckMasterRole(t *testing.T) {
+	requireRedisServer(t)
+	conn := redisTool.RedisPool.Get()
+	defer conn.Close()
+	if err := checkMasterRole(conn); err != nil {
+		t.Errorf("checkMasterRole() error = %v", err)
+	}
+}
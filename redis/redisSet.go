@@ -0,0 +1,69 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis set 操作
+package redis
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 向集合添加成员，返回新增成员的数量
+func (r *Redis) SAdd(key string, members ...string) (int, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	if len(members) == 0 {
+		return 0, fmt.Errorf("members 不能为空")
+	}
+	return redis.Int(r.do("sadd", redis.Args{}.Add(key).AddFlat(members)...))
+}
+
+// 从集合删除成员，返回实际删除的数量
+func (r *Redis) SRem(key string, members ...string) (int, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	if len(members) == 0 {
+		return 0, fmt.Errorf("members 不能为空")
+	}
+	return redis.Int(r.do("srem", redis.Args{}.Add(key).AddFlat(members)...))
+}
+
+// 获取集合所有成员
+func (r *Redis) SMembers(key string) ([]string, error) {
+	if utils.IsEmpty(key) {
+		return nil, fmt.Errorf("key 不能为空")
+	}
+	return redis.Strings(r.do("smembers", key))
+}
+
+// 判断 member 是否是集合成员
+func (r *Redis) SIsMember(key string, member string) (bool, error) {
+	if utils.IsEmpty(key) {
+		return false, fmt.Errorf("key 不能为空")
+	}
+	return redis.Bool(r.do("sismember", key, member))
+}
+
+// 获取集合成员数量
+func (r *Redis) SCard(key string) (int, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	return redis.Int(r.do("scard", key))
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis set 操作
+package redis
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestSAdd(t *testing.T) {
+	redisTool.Del("set")
+	tests := []struct {
+		name    string
+		key     string
+		members []string
+		want    int
+		wantErr bool
+	}{
+		{
+			name:    "all",
+			key:     "set",
+			members: []string{"a", "b", "a"},
+			want:    2,
+		}, {
+			name:    "key nil",
+			key:     "",
+			members: []string{"a"},
+			wantErr: true,
+		}, {
+			name:    "members nil",
+			key:     "set",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisTool.SAdd(tt.key, tt.members...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SAdd() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("SAdd() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSMembers(t *testing.T) {
+	redisTool.Del("set:members")
+	redisTool.SAdd("set:members", "a", "b", "c")
+	if n, err := redisTool.SRem("set:members", "c"); err != nil || n != 1 {
+		t.Errorf("SRem() = %v, %v, want 1, nil", n, err)
+	}
+	got, err := redisTool.SMembers("set:members")
+	if err != nil {
+		t.Fatalf("SMembers() error = %v", err)
+	}
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("SMembers() = %v, want [a b]", got)
+	}
+	if ok, err := redisTool.SIsMember("set:members", "a"); err != nil || !ok {
+		t.Errorf("SIsMember() = %v, %v, want true, nil", ok, err)
+	}
+	if n, err := redisTool.SCard("set:members"); err != nil || n != 2 {
+		t.Errorf("SCard() = %v, %v, want 2, nil", n, err)
+	}
+}
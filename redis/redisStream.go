@@ -0,0 +1,390 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis stream 消费组
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+const (
+	// 死信中记录原消息 id 和投递次数的字段
+	deadLetterIdField         = "deadLetterOriginId"
+	deadLetterDeliveriesField = "deadLetterDeliveries"
+)
+
+// stream 消息
+type StreamMessage struct {
+	// 消息 id
+	Id string
+	// 消息内容
+	Values map[string]string
+}
+
+// stream 消费者配置
+type StreamConsumerConfig struct {
+	// stream 名称
+	Stream string `json:"stream" yaml:"stream"`
+	// 消费组名称，不存在时自动创建
+	Group string `json:"group" yaml:"group"`
+	// 消费者名称，同一消费组内唯一
+	Consumer string `json:"consumer" yaml:"consumer"`
+	// 每次读取的最大消息数
+	// 默认值：10
+	Count int `json:"count" yaml:"count"`
+	// 阻塞读取的等待时间，单位：毫秒
+	// 默认值：2000
+	Block int `json:"block" yaml:"block"`
+	// 消息未确认超过该时间后被重新认领，单位：秒
+	// 默认值：60
+	MinIdle int `json:"minIdle" yaml:"minIdle"`
+	// 检查待确认消息的间隔，单位：秒
+	// 默认值：30
+	ClaimInterval int `json:"claimInterval" yaml:"claimInterval"`
+	// 最大投递次数，超过后转入死信 stream
+	// 默认值：5
+	MaxDeliveries int64 `json:"maxDeliveries" yaml:"maxDeliveries"`
+	// 死信 stream 名称
+	// 默认值：Stream + ":dead"
+	DeadLetterStream string `json:"deadLetterStream" yaml:"deadLetterStream"`
+}
+
+func (s *StreamConsumerConfig) defaultValue() {
+	if s.Count == 0 {
+		s.Count = 10
+	}
+	if s.Block == 0 {
+		s.Block = 2000
+	}
+	if s.MinIdle == 0 {
+		s.MinIdle = 60
+	}
+	if s.ClaimInterval == 0 {
+		s.ClaimInterval = 30
+	}
+	if s.MaxDeliveries == 0 {
+		s.MaxDeliveries = 5
+	}
+	if utils.IsEmpty(s.DeadLetterStream) {
+		s.DeadLetterStream = s.Stream + ":dead"
+	}
+}
+
+// stream 消费者，保证消息至少被成功处理一次
+type StreamConsumer struct {
+	redis        *Redis
+	config       StreamConsumerConfig
+	handler      func(ctx context.Context, msg *StreamMessage) error
+	errorHandler func(err error)
+}
+
+// 向 stream 追加消息，maxLen 大于 0 时近似裁剪到该长度，返回消息 id
+func (r *Redis) XAdd(stream string, maxLen int64, values map[string]string) (string, error) {
+	if utils.IsEmpty(stream) {
+		return "", fmt.Errorf("stream 不能为空")
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("values 不能为空")
+	}
+	args := redis.Args{}.Add(stream)
+	if maxLen > 0 {
+		args = args.Add("maxlen", "~", maxLen)
+	}
+	args = args.Add("*").AddFlat(values)
+	return redis.String(r.do("xadd", args...))
+}
+
+// 获取 stream 的消息数量
+func (r *Redis) XLen(stream string) (int64, error) {
+	if utils.IsEmpty(stream) {
+		return 0, fmt.Errorf("stream 不能为空")
+	}
+	return redis.Int64(r.do("xlen", stream))
+}
+
+// 创建 stream 消费者，handler 返回 nil 时确认消息，返回错误时消息留在待确认列表中等待重新投递
+// 认领待确认消息使用 XPENDING 的 IDLE 参数，需要 redis 6.2 及以上版本
+// 读取新消息和认领待确认消息在不同的 goroutine 中进行，handler 可能被并发调用，需要自行保证并发安全
+func (r *Redis) NewStreamConsumer(config *StreamConsumerConfig,
+	handler func(ctx context.Context, msg *StreamMessage) error) (*StreamConsumer, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config 不能为空")
+	}
+	if utils.IsEmpty(config.Stream) || utils.IsEmpty(config.Group) || utils.IsEmpty(config.Consumer) {
+		return nil, fmt.Errorf("stream or group or consumer 不能为空")
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("handler 不能为空")
+	}
+	c := &StreamConsumer{redis: r, config: *config, handler: handler}
+	c.config.defaultValue()
+	return c, nil
+}
+
+// 设置错误回调，读取、处理、确认消息以及转入死信时的错误都会通过该回调通知，需要在 Run 之前调用
+// 未设置时错误写入 redis 的日志
+func (c *StreamConsumer) SetErrorHandler(f func(err error)) {
+	c.errorHandler = f
+}
+
+// 开始消费，阻塞直到 ctx 结束
+// ctx 结束后不再读取新消息，等待正在处理的消息完成后返回
+func (c *StreamConsumer) Run(ctx context.Context) error {
+	if err := c.createGroup(); err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.claimLoop(ctx)
+	}()
+	defer wg.Wait()
+
+	for ctx.Err() == nil {
+		messages, err := c.read()
+		if err != nil {
+			c.reportError(ctx, "xreadgroup", err)
+			// 消费组被删除（或 stream 被删除）时重新创建
+			if isNoGroup(err) {
+				if err := c.createGroup(); err != nil {
+					c.reportError(ctx, "xgroup create", err)
+				}
+			}
+			// 读取失败时稍后重试，避免连接异常时空转
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, msg := range messages {
+			c.handle(ctx, msg)
+		}
+	}
+	return nil
+}
+
+// 创建消费组，已存在时忽略
+func (c *StreamConsumer) createGroup() error {
+	_, err := c.redis.do("xgroup", "create", c.config.Stream, c.config.Group, "0", "mkstream")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// 读取新消息
+func (c *StreamConsumer) read() ([]*StreamMessage, error) {
+	conn := c.redis.conn()
+	defer conn.Close()
+	block := time.Duration(c.config.Block) * time.Millisecond
+	reply, err := redis.DoWithTimeout(conn, block+time.Second, "xreadgroup",
+		"group", c.config.Group, c.config.Consumer, "count", c.config.Count, "block", c.config.Block,
+		"streams", c.config.Stream, ">")
+	if reply == nil && err == nil {
+		return nil, nil
+	}
+	streams, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	var messages []*StreamMessage
+	for _, stream := range streams {
+		// 每个 stream 的结构为 [name, [[id, [field, value, ...]], ...]]
+		values, err := redis.Values(stream, nil)
+		if err != nil || len(values) != 2 {
+			return nil, fmt.Errorf("redis stream 返回值格式错误: %v", err)
+		}
+		msgs, err := streamMessages(values[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msgs...)
+	}
+	return messages, nil
+}
+
+// 处理消息，成功后确认
+func (c *StreamConsumer) handle(ctx context.Context, msg *StreamMessage) {
+	if err := c.safeHandle(ctx, msg); err != nil {
+		c.reportError(ctx, "handle "+msg.Id, err)
+		return
+	}
+	if _, err := c.redis.do("xack", c.config.Stream, c.config.Group, msg.Id); err != nil {
+		c.reportError(ctx, "xack "+msg.Id, err)
+	}
+}
+
+func (c *StreamConsumer) safeHandle(ctx context.Context, msg *StreamMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("got panic in stream handler: %+v", r)
+		}
+	}()
+	return c.handler(ctx, msg)
+}
+
+// 定期认领长时间未确认的消息（消费者崩溃或处理失败）
+func (c *StreamConsumer) claimLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(c.config.ClaimInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.claim(ctx); err != nil {
+				c.reportError(ctx, "claim", err)
+			}
+		}
+	}
+}
+
+// 认领待确认消息：超过最大投递次数的转入死信，其余重新处理
+// 按 Count 分页遍历整个待确认列表，直到取完或 ctx 结束
+func (c *StreamConsumer) claim(ctx context.Context) error {
+	start := "-"
+	for ctx.Err() == nil {
+		last, n, err := c.claimPage(ctx, start)
+		if err != nil {
+			return err
+		}
+		if n < c.config.Count {
+			return nil
+		}
+		// 从上一页最后一条之后继续（不包含该条）
+		start = "(" + last
+	}
+	return nil
+}
+
+// 认领从 start 开始的一页空闲时间超过 MinIdle 的待确认消息，返回本页最后一条消息 id 和条数
+func (c *StreamConsumer) claimPage(ctx context.Context, start string) (string, int, error) {
+	minIdle := int64(c.config.MinIdle) * 1000
+	// XPENDING 返回 [[id, consumer, idle, deliveries], ...]
+	pending, err := redis.Values(c.redis.do("xpending", c.config.Stream, c.config.Group,
+		"idle", minIdle, start, "+", c.config.Count))
+	if err != nil {
+		return "", 0, err
+	}
+	deliveries := make(map[string]int64, len(pending))
+	ids := make([]string, 0, len(pending))
+	for _, p := range pending {
+		var id, consumer string
+		var idle, count int64
+		values, err := redis.Values(p, nil)
+		if err != nil {
+			return "", 0, err
+		}
+		if _, err := redis.Scan(values, &id, &consumer, &idle, &count); err != nil {
+			return "", 0, err
+		}
+		deliveries[id] = count
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return "", 0, nil
+	}
+	last := ids[len(ids)-1]
+	args := redis.Args{}.Add(c.config.Stream, c.config.Group, c.config.Consumer, minIdle).AddFlat(ids)
+	messages, err := streamMessages(c.redis.do("xclaim", args...))
+	if err != nil {
+		return "", 0, err
+	}
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			break
+		}
+		if deliveries[msg.Id] >= c.config.MaxDeliveries {
+			c.deadLetter(ctx, msg, deliveries[msg.Id])
+			continue
+		}
+		c.handle(ctx, msg)
+	}
+	return last, len(ids), nil
+}
+
+// 转入死信 stream 并确认原消息
+func (c *StreamConsumer) deadLetter(ctx context.Context, msg *StreamMessage, deliveries int64) {
+	values := make(map[string]string, len(msg.Values)+2)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values[deadLetterIdField] = msg.Id
+	values[deadLetterDeliveriesField] = fmt.Sprint(deliveries)
+	if _, err := c.redis.XAdd(c.config.DeadLetterStream, 0, values); err != nil {
+		c.reportError(ctx, "dead letter "+msg.Id, err)
+		return
+	}
+	if _, err := c.redis.do("xack", c.config.Stream, c.config.Group, msg.Id); err != nil {
+		c.reportError(ctx, "xack "+msg.Id, err)
+	}
+}
+
+// 通知错误回调，未设置回调时写入日志
+func (c *StreamConsumer) reportError(ctx context.Context, op string, err error) {
+	err = fmt.Errorf("redis stream %s group %s %s: %v", c.config.Stream, c.config.Group, op, err)
+	if c.errorHandler != nil {
+		c.errorHandler(err)
+		return
+	}
+	if l := c.redis.logs(ctx); l != nil {
+		l.Error("%v", err)
+	}
+}
+
+// 消费组或 stream 不存在
+func isNoGroup(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOGROUP")
+}
+
+// 将 [[id, [field, value, ...]], ...] 转换为 []*StreamMessage，已被删除的消息会被忽略
+func streamMessages(reply interface{}, err error) ([]*StreamMessage, error) {
+	entries, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*StreamMessage, 0, len(entries))
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		values, err := redis.Values(entry, nil)
+		if err != nil || len(values) != 2 {
+			return nil, fmt.Errorf("redis stream 消息格式错误: %v", err)
+		}
+		id, err := redis.String(values[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		if values[1] == nil {
+			continue
+		}
+		fields, err := redis.StringMap(values[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, &StreamMessage{Id: id, Values: fields})
+	}
+	return messages, nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis stream 消费组
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestXAdd(t *testing.T) {
+	requireRedisServer(t)
+	redisTool.Del("stream:add")
+	tests := []struct {
+		name    string
+		stream  string
+		values  map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "all",
+			stream: "stream:add",
+			values: map[string]string{"orderId": "1"},
+		}, {
+			name:    "stream nil",
+			stream:  "",
+			values:  map[string]string{"orderId": "1"},
+			wantErr: true,
+		}, {
+			name:    "values nil",
+			stream:  "stream:add",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := redisTool.XAdd(tt.stream, 100, tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("XAdd() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && id == "" {
+				t.Errorf("XAdd() id is empty")
+			}
+		})
+	}
+	if n, err := redisTool.XLen("stream:add"); err != nil || n != 1 {
+		t.Errorf("XLen() = %v, %v, want 1, nil", n, err)
+	}
+}
+
+func TestNewStreamConsumer(t *testing.T) {
+	handler := func(ctx context.Context, msg *StreamMessage) error { return nil }
+	tests := []struct {
+		name    string
+		config  *StreamConsumerConfig
+		handler func(ctx context.Context, msg *StreamMessage) error
+		wantErr bool
+	}{
+		{
+			name:    "all",
+			config:  &StreamConsumerConfig{Stream: "stream", Group: "group", Consumer: "consumer"},
+			handler: handler,
+		}, {
+			name:    "config nil",
+			handler: handler,
+			wantErr: true,
+		}, {
+			name:    "group nil",
+			config:  &StreamConsumerConfig{Stream: "stream", Consumer: "consumer"},
+			handler: handler,
+			wantErr: true,
+		}, {
+			name:    "handler nil",
+			config:  &StreamConsumerConfig{Stream: "stream", Group: "group", Consumer: "consumer"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := redisTool.NewStreamConsumer(tt.config, tt.handler); (err != nil) != tt.wantErr {
+				t.Errorf("NewStreamConsumer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 处理失败的消息被重新认领，超过最大投递次数后进入死信
+func TestStreamConsumerErrorHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(ctx context.Context, msg *StreamMessage) error
+		want    string
+	}{
+		{
+			name:    "error",
+			handler: func(ctx context.Context, msg *StreamMessage) error { return errors.New("failed") },
+			want:    "failed",
+		}, {
+			name:    "panic",
+			handler: func(ctx context.Context, msg *StreamMessage) error { panic("boom") },
+			want:    "boom",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := redisTool.NewStreamConsumer(&StreamConsumerConfig{Stream: "stream", Group: "group", Consumer: "consumer"}, tt.handler)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got error
+			c.SetErrorHandler(func(err error) { got = err })
+			c.handle(context.Background(), &StreamMessage{Id: "1-0"})
+			if got == nil || !strings.Contains(got.Error(), tt.want) || !strings.Contains(got.Error(), "1-0") {
+				t.Errorf("handle() reported %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamConsumer(t *testing.T) {
+	requireRedisServer(t)
+	redisTool.MDel("stream:jobs", "stream:jobs:dead")
+	redisTool.XAdd("stream:jobs", 0, map[string]string{"job": "ok"})
+	redisTool.XAdd("stream:jobs", 0, map[string]string{"job": "retry"})
+	redisTool.XAdd("stream:jobs", 0, map[string]string{"job": "fail"})
+
+	var mu sync.Mutex
+	handled := make(map[string]int)
+	consumer, err := redisTool.NewStreamConsumer(&StreamConsumerConfig{
+		Stream:        "stream:jobs",
+		Group:         "workers",
+		Consumer:      "worker-1",
+		Block:         100,
+		MinIdle:       1,
+		ClaimInterval: 1,
+		MaxDeliveries: 2,
+	}, func(ctx context.Context, msg *StreamMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		job := msg.Values["job"]
+		handled[job]++
+		if job == "fail" || (job == "retry" && handled[job] == 1) {
+			return errors.New("handle error")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("NewStreamConsumer() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			if n, _ := redisTool.XLen("stream:jobs:dead"); n > 0 {
+				cancel()
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+	if err := consumer.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if handled["ok"] != 1 || handled["retry"] != 2 || handled["fail"] != 2 {
+		t.Errorf("Run() handled = %v", handled)
+	}
+	if n, err := redisTool.XLen("stream:jobs:dead"); err != nil || n != 1 {
+		t.Errorf("dead letter XLen() = %v, %v, want 1, nil", n, err)
+	}
+}
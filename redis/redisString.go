@@ -0,0 +1,182 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis string及key操作
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// TTL 返回的 key 未设置过期时间
+const NoExpire time.Duration = -1
+
+// SET 的可选参数
+type SetOptions struct {
+	// 过期时间，大于 0 时设置，精度为毫秒
+	Expire time.Duration
+	// 只在 key 不存在时设置
+	NX bool
+	// 只在 key 存在时设置
+	XX bool
+	// 保留 key 原有的过期时间，不能与 Expire 同时使用，需要 redis 6.0 以上
+	KeepTTL bool
+}
+
+// 通过一条 SET 命令设置值和过期时间，opts 可以为 nil
+// NX/XX 条件不满足时返回 false
+func (r *Redis) SetWithOptions(key string, value string, opts *SetOptions) (bool, error) {
+	if utils.IsEmpty(key) {
+		return false, fmt.Errorf("key 不能为空")
+	}
+	if opts == nil {
+		opts = &SetOptions{}
+	}
+	if opts.NX && opts.XX {
+		return false, fmt.Errorf("NX 和 XX 不能同时使用")
+	}
+	if opts.KeepTTL && opts.Expire > 0 {
+		return false, fmt.Errorf("KeepTTL 和 Expire 不能同时使用")
+	}
+	args := redis.Args{}.Add(key, value)
+	if opts.Expire > 0 {
+		args = args.Add("px", milliseconds(opts.Expire))
+	}
+	if opts.NX {
+		args = args.Add("nx")
+	}
+	if opts.XX {
+		args = args.Add("xx")
+	}
+	if opts.KeepTTL {
+		args = args.Add("keepttl")
+	}
+	reply, err := r.do("set", args...)
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// key 不存在时设置值，expire 大于 0 时同时设置过期时间，返回是否设置成功
+func (r *Redis) SetNX(key string, value string, expire time.Duration) (bool, error) {
+	return r.SetWithOptions(key, value, &SetOptions{Expire: expire, NX: true})
+}
+
+// 设置新值并返回旧值，key 原先不存在时返回 ErrNotFound（新值仍然会被设置）
+// 与 GETSET 一致，key 原有的过期时间会被清除
+func (r *Redis) GetSet(key string, value string) (string, error) {
+	if utils.IsEmpty(key) {
+		return "", fmt.Errorf("key 不能为空")
+	}
+	reply, err := r.do("getset", key, value)
+	if reply == nil && err == nil {
+		return "", ErrNotFound
+	}
+	return redis.String(reply, err)
+}
+
+// 将 key 的值加上 delta 并返回结果，key 不存在时从 0 开始
+// expire 大于 0 时只在 key 被创建时设置过期时间，已存在的 key 保留原有的过期时间
+func (r *Redis) IncrBy(key string, delta int64, expire time.Duration) (int64, error) {
+	return redis.Int64(r.incr(key, "incrby", delta, expire))
+}
+
+// 将 key 的值加上浮点数 delta 并返回结果，用法同 IncrBy
+func (r *Redis) IncrByFloat(key string, delta float64, expire time.Duration) (float64, error) {
+	return redis.Float64(r.incr(key, "incrbyfloat", delta, expire))
+}
+
+// 在事务中先通过 SET NX PX 创建带过期时间的 key，再执行自增，保证不会留下没有过期时间的 key
+func (r *Redis) incr(key string, commandName string, delta interface{}, expire time.Duration) (interface{}, error) {
+	if utils.IsEmpty(key) {
+		return nil, fmt.Errorf("key 不能为空")
+	}
+	if expire <= 0 {
+		return r.do(commandName, key, delta)
+	}
+	conn := r.conn()
+	defer conn.Close()
+	conn.Send("multi")
+	conn.Send("set", key, 0, "px", milliseconds(expire), "nx")
+	conn.Send(commandName, key, delta)
+	values, err := redis.Values(conn.Do("exec"))
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 2 {
+		return nil, fmt.Errorf("redis %s 返回值格式错误", commandName)
+	}
+	if e, ok := values[1].(redis.Error); ok {
+		return nil, e
+	}
+	return values[1], nil
+}
+
+// 判断 key 是否存在
+func (r *Redis) Exists(key string) (bool, error) {
+	if utils.IsEmpty(key) {
+		return false, fmt.Errorf("key 不能为空")
+	}
+	return redis.Bool(r.do("exists", key))
+}
+
+// 设置过期时间，key 不存在时返回 false
+func (r *Redis) Expire(key string, expire time.Duration) (bool, error) {
+	if utils.IsEmpty(key) {
+		return false, fmt.Errorf("key 不能为空")
+	}
+	if expire <= 0 {
+		return false, fmt.Errorf("expire 必须大于 0")
+	}
+	return redis.Bool(r.do("pexpire", key, milliseconds(expire)))
+}
+
+// 获取剩余过期时间，key 不存在时返回 ErrNotFound，未设置过期时间时返回 NoExpire
+func (r *Redis) TTL(key string) (time.Duration, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	ms, err := redis.Int64(r.do("pttl", key))
+	if err != nil {
+		return 0, err
+	}
+	switch ms {
+	case -2:
+		return 0, ErrNotFound
+	case -1:
+		return NoExpire, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// 移除过期时间，key 不存在或未设置过期时间时返回 false
+func (r *Redis) Persist(key string) (bool, error) {
+	if utils.IsEmpty(key) {
+		return false, fmt.Errorf("key 不能为空")
+	}
+	return redis.Bool(r.do("persist", key))
+}
+
+// 转换为毫秒，不足 1 毫秒时按 1 毫秒处理
+func milliseconds(d time.Duration) int64 {
+	if ms := int64(d / time.Millisecond); ms > 0 {
+		return ms
+	}
+	return 1
+}
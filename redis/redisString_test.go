@@ -0,0 +1,189 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis string及key操作
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetNotFound(t *testing.T) {
+	redisTool.Del("string:missing")
+	if _, err := redisTool.Get("string:missing"); err != ErrNotFound {
+		t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestSetWithOptions(t *testing.T) {
+	redisTool.Del("string:opts")
+	tests := []struct {
+		name    string
+		opts    *SetOptions
+		want    bool
+		wantTTL bool
+		wantErr bool
+	}{
+		{
+			name: "xx missing",
+			opts: &SetOptions{XX: true},
+			want: false,
+		}, {
+			name:    "nx expire",
+			opts:    &SetOptions{NX: true, Expire: time.Minute},
+			want:    true,
+			wantTTL: true,
+		}, {
+			name: "nx exists",
+			opts: &SetOptions{NX: true},
+			want: false,
+		}, {
+			name:    "keepttl",
+			opts:    &SetOptions{XX: true, KeepTTL: true},
+			want:    true,
+			wantTTL: true,
+		}, {
+			name: "nil",
+			want: true,
+		}, {
+			name:    "nx and xx",
+			opts:    &SetOptions{NX: true, XX: true},
+			wantErr: true,
+		}, {
+			name:    "keepttl and expire",
+			opts:    &SetOptions{KeepTTL: true, Expire: time.Minute},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisTool.SetWithOptions("string:opts", "v", tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SetWithOptions() = %v, want %v", got, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			ttl, _ := redisTool.TTL("string:opts")
+			if (ttl > 0) != tt.wantTTL {
+				t.Errorf("TTL() = %v, wantTTL %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestSetNX(t *testing.T) {
+	redisTool.Del("string:nx")
+	if ok, err := redisTool.SetNX("string:nx", "1", time.Minute); err != nil || !ok {
+		t.Errorf("SetNX() = %v, %v, want true, nil", ok, err)
+	}
+	if ok, err := redisTool.SetNX("string:nx", "2", time.Minute); err != nil || ok {
+		t.Errorf("SetNX() = %v, %v, want false, nil", ok, err)
+	}
+	if _, err := redisTool.SetNX("", "1", 0); err == nil {
+		t.Errorf("SetNX() key nil error = nil, wantErr true")
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	redisTool.Del("string:getset")
+	if _, err := redisTool.GetSet("string:getset", "1"); err != ErrNotFound {
+		t.Errorf("GetSet() error = %v, want %v", err, ErrNotFound)
+	}
+	if old, err := redisTool.GetSet("string:getset", "2"); err != nil || old != "1" {
+		t.Errorf("GetSet() = %v, %v, want 1, nil", old, err)
+	}
+}
+
+func TestIncrBy(t *testing.T) {
+	redisTool.MDel("string:incr", "string:incrfloat")
+	tests := []struct {
+		name    string
+		key     string
+		delta   int64
+		expire  time.Duration
+		want    int64
+		wantErr bool
+	}{
+		{
+			name:   "create with expire",
+			key:    "string:incr",
+			delta:  2,
+			expire: time.Minute,
+			want:   2,
+		}, {
+			name:  "incr",
+			key:   "string:incr",
+			delta: -5,
+			want:  -3,
+		}, {
+			name:    "key nil",
+			key:     "",
+			delta:   1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisTool.IncrBy(tt.key, tt.delta, tt.expire)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IncrBy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("IncrBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// 已存在的 key 保留创建时的过期时间
+	if ttl, err := redisTool.TTL("string:incr"); err != nil || ttl <= 0 {
+		t.Errorf("TTL() = %v, %v, want > 0", ttl, err)
+	}
+	if got, err := redisTool.IncrByFloat("string:incrfloat", 1.5, time.Minute); err != nil || got != 1.5 {
+		t.Errorf("IncrByFloat() = %v, %v, want 1.5, nil", got, err)
+	}
+	redisTool.Set("string:incr", "x")
+	if _, err := redisTool.IncrBy("string:incr", 1, time.Minute); err == nil {
+		t.Errorf("IncrBy() not integer error = nil, wantErr true")
+	}
+}
+
+func TestExpireAndPersist(t *testing.T) {
+	redisTool.Set("string:ttl", "1")
+	if ok, _ := redisTool.Exists("string:ttl"); !ok {
+		t.Errorf("Exists() = false, want true")
+	}
+	if ttl, err := redisTool.TTL("string:ttl"); err != nil || ttl != NoExpire {
+		t.Errorf("TTL() = %v, %v, want NoExpire", ttl, err)
+	}
+	if ok, err := redisTool.Expire("string:ttl", time.Minute); err != nil || !ok {
+		t.Errorf("Expire() = %v, %v, want true, nil", ok, err)
+	}
+	if ttl, _ := redisTool.TTL("string:ttl"); ttl <= 59*time.Second {
+		t.Errorf("TTL() = %v, want about 1m", ttl)
+	}
+	if ok, err := redisTool.Persist("string:ttl"); err != nil || !ok {
+		t.Errorf("Persist() = %v, %v, want true, nil", ok, err)
+	}
+	redisTool.Del("string:ttl")
+	if _, err := redisTool.TTL("string:ttl"); err != ErrNotFound {
+		t.Errorf("TTL() error = %v, want %v", err, ErrNotFound)
+	}
+	if ok, _ := redisTool.Expire("string:ttl", time.Minute); ok {
+		t.Errorf("Expire() missing = true, want false")
+	}
+}
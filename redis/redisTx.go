@@ -0,0 +1,177 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis事务
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 事务重试次数用尽，watch 的 key 仍然被其他客户端修改
+var ErrTxFailed = errors.New("redis transaction failed: watched keys changed")
+
+// 事务最大重试次数
+const maxTxRetries = 10
+
+// 事务，Do/Get 立即在 watch 的连接上执行，Send/Set/Del 排队到 MULTI/EXEC 中执行
+type Tx struct {
+	conn    redis.Conn
+	cmds    []txCommand
+	replies []*Reply
+	err     error
+}
+
+type txCommand struct {
+	commandName string
+	args        []interface{}
+}
+
+// 乐观锁事务：WATCH watchKeys 后执行 fn，再通过 MULTI/EXEC 提交 fn 中排队的命令
+// watch 的 key 被修改导致 EXEC 失败时重新执行 fn，最多重试 maxTxRetries 次
+// fn 可能被执行多次，不应包含其他副作用；事务中的命令使用 ctx 的截止时间和日志
+func (r *Redis) Tx(ctx context.Context, watchKeys []string, fn func(tx *Tx) error) error {
+	for _, key := range watchKeys {
+		if utils.IsEmpty(key) {
+			return fmt.Errorf("key 不能为空")
+		}
+	}
+	if fn == nil {
+		return fmt.Errorf("fn 不能为空")
+	}
+	view := r.bind(ctx)
+	for i := 0; i < maxTxRetries; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		committed, err := view.tx(ctx, watchKeys, fn)
+		if err != nil {
+			return err
+		}
+		if committed {
+			return nil
+		}
+	}
+	return ErrTxFailed
+}
+
+// 执行一次事务，返回是否提交成功
+func (r *Redis) tx(ctx context.Context, watchKeys []string, fn func(tx *Tx) error) (bool, error) {
+	conn, err := r.connContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if len(watchKeys) > 0 {
+		if _, err := conn.Do("watch", redis.Args{}.AddFlat(watchKeys)...); err != nil {
+			return false, err
+		}
+	}
+	tx := &Tx{conn: conn}
+	if err := fn(tx); err != nil {
+		conn.Do("unwatch")
+		return false, err
+	}
+	if tx.err != nil {
+		conn.Do("unwatch")
+		return false, tx.err
+	}
+	if len(tx.cmds) == 0 {
+		_, err := conn.Do("unwatch")
+		return err == nil, err
+	}
+
+	if err := conn.Send("multi"); err != nil {
+		return false, err
+	}
+	for _, cmd := range tx.cmds {
+		if err := conn.Send(cmd.commandName, cmd.args...); err != nil {
+			return false, err
+		}
+	}
+	values, err := redis.Values(conn.Do("exec"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for i, value := range values {
+		if i >= len(tx.replies) {
+			break
+		}
+		tx.replies[i].Value = value
+		if e, ok := value.(redis.Error); ok {
+			tx.replies[i].Err = e
+		}
+	}
+	return true, nil
+}
+
+// 立即执行命令，一般用于在事务提交前读取 watch 的 key
+func (tx *Tx) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return tx.conn.Do(commandName, args...)
+}
+
+// 立即获取 key 对应的 string 值，key 不存在时返回空字符串
+func (tx *Tx) Get(key string) (string, error) {
+	if utils.IsEmpty(key) {
+		return "", fmt.Errorf("key 不能为空")
+	}
+	result, err := tx.conn.Do("get", key)
+	if result == nil && err == nil {
+		return "", nil
+	}
+	return redis.String(result, err)
+}
+
+// 将命令排队到事务中，返回的 Reply 在事务提交后填充
+func (tx *Tx) Send(commandName string, args ...interface{}) *Reply {
+	reply := &Reply{}
+	tx.cmds = append(tx.cmds, txCommand{commandName: commandName, args: args})
+	tx.replies = append(tx.replies, reply)
+	return reply
+}
+
+// 在事务中设置 string 值，ex 大于 0 时同时设置超时时间（秒）
+func (tx *Tx) Set(key string, value string, ex int) *Reply {
+	if utils.IsEmpty(key) {
+		return tx.fail(fmt.Errorf("key 不能为空"))
+	}
+	if ex > 0 {
+		return tx.Send("set", key, value, "ex", ex)
+	}
+	return tx.Send("set", key, value)
+}
+
+// 在事务中删除 key
+func (tx *Tx) Del(key string) *Reply {
+	if utils.IsEmpty(key) {
+		return tx.fail(fmt.Errorf("key 不能为空"))
+	}
+	return tx.Send("del", key)
+}
+
+func (tx *Tx) fail(err error) *Reply {
+	if tx.err == nil {
+		tx.err = err
+	}
+	return &Reply{Err: err}
+}
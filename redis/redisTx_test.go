@@ -0,0 +1,138 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis事务
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// 并发对计数器做读-改-写，结果不能丢失更新
+func TestTxIncr(t *testing.T) {
+	redisTool.Set("tx:counter", "0")
+	const workers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				err := redisTool.Tx(context.Background(), []string{"tx:counter"}, func(tx *Tx) error {
+					value, err := tx.Get("tx:counter")
+					if err != nil {
+						return err
+					}
+					n, _ := strconv.Atoi(value)
+					tx.Set("tx:counter", strconv.Itoa(n+1), 0)
+					return nil
+				})
+				if err != ErrTxFailed {
+					if err != nil {
+						t.Errorf("Tx() error = %v", err)
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := redisTool.Get("tx:counter"); got != strconv.Itoa(workers) {
+		t.Errorf("Tx() counter = %v, want %v", got, workers)
+	}
+}
+
+func TestTx(t *testing.T) {
+	fnErr := errors.New("fn error")
+	tests := []struct {
+		name      string
+		watchKeys []string
+		fn        func(tx *Tx) error
+		wantErr   bool
+	}{
+		{
+			name:      "all",
+			watchKeys: []string{"tx:name"},
+			fn: func(tx *Tx) error {
+				tx.Set("tx:name", "xiaoliu", 60)
+				return nil
+			},
+		}, {
+			name:      "key nil",
+			watchKeys: []string{""},
+			fn:        func(tx *Tx) error { return nil },
+			wantErr:   true,
+		}, {
+			name:      "fn nil",
+			watchKeys: []string{"tx:name"},
+			wantErr:   true,
+		}, {
+			name:      "fn error",
+			watchKeys: []string{"tx:name"},
+			fn:        func(tx *Tx) error { return fnErr },
+			wantErr:   true,
+		}, {
+			name:      "command key nil",
+			watchKeys: []string{"tx:name"},
+			fn: func(tx *Tx) error {
+				tx.Del("")
+				return nil
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := redisTool.Tx(context.Background(), tt.watchKeys, tt.fn); (err != nil) != tt.wantErr {
+				t.Errorf("Tx() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTxReply(t *testing.T) {
+	var del *Reply
+	err := redisTool.Tx(context.Background(), nil, func(tx *Tx) error {
+		tx.Set("tx:reply", "xiaoliu", 0)
+		del = tx.Del("tx:reply")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Tx() error = %v", err)
+	}
+	if n, err := del.Int64(); err != nil || n != 1 {
+		t.Errorf("Del() = %v, %v, want 1, nil", n, err)
+	}
+}
+
+// watch 的 key 一直被修改时，重试次数用尽返回 ErrTxFailed
+func TestTxRetry(t *testing.T) {
+	attempts := 0
+	err := redisTool.Tx(context.Background(), []string{"tx:retry"}, func(tx *Tx) error {
+		attempts++
+		redisTool.Set("tx:retry", strconv.Itoa(attempts))
+		tx.Set("tx:retry", "done", 0)
+		return nil
+	})
+	if err != ErrTxFailed {
+		t.Errorf("Tx() error = %v, want %v", err, ErrTxFailed)
+	}
+	if attempts != maxTxRetries {
+		t.Errorf("Tx() attempts = %v, want %v", attempts, maxTxRetries)
+	}
+}
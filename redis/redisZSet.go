@@ -0,0 +1,121 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis sorted set 操作
+package redis
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-utils"
+)
+
+// 有序集合成员
+type Z struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// 向有序集合添加成员，已存在的成员更新分数，返回新增成员的数量
+func (r *Redis) ZAdd(key string, members ...Z) (int, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	if len(members) == 0 {
+		return 0, fmt.Errorf("members 不能为空")
+	}
+	args := redis.Args{}.Add(key)
+	for _, z := range members {
+		args = args.Add(z.Score, z.Member)
+	}
+	return redis.Int(r.do("zadd", args...))
+}
+
+// 从有序集合删除成员，返回实际删除的数量
+func (r *Redis) ZRem(key string, members ...string) (int, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	if len(members) == 0 {
+		return 0, fmt.Errorf("members 不能为空")
+	}
+	return redis.Int(r.do("zrem", redis.Args{}.Add(key).AddFlat(members)...))
+}
+
+// 增加成员的分数，返回增加后的分数
+func (r *Redis) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	return redis.Float64(r.do("zincrby", key, increment, member))
+}
+
+// 获取成员的分数，成员不存在时 exist 为 false
+func (r *Redis) ZScore(key string, member string) (score float64, exist bool, err error) {
+	if utils.IsEmpty(key) {
+		return 0, false, fmt.Errorf("key 不能为空")
+	}
+	result, err := r.do("zscore", key, member)
+	if result == nil && err == nil {
+		return 0, false, nil
+	}
+	score, err = redis.Float64(result, err)
+	if err != nil {
+		return 0, false, err
+	}
+	return score, true, nil
+}
+
+// 获取有序集合成员数量
+func (r *Redis) ZCard(key string) (int, error) {
+	if utils.IsEmpty(key) {
+		return 0, fmt.Errorf("key 不能为空")
+	}
+	return redis.Int(r.do("zcard", key))
+}
+
+// 按分数从小到大获取区间内的成员及分数
+// min、max 支持 "-inf"、"+inf" 以及 "(1" 表示开区间，count 为 0 时不分页
+func (r *Redis) ZRangeByScore(key string, min string, max string, offset int, count int) ([]Z, error) {
+	if utils.IsEmpty(key) {
+		return nil, fmt.Errorf("key 不能为空")
+	}
+	args := redis.Args{}.Add(key, min, max, "withscores")
+	if count != 0 {
+		args = args.Add("limit", offset, count)
+	}
+	return zSlice(r.do("zrangebyscore", args...))
+}
+
+// 将 withscores 的返回值转换为 []Z
+func zSlice(reply interface{}, err error) ([]Z, error) {
+	values, err := redis.Strings(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("redis zset 返回值数量错误: %d", len(values))
+	}
+	result := make([]Z, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		score, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, Z{Member: values[i], Score: score})
+	}
+	return result, nil
+}
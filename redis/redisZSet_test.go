@@ -0,0 +1,127 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redis sorted set 操作
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestZAdd(t *testing.T) {
+	redisTool.Del("zset")
+	tests := []struct {
+		name    string
+		key     string
+		members []Z
+		want    int
+		wantErr bool
+	}{
+		{
+			name:    "all",
+			key:     "zset",
+			members: []Z{{Member: "a", Score: 1}, {Member: "b", Score: 2}},
+			want:    2,
+		}, {
+			name:    "update score",
+			key:     "zset",
+			members: []Z{{Member: "a", Score: 3}},
+			want:    0,
+		}, {
+			name:    "key nil",
+			key:     "",
+			members: []Z{{Member: "a", Score: 1}},
+			wantErr: true,
+		}, {
+			name:    "members nil",
+			key:     "zset",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisTool.ZAdd(tt.key, tt.members...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ZAdd() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ZAdd() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZRangeByScore(t *testing.T) {
+	redisTool.Del("zset:range")
+	redisTool.ZAdd("zset:range", Z{Member: "a", Score: 1}, Z{Member: "b", Score: 2}, Z{Member: "c", Score: 3})
+	if score, err := redisTool.ZIncrBy("zset:range", 1.5, "a"); err != nil || score != 2.5 {
+		t.Errorf("ZIncrBy() = %v, %v, want 2.5, nil", score, err)
+	}
+	type args struct {
+		min    string
+		max    string
+		offset int
+		count  int
+	}
+	tests := []struct {
+		name string
+		args args
+		want []Z
+	}{
+		{
+			name: "all",
+			args: args{min: "-inf", max: "+inf"},
+			want: []Z{{Member: "b", Score: 2}, {Member: "a", Score: 2.5}, {Member: "c", Score: 3}},
+		}, {
+			name: "open interval",
+			args: args{min: "(2", max: "3"},
+			want: []Z{{Member: "a", Score: 2.5}, {Member: "c", Score: 3}},
+		}, {
+			name: "limit",
+			args: args{min: "-inf", max: "+inf", offset: 1, count: 1},
+			want: []Z{{Member: "a", Score: 2.5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisTool.ZRangeByScore("zset:range", tt.args.min, tt.args.max, tt.args.offset, tt.args.count)
+			if err != nil {
+				t.Errorf("ZRangeByScore() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ZRangeByScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZScore(t *testing.T) {
+	redisTool.Del("zset:score")
+	redisTool.ZAdd("zset:score", Z{Member: "a", Score: 1})
+	if score, exist, err := redisTool.ZScore("zset:score", "a"); err != nil || !exist || score != 1 {
+		t.Errorf("ZScore() = %v, %v, %v, want 1, true, nil", score, exist, err)
+	}
+	if _, exist, err := redisTool.ZScore("zset:score", "b"); err != nil || exist {
+		t.Errorf("ZScore() exist = %v, %v, want false, nil", exist, err)
+	}
+	if n, err := redisTool.ZRem("zset:score", "a"); err != nil || n != 1 {
+		t.Errorf("ZRem() = %v, %v, want 1, nil", n, err)
+	}
+	if n, err := redisTool.ZCard("zset:score"); err != nil || n != 0 {
+		t.Errorf("ZCard() = %v, %v, want 0, nil", n, err)
+	}
+}
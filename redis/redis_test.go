@@ -16,20 +16,33 @@
 package redis
 
 import (
-	"testing"
 	"os"
+	"reflect"
+	"testing"
+
+	"github.com/liuchonglin/go-tools/redis/redistest"
 )
 
 var config = &RedisConfig{
-	Address:     "localhost:6379",
 	MaxIdle:     16,
 	MaxActive:   100,
 	IdleTimeout: 300,
-	Password:    "liu5522112",
+	Password:    "redistest",
 }
 
 var redisTool *Redis
 
+// 内存 redis 服务，连接真实的 redis 时为 nil
+var testServer *redistest.Server
+
+// 需要真实 redis 的测试（lua 脚本、stream、HyperLogLog、ROLE、ACL 用户），使用内存服务时跳过
+func requireRedisServer(t *testing.T) {
+	t.Helper()
+	if testServer != nil {
+		t.Skip("需要真实的 redis，设置 REDIS_TEST_ADDR 后运行")
+	}
+}
+
 func TestNewRedis(t *testing.T) {
 	type args struct {
 		redisConfig *RedisConfig
@@ -38,37 +51,41 @@ func TestNewRedis(t *testing.T) {
 		name    string
 		args    args
 		wantErr bool
+		// 需要真实的 redis
+		realServer bool
 	}{
 		{
 			name: "all",
 			args: args{
 				redisConfig: &RedisConfig{
-					Address:     "localhost:6379",
+					Address:     config.Address,
 					MaxIdle:     16,
 					MaxActive:   100,
 					IdleTimeout: 300,
-					Password:    "liu5522112",
+					Password:    config.Password,
 				},
 			},
 			wantErr: false,
 		}, {
+			// 使用默认地址 localhost:6379
 			name: "redisConfig nil",
 			args: args{
 				redisConfig: nil,
 			},
-			wantErr: false,
+			wantErr:    false,
+			realServer: true,
 		}, {
-			name: "password nil",
+			name: "password err",
 			args: args{
 				redisConfig: &RedisConfig{
-					Address:     "localhost:6379",
+					Address:     config.Address,
 					MaxIdle:     16,
 					MaxActive:   100,
 					IdleTimeout: 300,
-					Password:    "",
+					Password:    config.Password + "_err",
 				},
 			},
-			wantErr: false,
+			wantErr: true,
 		}, {
 			name:    "link err",
 			wantErr: true,
@@ -78,14 +95,25 @@ func TestNewRedis(t *testing.T) {
 					MaxIdle:     16,
 					MaxActive:   100,
 					IdleTimeout: 300,
-					Password:    "liu5522112",
+					Password:    config.Password,
 				},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			if tt.realServer {
+				requireRedisServer(t)
+			}
+			var before RedisConfig
+			if tt.args.redisConfig != nil {
+				before = *tt.args.redisConfig
+			}
 			_, err := NewRedis(tt.args.redisConfig)
+			// 不修改调用方的配置
+			if tt.args.redisConfig != nil && !reflect.DeepEqual(before, *tt.args.redisConfig) {
+				t.Errorf("NewRedis() modified config: %+v, want %+v", *tt.args.redisConfig, before)
+			}
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewRedis() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -114,9 +142,9 @@ func TestSet(t *testing.T) {
 			args:    args{key: "", value: "xiaoliu"},
 			wantErr: true,
 		}, {
-			name:    "value nil",
-			args:    args{key: "name", value: ""},
-			wantErr: true,
+			name:    "value empty",
+			args:    args{key: "empty", value: ""},
+			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
@@ -155,6 +183,11 @@ func TestGet(t *testing.T) {
 			name:      "key not exist",
 			args:      args{key: "name12345"},
 			wantValue: "",
+			wantErr:   true,
+		}, {
+			name:      "value empty",
+			args:      args{key: "empty"},
+			wantValue: "",
 			wantErr:   false,
 		},
 	}
@@ -224,9 +257,9 @@ func TestSetExpire(t *testing.T) {
 			args:    args{key: "", value: "20", ex: 60},
 			wantErr: true,
 		}, {
-			name:    "value nil",
-			args:    args{key: "age", value: "", ex: 60},
-			wantErr: true,
+			name:    "value empty",
+			args:    args{key: "empty", value: "", ex: 60},
+			wantErr: false,
 		}, {
 			name:    "ex is zero",
 			args:    args{key: "age", value: "20", ex: 0},
@@ -243,12 +276,33 @@ func TestSetExpire(t *testing.T) {
 	}
 }
 
+// 默认使用内存 redis 服务，不依赖外部环境
+// 设置 REDIS_TEST_ADDR（及 REDIS_TEST_PASSWORD）时连接真实的 redis，运行内存服务不支持的测试
+// 默认使用内存服务，依赖 lua 脚本、stream、PF*、ROLE 的测试会被跳过（见 requireRedisServer）
+// CI 中需要再连接真实的 redis（6.2 及以上）完整运行一次，例如：
+//
+//	REDIS_TEST_ADDR=127.0.0.1:6379 REDIS_TEST_PASSWORD= go test ./redis/...
 func TestMain(m *testing.M) {
 	var err error
+	if addr := os.Getenv("REDIS_TEST_ADDR"); addr != "" {
+		config.Address = addr
+		config.Password = os.Getenv("REDIS_TEST_PASSWORD")
+	} else {
+		testServer, err = redistest.NewServer()
+		if err != nil {
+			panic(err)
+		}
+		testServer.RequirePass(config.Password)
+		config.Address = testServer.Addr()
+	}
 	redisTool, err = NewRedis(config)
 	if err != nil {
 		panic(err)
 	}
 
-	os.Exit(m.Run())
+	code := m.Run()
+	if testServer != nil {
+		testServer.Close()
+	}
+	os.Exit(code)
 }
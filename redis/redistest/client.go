@@ -0,0 +1,293 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 客户端连接
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// 命令
+type command struct {
+	handler func(c *client, args []string)
+	// 参数个数（包括命令名），负数表示至少 -arity 个
+	arity int
+	// 订阅状态下允许执行
+	pubSub bool
+	// 在 MULTI 中直接执行，不排队
+	noQueue bool
+}
+
+// 支持的命令，key 为小写的命令名
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"ping":   {handler: cmdPing, arity: -1, pubSub: true},
+		"echo":   {handler: cmdEcho, arity: 2},
+		"auth":   {handler: cmdAuth, arity: -2},
+		"select": {handler: cmdSelect, arity: 2},
+		"quit":   {arity: 1, pubSub: true, noQueue: true},
+	}
+	for name, cmd := range keyCommands {
+		commands[name] = cmd
+	}
+	for name, cmd := range stringCommands {
+		commands[name] = cmd
+	}
+	for name, cmd := range hashCommands {
+		commands[name] = cmd
+	}
+	for name, cmd := range listCommands {
+		commands[name] = cmd
+	}
+	for name, cmd := range setCommands {
+		commands[name] = cmd
+	}
+	for name, cmd := range zsetCommands {
+		commands[name] = cmd
+	}
+	for name, cmd := range geoCommands {
+		commands[name] = cmd
+	}
+	for name, cmd := range scanCommands {
+		commands[name] = cmd
+	}
+	for name, cmd := range pubSubCommands {
+		commands[name] = cmd
+	}
+	for name, cmd := range txCommands {
+		commands[name] = cmd
+	}
+}
+
+// 客户端连接，所有字段在 Server.mu 下访问
+type client struct {
+	server  *Server
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	dbIndex int
+	authed  bool
+
+	// 事务
+	multi   bool
+	queue   [][]string
+	dirty   bool
+	watches map[string]uint64
+
+	// 订阅
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func newClient(s *Server, conn net.Conn) *client {
+	return &client{
+		server:   s,
+		conn:     conn,
+		r:        bufio.NewReader(conn),
+		w:        bufio.NewWriter(conn),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+}
+
+func (c *client) readCommand() ([]string, error) {
+	return readCommand(c.r)
+}
+
+// 执行一条命令，返回是否需要关闭连接
+func (c *client) execute(args []string) bool {
+	name := strings.ToLower(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		c.dirty = c.multi
+		c.writeError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return false
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.dirty = c.multi
+		c.writeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return false
+	}
+	if c.server.password != "" && !c.authed && name != "auth" && name != "quit" {
+		c.writeError("NOAUTH Authentication required.")
+		return false
+	}
+	if c.subscribed() && !cmd.pubSub {
+		c.writeError("ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT allowed in this context")
+		return false
+	}
+	if name == "quit" {
+		c.writeOK()
+		return true
+	}
+	if c.multi && !cmd.noQueue {
+		c.queue = append(c.queue, args)
+		c.writeSimple("QUEUED")
+		return false
+	}
+	cmd.handler(c, args[1:])
+	return false
+}
+
+func (c *client) subscribed() bool {
+	return len(c.channels)+len(c.patterns) > 0
+}
+
+func cmdPing(c *client, args []string) {
+	if c.subscribed() {
+		// 订阅状态下返回 [pong, message]
+		message := ""
+		if len(args) > 0 {
+			message = args[0]
+		}
+		c.writeArray(2)
+		c.writeBulk("pong")
+		c.writeBulk(message)
+		return
+	}
+	if len(args) > 0 {
+		c.writeBulk(args[0])
+		return
+	}
+	c.writeSimple("PONG")
+}
+
+func cmdEcho(c *client, args []string) {
+	c.writeBulk(args[0])
+}
+
+// AUTH password 或 AUTH username password，不区分用户
+func cmdAuth(c *client, args []string) {
+	password := args[len(args)-1]
+	if len(args) > 2 {
+		c.writeError("ERR syntax error")
+		return
+	}
+	if c.server.password == "" {
+		c.writeError("ERR AUTH <password> called without any password configured for the default user.")
+		return
+	}
+	if password != c.server.password {
+		c.writeError("WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+	c.authed = true
+	c.writeOK()
+}
+
+func cmdSelect(c *client, args []string) {
+	index, err := strconv.Atoi(args[0])
+	if err != nil || index < 0 || index > 15 {
+		c.writeError("ERR DB index is out of range")
+		return
+	}
+	c.dbIndex = index
+	c.writeOK()
+}
+
+func (c *client) writeOK() {
+	writeSimple(c.w, "OK")
+}
+
+func (c *client) writeSimple(s string) {
+	writeSimple(c.w, s)
+}
+
+func (c *client) writeError(s string) {
+	writeError(c.w, s)
+}
+
+func (c *client) writeErr(err error) {
+	writeError(c.w, err.Error())
+}
+
+func (c *client) writeInt(n int64) {
+	writeInt(c.w, n)
+}
+
+func (c *client) writeBool(b bool) {
+	if b {
+		writeInt(c.w, 1)
+	} else {
+		writeInt(c.w, 0)
+	}
+}
+
+func (c *client) writeBulk(s string) {
+	writeBulk(c.w, s)
+}
+
+func (c *client) writeFloat(f float64) {
+	writeBulk(c.w, formatFloat(f))
+}
+
+func (c *client) writeNull() {
+	writeNull(c.w)
+}
+
+func (c *client) writeArray(n int) {
+	writeArray(c.w, n)
+}
+
+func (c *client) writeNullArray() {
+	writeNullArray(c.w)
+}
+
+func (c *client) writeStrings(values []string) {
+	writeArray(c.w, len(values))
+	for _, v := range values {
+		writeBulk(c.w, v)
+	}
+}
+
+func (c *client) writeSyntaxError() {
+	c.writeError("ERR syntax error")
+}
+
+func (c *client) writeNotInteger() {
+	c.writeError("ERR value is not an integer or out of range")
+}
+
+func (c *client) writeNotFloat() {
+	c.writeError("ERR value is not a valid float")
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func parseFloat(s string) (float64, bool) {
+	switch strings.ToLower(s) {
+	case "inf", "+inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil && !math.IsNaN(f)
+}
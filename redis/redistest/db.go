@@ -0,0 +1,198 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 内存 redis 数据
+package redistest
+
+import (
+	"errors"
+	"time"
+)
+
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// 一个数据库
+type db struct {
+	items map[string]*item
+}
+
+// 一个 key 的值，value 的类型为 string、hash、*list、set 或 zset
+type item struct {
+	value    interface{}
+	expireAt time.Time
+}
+
+type (
+	hash map[string]string
+	set  map[string]struct{}
+	zset map[string]float64
+	list struct {
+		values []string
+	}
+)
+
+func (it *item) expired(now time.Time) bool {
+	return !it.expireAt.IsZero() && !now.Before(it.expireAt)
+}
+
+// 获取匹配 pattern 的未过期 key
+func (d *db) keys(s *Server, index int, pattern string) []string {
+	var keys []string
+	for key := range d.items {
+		if s.lookup(index, key) != nil && match(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// 集合类型的元素数量，string 返回 1
+func (it *item) size() int {
+	switch v := it.value.(type) {
+	case hash:
+		return len(v)
+	case set:
+		return len(v)
+	case zset:
+		return len(v)
+	case *list:
+		return len(v.values)
+	}
+	return 1
+}
+
+func (c *client) lookup(key string) *item {
+	return c.server.lookup(c.dbIndex, key)
+}
+
+func (c *client) setItem(key string, it *item) {
+	c.server.setItem(c.dbIndex, key, it)
+}
+
+func (c *client) delItem(key string) bool {
+	return c.server.delItem(c.dbIndex, key)
+}
+
+func (c *client) touch(key string) {
+	c.server.touch(c.dbIndex, key)
+}
+
+// 元素被删除后，集合为空时删除 key
+func (c *client) removeIfEmpty(key string) {
+	if it := c.lookup(key); it != nil && it.size() == 0 {
+		c.delItem(key)
+	}
+}
+
+func (c *client) getString(key string) (string, bool, error) {
+	it := c.lookup(key)
+	if it == nil {
+		return "", false, nil
+	}
+	value, ok := it.value.(string)
+	if !ok {
+		return "", false, errWrongType
+	}
+	return value, true, nil
+}
+
+// 获取 hash，不存在且 create 为 true 时创建
+func (c *client) getHash(key string, create bool) (hash, error) {
+	it := c.lookup(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		h := hash{}
+		c.setItem(key, &item{value: h})
+		return h, nil
+	}
+	h, ok := it.value.(hash)
+	if !ok {
+		return nil, errWrongType
+	}
+	return h, nil
+}
+
+func (c *client) getList(key string, create bool) (*list, error) {
+	it := c.lookup(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		l := &list{}
+		c.setItem(key, &item{value: l})
+		return l, nil
+	}
+	l, ok := it.value.(*list)
+	if !ok {
+		return nil, errWrongType
+	}
+	return l, nil
+}
+
+func (c *client) getSet(key string, create bool) (set, error) {
+	it := c.lookup(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		st := set{}
+		c.setItem(key, &item{value: st})
+		return st, nil
+	}
+	st, ok := it.value.(set)
+	if !ok {
+		return nil, errWrongType
+	}
+	return st, nil
+}
+
+func (c *client) getZSet(key string, create bool) (zset, error) {
+	it := c.lookup(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		z := zset{}
+		c.setItem(key, &item{value: z})
+		return z, nil
+	}
+	z, ok := it.value.(zset)
+	if !ok {
+		return nil, errWrongType
+	}
+	return z, nil
+}
+
+// 将 redis 风格的 [start, stop] 下标（支持负数）转换为 [start, end) 切片下标
+func rangeIndex(start, stop int64, n int) (int, int, bool) {
+	size := int64(n)
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return 0, 0, false
+	}
+	return int(start), int(stop) + 1, true
+}
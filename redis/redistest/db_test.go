@@ -0,0 +1,45 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 内存 redis 数据
+package redistest
+
+import (
+	"testing"
+)
+
+func TestRangeIndex(t *testing.T) {
+	tests := []struct {
+		name        string
+		start, stop int64
+		n           int
+		from, to    int
+		ok          bool
+	}{
+		{name: "all", start: 0, stop: -1, n: 5, from: 0, to: 5, ok: true},
+		{name: "negative", start: -2, stop: -1, n: 5, from: 3, to: 5, ok: true},
+		{name: "stop overflow", start: 1, stop: 100, n: 5, from: 1, to: 5, ok: true},
+		{name: "start overflow", start: 10, stop: 100, n: 5},
+		{name: "start after stop", start: 3, stop: 1, n: 5},
+		{name: "empty", start: 0, stop: -1, n: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, ok := rangeIndex(tt.start, tt.stop, tt.n)
+			if ok != tt.ok || (ok && (from != tt.from || to != tt.to)) {
+				t.Errorf("rangeIndex() = %v, %v, %v, want %v, %v, %v", from, to, ok, tt.from, tt.to, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// geo 相关命令，坐标按 redis 的 52 位 geohash 保存在 sorted set 中
+package redistest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var geoCommands = map[string]*command{
+	"geoadd":    {handler: cmdGeoAdd, arity: -5},
+	"geopos":    {handler: cmdGeoPos, arity: -2},
+	"geodist":   {handler: cmdGeoDist, arity: -4},
+	"geosearch": {handler: cmdGeoSearch, arity: -7},
+}
+
+const (
+	geoStep         = 26
+	geoLatMin       = -85.05112878
+	geoLatMax       = 85.05112878
+	geoLonMin       = -180.0
+	geoLonMax       = 180.0
+	geoEarthRadiusM = 6372797.560856
+)
+
+// 单位换算为米
+var geoUnits = map[string]float64{"m": 1, "km": 1000, "ft": 0.3048, "mi": 1609.34}
+
+// 搜索结果
+type geoResult struct {
+	member   string
+	score    float64
+	lon, lat float64
+	dist     float64
+}
+
+// GEOADD key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+func cmdGeoAdd(c *client, args []string) {
+	key := args[0]
+	var nx, xx, ch bool
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			nx = true
+			continue
+		case "xx":
+			xx = true
+			continue
+		case "ch":
+			ch = true
+			continue
+		}
+		break
+	}
+	triples := args[i:]
+	if len(triples) == 0 || len(triples)%3 != 0 || (nx && xx) {
+		c.writeSyntaxError()
+		return
+	}
+	scores := make([]float64, 0, len(triples)/3)
+	for j := 0; j < len(triples); j += 3 {
+		lon, ok1 := parseFloat(triples[j])
+		lat, ok2 := parseFloat(triples[j+1])
+		if !ok1 || !ok2 {
+			c.writeNotFloat()
+			return
+		}
+		if lon < geoLonMin || lon > geoLonMax || lat < geoLatMin || lat > geoLatMax {
+			c.writeError(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", lon, lat))
+			return
+		}
+		scores = append(scores, float64(geoEncode(lon, lat)))
+	}
+	z, err := c.getZSet(key, !xx)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	if z == nil {
+		c.writeInt(0)
+		return
+	}
+	var added, changed int64
+	for j := 0; j < len(triples); j += 3 {
+		member, score := triples[j+2], scores[j/3]
+		old, exists := z[member]
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+		if !exists {
+			added++
+		} else if old != score {
+			changed++
+		}
+		z[member] = score
+	}
+	c.touch(key)
+	c.removeIfEmpty(key)
+	if ch {
+		c.writeInt(added + changed)
+		return
+	}
+	c.writeInt(added)
+}
+
+// GEOPOS key member [member ...]
+func cmdGeoPos(c *client, args []string) {
+	z, err := c.getZSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.writeArray(len(args) - 1)
+	for _, member := range args[1:] {
+		score, ok := z[member]
+		if !ok {
+			c.writeNullArray()
+			continue
+		}
+		lon, lat := geoDecode(uint64(score))
+		c.writeArray(2)
+		c.writeBulk(formatFloat(lon))
+		c.writeBulk(formatFloat(lat))
+	}
+}
+
+// GEODIST key member1 member2 [unit]
+func cmdGeoDist(c *client, args []string) {
+	if len(args) > 4 {
+		c.writeSyntaxError()
+		return
+	}
+	unit := 1.0
+	if len(args) == 4 {
+		var ok bool
+		if unit, ok = geoUnits[strings.ToLower(args[3])]; !ok {
+			c.writeError("ERR unsupported unit provided. please use M, KM, FT, MI")
+			return
+		}
+	}
+	z, err := c.getZSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	score1, ok1 := z[args[1]]
+	score2, ok2 := z[args[2]]
+	if !ok1 || !ok2 {
+		c.writeNull()
+		return
+	}
+	lon1, lat1 := geoDecode(uint64(score1))
+	lon2, lat2 := geoDecode(uint64(score2))
+	c.writeBulk(strconv.FormatFloat(geoDistance(lon1, lat1, lon2, lat2)/unit, 'f', 4, 64))
+}
+
+// GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude
+// BYRADIUS radius unit|BYBOX width height unit [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func cmdGeoSearch(c *client, args []string) {
+	var fromMember string
+	var lon, lat, radius, width, height, unit float64
+	var hasFrom, byRadius, byBox, withCoord, withDist, withHash bool
+	var sortOrder string
+	count := 0
+	opts := args[1:]
+	for i := 0; i < len(opts); i++ {
+		remain := len(opts) - i - 1
+		var ok bool
+		switch strings.ToLower(opts[i]) {
+		case "frommember":
+			if remain < 1 || hasFrom {
+				c.writeSyntaxError()
+				return
+			}
+			fromMember, hasFrom = opts[i+1], true
+			i++
+		case "fromlonlat":
+			if remain < 2 || hasFrom {
+				c.writeSyntaxError()
+				return
+			}
+			var ok1, ok2 bool
+			lon, ok1 = parseFloat(opts[i+1])
+			lat, ok2 = parseFloat(opts[i+2])
+			if !ok1 || !ok2 {
+				c.writeNotFloat()
+				return
+			}
+			hasFrom = true
+			i += 2
+		case "byradius":
+			if remain < 2 || byBox {
+				c.writeSyntaxError()
+				return
+			}
+			if radius, ok = parseFloat(opts[i+1]); !ok || radius < 0 {
+				c.writeError("ERR radius cannot be negative")
+				return
+			}
+			if unit, ok = geoUnits[strings.ToLower(opts[i+2])]; !ok {
+				c.writeError("ERR unsupported unit provided. please use M, KM, FT, MI")
+				return
+			}
+			byRadius = true
+			i += 2
+		case "bybox":
+			if remain < 3 || byRadius {
+				c.writeSyntaxError()
+				return
+			}
+			var ok1, ok2 bool
+			width, ok1 = parseFloat(opts[i+1])
+			height, ok2 = parseFloat(opts[i+2])
+			if !ok1 || !ok2 || width < 0 || height < 0 {
+				c.writeError("ERR height or width cannot be negative")
+				return
+			}
+			if unit, ok = geoUnits[strings.ToLower(opts[i+3])]; !ok {
+				c.writeError("ERR unsupported unit provided. please use M, KM, FT, MI")
+				return
+			}
+			byBox = true
+			i += 3
+		case "asc", "desc":
+			sortOrder = strings.ToLower(opts[i])
+		case "count":
+			if remain < 1 {
+				c.writeSyntaxError()
+				return
+			}
+			n, err := strconv.Atoi(opts[i+1])
+			if err != nil || n <= 0 {
+				c.writeError("ERR COUNT must be > 0")
+				return
+			}
+			count = n
+			i++
+		case "any":
+			if count == 0 {
+				c.writeError("ERR the ANY argument requires COUNT argument")
+				return
+			}
+		case "withcoord":
+			withCoord = true
+		case "withdist":
+			withDist = true
+		case "withhash":
+			withHash = true
+		default:
+			c.writeSyntaxError()
+			return
+		}
+	}
+	if !hasFrom || (!byRadius && !byBox) {
+		c.writeError("ERR exactly one of BYRADIUS and BYBOX arguments must be provided")
+		return
+	}
+	z, err := c.getZSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	if fromMember != "" {
+		score, ok := z[fromMember]
+		if !ok {
+			c.writeError("ERR could not decode requested zset member")
+			return
+		}
+		lon, lat = geoDecode(uint64(score))
+	}
+
+	var results []geoResult
+	for member, score := range z {
+		mlon, mlat := geoDecode(uint64(score))
+		dist := geoDistance(lon, lat, mlon, mlat)
+		if byRadius && dist > radius*unit {
+			continue
+		}
+		if byBox && !geoInBox(lon, lat, mlon, mlat, width*unit, height*unit) {
+			continue
+		}
+		results = append(results, geoResult{member: member, score: score, lon: mlon, lat: mlat, dist: dist / unit})
+	}
+	// 指定 COUNT 但未指定排序时按距离升序
+	if sortOrder == "" && count > 0 {
+		sortOrder = "asc"
+	}
+	switch sortOrder {
+	case "asc":
+		sort.Slice(results, func(i, j int) bool { return results[i].dist < results[j].dist })
+	case "desc":
+		sort.Slice(results, func(i, j int) bool { return results[i].dist > results[j].dist })
+	default:
+		sort.Slice(results, func(i, j int) bool { return results[i].score < results[j].score })
+	}
+	if count > 0 && len(results) > count {
+		results = results[:count]
+	}
+
+	c.writeArray(len(results))
+	for _, r := range results {
+		if !withCoord && !withDist && !withHash {
+			c.writeBulk(r.member)
+			continue
+		}
+		n := 1
+		for _, with := range []bool{withDist, withHash, withCoord} {
+			if with {
+				n++
+			}
+		}
+		c.writeArray(n)
+		c.writeBulk(r.member)
+		if withDist {
+			c.writeBulk(strconv.FormatFloat(r.dist, 'f', 4, 64))
+		}
+		if withHash {
+			c.writeInt(int64(r.score))
+		}
+		if withCoord {
+			c.writeArray(2)
+			c.writeBulk(formatFloat(r.lon))
+			c.writeBulk(formatFloat(r.lat))
+		}
+	}
+}
+
+// 将经纬度编码为 52 位 geohash，纬度在偶数位，经度在奇数位
+func geoEncode(lon, lat float64) uint64 {
+	latOffset := uint32((lat - geoLatMin) / (geoLatMax - geoLatMin) * (1 << geoStep))
+	lonOffset := uint32((lon - geoLonMin) / (geoLonMax - geoLonMin) * (1 << geoStep))
+	return interleave(latOffset, lonOffset)
+}
+
+// 解码 geohash，返回所在区域的中心点
+func geoDecode(hash uint64) (lon, lat float64) {
+	latOffset, lonOffset := deinterleave(hash)
+	latScale := geoLatMax - geoLatMin
+	lonScale := geoLonMax - geoLonMin
+	latMin := geoLatMin + float64(latOffset)/(1<<geoStep)*latScale
+	latMax := geoLatMin + float64(latOffset+1)/(1<<geoStep)*latScale
+	lonMin := geoLonMin + float64(lonOffset)/(1<<geoStep)*lonScale
+	lonMax := geoLonMin + float64(lonOffset+1)/(1<<geoStep)*lonScale
+	lon = math.Max(geoLonMin, math.Min(geoLonMax, (lonMin+lonMax)/2))
+	lat = math.Max(geoLatMin, math.Min(geoLatMax, (latMin+latMax)/2))
+	return lon, lat
+}
+
+func interleave(x, y uint32) uint64 {
+	var hash uint64
+	for i := uint(0); i < geoStep; i++ {
+		hash |= uint64(x>>i&1) << (2 * i)
+		hash |= uint64(y>>i&1) << (2*i + 1)
+	}
+	return hash
+}
+
+func deinterleave(hash uint64) (x, y uint32) {
+	for i := uint(0); i < geoStep; i++ {
+		x |= uint32(hash>>(2*i)&1) << i
+		y |= uint32(hash>>(2*i+1)&1) << i
+	}
+	return x, y
+}
+
+// 两点间的球面距离，单位：米
+func geoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lon1r := lat1*math.Pi/180, lon1*math.Pi/180
+	lat2r, lon2r := lat2*math.Pi/180, lon2*math.Pi/180
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2r - lon1r) / 2)
+	return 2 * geoEarthRadiusM * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// 判断点是否在以 (lon, lat) 为中心、宽高为 width、height 米的矩形内
+func geoInBox(lon, lat, mlon, mlat, width, height float64) bool {
+	if geoDistance(mlon, mlat, mlon, lat) > height/2 {
+		return false
+	}
+	return geoDistance(mlon, mlat, lon, mlat) <= width/2
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// geo 相关命令，坐标按 redis 的 52 位 geohash 保存在 sorted set 中
+package redistest
+
+import (
+	"testing"
+)
+
+func TestGeo(t *testing.T) {
+	server.FlushAll()
+	conn := dial(t)
+	defer conn.Close()
+	// 期望值来自 redis 官方文档的示例
+	runCommands(t, conn, []commandTest{
+		{name: "geoadd", args: []interface{}{"geoadd", "sicily", 13.361389, 38.115556, "Palermo", 15.087269, 37.502669, "Catania"}, want: int64(2)},
+		{name: "geoadd nx", args: []interface{}{"geoadd", "sicily", "nx", 13.361389, 38.115556, "Palermo"}, want: int64(0)},
+		{name: "geoadd invalid", args: []interface{}{"geoadd", "sicily", 200, 38, "x"}, want: errReply},
+		{name: "geodist", args: []interface{}{"geodist", "sicily", "Palermo", "Catania"}, want: "166274.1516"},
+		{name: "geodist km", args: []interface{}{"geodist", "sicily", "Palermo", "Catania", "km"}, want: "166.2742"},
+		{name: "geodist missing", args: []interface{}{"geodist", "sicily", "Palermo", "Rome"}, want: nil},
+		{name: "geopos", args: []interface{}{"geopos", "sicily", "Palermo", "Rome"},
+			want: []interface{}{[]interface{}{"13.361389338970184", "38.1155563954963"}, nil}},
+		{name: "geosearch radius", args: []interface{}{"geosearch", "sicily", "fromlonlat", 15, 37, "byradius", 200, "km", "asc", "withdist"},
+			want: []interface{}{[]interface{}{"Catania", "56.4413"}, []interface{}{"Palermo", "190.4424"}}},
+		{name: "geosearch desc count", args: []interface{}{"geosearch", "sicily", "fromlonlat", 15, 37, "byradius", 200, "km", "desc", "count", 1},
+			want: []interface{}{"Palermo"}},
+		{name: "geosearch count", args: []interface{}{"geosearch", "sicily", "frommember", "Palermo", "byradius", 200, "km", "count", 1},
+			want: []interface{}{"Palermo"}},
+		{name: "geosearch box", args: []interface{}{"geosearch", "sicily", "fromlonlat", 15, 37, "bybox", 400, 400, "km", "asc"},
+			want: []interface{}{"Catania", "Palermo"}},
+		{name: "geosearch small box", args: []interface{}{"geosearch", "sicily", "fromlonlat", 15, 37, "bybox", 200, 200, "km"},
+			want: []interface{}{"Catania"}},
+		{name: "geosearch missing member", args: []interface{}{"geosearch", "sicily", "frommember", "Rome", "byradius", 1, "km"}, want: errReply},
+		{name: "geosearch no shape", args: []interface{}{"geosearch", "sicily", "fromlonlat", 15, 37, "asc"}, want: errReply},
+	})
+}
@@ -0,0 +1,225 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// hash 相关命令
+package redistest
+
+import (
+	"sort"
+	"strconv"
+)
+
+var hashCommands = map[string]*command{
+	"hget":    {handler: cmdHGet, arity: 3},
+	"hset":    {handler: cmdHSet, arity: -4},
+	"hmset":   {handler: cmdHMSet, arity: -4},
+	"hsetnx":  {handler: cmdHSetNX, arity: 4},
+	"hmget":   {handler: cmdHMGet, arity: -3},
+	"hgetall": {handler: cmdHGetAll, arity: 2},
+	"hdel":    {handler: cmdHDel, arity: -3},
+	"hexists": {handler: cmdHExists, arity: 3},
+	"hlen":    {handler: cmdHLen, arity: 2},
+	"hkeys":   {handler: cmdHKeys, arity: 2},
+	"hvals":   {handler: cmdHVals, arity: 2},
+	"hincrby": {handler: cmdHIncrBy, arity: 4},
+}
+
+func cmdHGet(c *client, args []string) {
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	value, ok := h[args[1]]
+	if !ok {
+		c.writeNull()
+		return
+	}
+	c.writeBulk(value)
+}
+
+func cmdHSet(c *client, args []string) {
+	if n, ok := hset(c, args); ok {
+		c.writeInt(n)
+	}
+}
+
+func cmdHMSet(c *client, args []string) {
+	if _, ok := hset(c, args); ok {
+		c.writeOK()
+	}
+}
+
+// 设置多个字段，返回新增的字段数量
+func hset(c *client, args []string) (int64, bool) {
+	if len(args)%2 != 1 {
+		c.writeError("ERR wrong number of arguments for 'hset' command")
+		return 0, false
+	}
+	h, err := c.getHash(args[0], true)
+	if err != nil {
+		c.writeErr(err)
+		return 0, false
+	}
+	var n int64
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := h[args[i]]; !ok {
+			n++
+		}
+		h[args[i]] = args[i+1]
+	}
+	c.touch(args[0])
+	return n, true
+}
+
+func cmdHSetNX(c *client, args []string) {
+	h, err := c.getHash(args[0], true)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	if _, ok := h[args[1]]; ok {
+		c.writeInt(0)
+		return
+	}
+	h[args[1]] = args[2]
+	c.touch(args[0])
+	c.writeInt(1)
+}
+
+func cmdHMGet(c *client, args []string) {
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.writeArray(len(args) - 1)
+	for _, field := range args[1:] {
+		if value, ok := h[field]; ok {
+			c.writeBulk(value)
+		} else {
+			c.writeNull()
+		}
+	}
+}
+
+func cmdHGetAll(c *client, args []string) {
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	fields := sortedFields(h)
+	c.writeArray(len(fields) * 2)
+	for _, field := range fields {
+		c.writeBulk(field)
+		c.writeBulk(h[field])
+	}
+}
+
+func cmdHDel(c *client, args []string) {
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	var n int64
+	for _, field := range args[1:] {
+		if _, ok := h[field]; ok {
+			delete(h, field)
+			n++
+		}
+	}
+	if n > 0 {
+		c.touch(args[0])
+		c.removeIfEmpty(args[0])
+	}
+	c.writeInt(n)
+}
+
+func cmdHExists(c *client, args []string) {
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	_, ok := h[args[1]]
+	c.writeBool(ok)
+}
+
+func cmdHLen(c *client, args []string) {
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.writeInt(int64(len(h)))
+}
+
+func cmdHKeys(c *client, args []string) {
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.writeStrings(sortedFields(h))
+}
+
+func cmdHVals(c *client, args []string) {
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	fields := sortedFields(h)
+	values := make([]string, 0, len(fields))
+	for _, field := range fields {
+		values = append(values, h[field])
+	}
+	c.writeStrings(values)
+}
+
+func cmdHIncrBy(c *client, args []string) {
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		c.writeNotInteger()
+		return
+	}
+	h, err := c.getHash(args[0], true)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	var n int64
+	if value, ok := h[args[1]]; ok {
+		if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+			c.writeError("ERR hash value is not an integer")
+			return
+		}
+	}
+	n += delta
+	h[args[1]] = strconv.FormatInt(n, 10)
+	c.touch(args[0])
+	c.writeInt(n)
+}
+
+// 按字典序返回字段，保证结果稳定
+func sortedFields(h hash) []string {
+	fields := make([]string, 0, len(h))
+	for field := range h {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
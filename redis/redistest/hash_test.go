@@ -0,0 +1,45 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// hash 相关命令
+package redistest
+
+import (
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	server.FlushAll()
+	conn := dial(t)
+	defer conn.Close()
+	runCommands(t, conn, []commandTest{
+		{name: "hset", args: []interface{}{"hset", "hash", "b", "2", "a", "1"}, want: int64(2)},
+		{name: "hset update", args: []interface{}{"hset", "hash", "a", "3"}, want: int64(0)},
+		{name: "hmset", args: []interface{}{"hmset", "hash", "c", "4"}, want: "OK"},
+		{name: "hsetnx", args: []interface{}{"hsetnx", "hash", "c", "5"}, want: int64(0)},
+		{name: "hget", args: []interface{}{"hget", "hash", "a"}, want: "3"},
+		{name: "hget nil", args: []interface{}{"hget", "hash", "x"}, want: nil},
+		{name: "hmget", args: []interface{}{"hmget", "hash", "a", "x"}, want: []interface{}{"3", nil}},
+		{name: "hgetall", args: []interface{}{"hgetall", "hash"}, want: []interface{}{"a", "3", "b", "2", "c", "4"}},
+		{name: "hkeys", args: []interface{}{"hkeys", "hash"}, want: []interface{}{"a", "b", "c"}},
+		{name: "hvals", args: []interface{}{"hvals", "hash"}, want: []interface{}{"3", "2", "4"}},
+		{name: "hlen", args: []interface{}{"hlen", "hash"}, want: int64(3)},
+		{name: "hexists", args: []interface{}{"hexists", "hash", "a"}, want: int64(1)},
+		{name: "hincrby", args: []interface{}{"hincrby", "hash", "a", 2}, want: int64(5)},
+		{name: "hdel", args: []interface{}{"hdel", "hash", "a", "b", "c", "x"}, want: int64(3)},
+		{name: "empty removed", args: []interface{}{"exists", "hash"}, want: int64(0)},
+		{name: "hset odd", args: []interface{}{"hset", "hash", "a", "1", "b"}, want: errReply},
+		{name: "hgetall nil", args: []interface{}{"hgetall", "hash"}, want: []interface{}{}},
+	})
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// key 相关命令
+package redistest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var keyCommands = map[string]*command{
+	"del":      {handler: cmdDel, arity: -2},
+	"unlink":   {handler: cmdDel, arity: -2},
+	"exists":   {handler: cmdExists, arity: -2},
+	"expire":   {handler: cmdExpire, arity: 3},
+	"pexpire":  {handler: cmdPExpire, arity: 3},
+	"ttl":      {handler: cmdTTL, arity: 2},
+	"pttl":     {handler: cmdPTTL, arity: 2},
+	"persist":  {handler: cmdPersist, arity: 2},
+	"type":     {handler: cmdType, arity: 2},
+	"keys":     {handler: cmdKeys, arity: 2},
+	"dbsize":   {handler: cmdDBSize, arity: 1},
+	"flushdb":  {handler: cmdFlushDB, arity: -1},
+	"flushall": {handler: cmdFlushAll, arity: -1},
+}
+
+func cmdDel(c *client, args []string) {
+	var n int64
+	for _, key := range args {
+		if c.delItem(key) {
+			n++
+		}
+	}
+	c.writeInt(n)
+}
+
+func cmdExists(c *client, args []string) {
+	var n int64
+	for _, key := range args {
+		if c.lookup(key) != nil {
+			n++
+		}
+	}
+	c.writeInt(n)
+}
+
+func cmdExpire(c *client, args []string) {
+	expire(c, args, time.Second)
+}
+
+func cmdPExpire(c *client, args []string) {
+	expire(c, args, time.Millisecond)
+}
+
+func expire(c *client, args []string, unit time.Duration) {
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		c.writeNotInteger()
+		return
+	}
+	it := c.lookup(args[0])
+	if it == nil {
+		c.writeInt(0)
+		return
+	}
+	// 过期时间不大于 0 时直接删除
+	if n <= 0 {
+		c.delItem(args[0])
+		c.writeInt(1)
+		return
+	}
+	it.expireAt = c.server.now().Add(time.Duration(n) * unit)
+	c.touch(args[0])
+	c.writeInt(1)
+}
+
+func cmdTTL(c *client, args []string) {
+	ttl(c, args[0], time.Second)
+}
+
+func cmdPTTL(c *client, args []string) {
+	ttl(c, args[0], time.Millisecond)
+}
+
+// key 不存在返回 -2，未设置过期时间返回 -1
+func ttl(c *client, key string, unit time.Duration) {
+	it := c.lookup(key)
+	if it == nil {
+		c.writeInt(-2)
+		return
+	}
+	if it.expireAt.IsZero() {
+		c.writeInt(-1)
+		return
+	}
+	// 与 redis 一致，四舍五入到单位
+	d := it.expireAt.Sub(c.server.now())
+	c.writeInt(int64((d + unit/2) / unit))
+}
+
+func cmdPersist(c *client, args []string) {
+	it := c.lookup(args[0])
+	if it == nil || it.expireAt.IsZero() {
+		c.writeInt(0)
+		return
+	}
+	it.expireAt = time.Time{}
+	c.touch(args[0])
+	c.writeInt(1)
+}
+
+func cmdType(c *client, args []string) {
+	it := c.lookup(args[0])
+	if it == nil {
+		c.writeSimple("none")
+		return
+	}
+	switch it.value.(type) {
+	case string:
+		c.writeSimple("string")
+	case hash:
+		c.writeSimple("hash")
+	case *list:
+		c.writeSimple("list")
+	case set:
+		c.writeSimple("set")
+	case zset:
+		c.writeSimple("zset")
+	}
+}
+
+func cmdKeys(c *client, args []string) {
+	keys := c.server.db(c.dbIndex).keys(c.server, c.dbIndex, args[0])
+	sort.Strings(keys)
+	c.writeStrings(keys)
+}
+
+func cmdDBSize(c *client, args []string) {
+	keys := c.server.db(c.dbIndex).keys(c.server, c.dbIndex, "*")
+	c.writeInt(int64(len(keys)))
+}
+
+// 支持 ASYNC/SYNC 参数，均同步执行
+func cmdFlushDB(c *client, args []string) {
+	if !validFlushArgs(args) {
+		c.writeSyntaxError()
+		return
+	}
+	c.server.flushDB(c.dbIndex)
+	c.writeOK()
+}
+
+func cmdFlushAll(c *client, args []string) {
+	if !validFlushArgs(args) {
+		c.writeSyntaxError()
+		return
+	}
+	c.server.flushAll()
+	c.writeOK()
+}
+
+func validFlushArgs(args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	mode := strings.ToLower(args[0])
+	return len(args) == 1 && (mode == "async" || mode == "sync")
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// key 相关命令
+package redistest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeys(t *testing.T) {
+	server.FlushAll()
+	conn := dial(t)
+	defer conn.Close()
+	conn.Do("mset", "keys:a", "1", "keys:b", "2", "other", "3")
+	runCommands(t, conn, []commandTest{
+		{name: "exists", args: []interface{}{"exists", "keys:a", "keys:x", "keys:b"}, want: int64(2)},
+		{name: "keys", args: []interface{}{"keys", "keys:*"}, want: []interface{}{"keys:a", "keys:b"}},
+		{name: "dbsize", args: []interface{}{"dbsize"}, want: int64(3)},
+		{name: "type", args: []interface{}{"type", "keys:a"}, want: "string"},
+		{name: "type none", args: []interface{}{"type", "keys:x"}, want: "none"},
+		{name: "ttl missing", args: []interface{}{"ttl", "keys:x"}, want: int64(-2)},
+		{name: "ttl no expire", args: []interface{}{"ttl", "keys:a"}, want: int64(-1)},
+		{name: "expire", args: []interface{}{"expire", "keys:a", 10}, want: int64(1)},
+		{name: "expire missing", args: []interface{}{"expire", "keys:x", 10}, want: int64(0)},
+		{name: "pttl", args: []interface{}{"pttl", "keys:a"}, want: int64(10000)},
+		{name: "persist", args: []interface{}{"persist", "keys:a"}, want: int64(1)},
+		{name: "persist again", args: []interface{}{"persist", "keys:a"}, want: int64(0)},
+		{name: "pexpire", args: []interface{}{"pexpire", "keys:b", 1600}, want: int64(1)},
+		{name: "ttl round", args: []interface{}{"ttl", "keys:b"}, want: int64(2)},
+		{name: "expire negative", args: []interface{}{"expire", "other", -1}, want: int64(1)},
+		{name: "deleted", args: []interface{}{"exists", "other"}, want: int64(0)},
+		{name: "del", args: []interface{}{"del", "keys:a", "keys:x"}, want: int64(1)},
+		{name: "unlink", args: []interface{}{"unlink", "keys:b"}, want: int64(1)},
+		{name: "flushdb", args: []interface{}{"flushdb", "async"}, want: "OK"},
+		{name: "flushall syntax", args: []interface{}{"flushall", "now"}, want: errReply},
+	})
+}
+
+// 过期的 key 对所有命令不可见
+func TestKeysExpire(t *testing.T) {
+	server.FlushAll()
+	conn := dial(t)
+	defer conn.Close()
+	conn.Do("set", "expire:a", "1", "px", 100)
+	server.FastForward(100 * time.Millisecond)
+	runCommands(t, conn, []commandTest{
+		{name: "get", args: []interface{}{"get", "expire:a"}, want: nil},
+		{name: "exists", args: []interface{}{"exists", "expire:a"}, want: int64(0)},
+		{name: "dbsize", args: []interface{}{"dbsize"}, want: int64(0)},
+	})
+}
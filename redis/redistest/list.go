@@ -0,0 +1,190 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// list 相关命令
+package redistest
+
+import (
+	"strconv"
+)
+
+var listCommands = map[string]*command{
+	"lpush":  {handler: cmdLPush, arity: -3},
+	"rpush":  {handler: cmdRPush, arity: -3},
+	"lpop":   {handler: cmdLPop, arity: 2},
+	"rpop":   {handler: cmdRPop, arity: 2},
+	"llen":   {handler: cmdLLen, arity: 2},
+	"lrange": {handler: cmdLRange, arity: 4},
+	"lindex": {handler: cmdLIndex, arity: 3},
+	"lrem":   {handler: cmdLRem, arity: 4},
+}
+
+func cmdLPush(c *client, args []string) {
+	l, err := c.getList(args[0], true)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	for _, value := range args[1:] {
+		l.values = append([]string{value}, l.values...)
+	}
+	c.touch(args[0])
+	c.writeInt(int64(len(l.values)))
+}
+
+func cmdRPush(c *client, args []string) {
+	l, err := c.getList(args[0], true)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	l.values = append(l.values, args[1:]...)
+	c.touch(args[0])
+	c.writeInt(int64(len(l.values)))
+}
+
+func cmdLPop(c *client, args []string) {
+	pop(c, args[0], true)
+}
+
+func cmdRPop(c *client, args []string) {
+	pop(c, args[0], false)
+}
+
+func pop(c *client, key string, left bool) {
+	l, err := c.getList(key, false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	if l == nil || len(l.values) == 0 {
+		c.writeNull()
+		return
+	}
+	var value string
+	if left {
+		value, l.values = l.values[0], l.values[1:]
+	} else {
+		value, l.values = l.values[len(l.values)-1], l.values[:len(l.values)-1]
+	}
+	c.touch(key)
+	c.removeIfEmpty(key)
+	c.writeBulk(value)
+}
+
+func cmdLLen(c *client, args []string) {
+	l, err := c.getList(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	if l == nil {
+		c.writeInt(0)
+		return
+	}
+	c.writeInt(int64(len(l.values)))
+}
+
+func cmdLRange(c *client, args []string) {
+	start, err1 := strconv.ParseInt(args[1], 10, 64)
+	stop, err2 := strconv.ParseInt(args[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		c.writeNotInteger()
+		return
+	}
+	l, err := c.getList(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	if l == nil {
+		c.writeStrings(nil)
+		return
+	}
+	from, to, ok := rangeIndex(start, stop, len(l.values))
+	if !ok {
+		c.writeStrings(nil)
+		return
+	}
+	c.writeStrings(l.values[from:to])
+}
+
+func cmdLIndex(c *client, args []string) {
+	index, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		c.writeNotInteger()
+		return
+	}
+	l, err := c.getList(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	if l == nil {
+		c.writeNull()
+		return
+	}
+	if index < 0 {
+		index += int64(len(l.values))
+	}
+	if index < 0 || index >= int64(len(l.values)) {
+		c.writeNull()
+		return
+	}
+	c.writeBulk(l.values[index])
+}
+
+// count 大于 0 从头删除，小于 0 从尾删除，等于 0 删除全部
+func cmdLRem(c *client, args []string) {
+	count, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		c.writeNotInteger()
+		return
+	}
+	l, err := c.getList(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	if l == nil {
+		c.writeInt(0)
+		return
+	}
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	removed := make(map[int]bool)
+	for i := range l.values {
+		idx := i
+		if count < 0 {
+			idx = len(l.values) - 1 - i
+		}
+		if l.values[idx] == args[2] && (limit == 0 || int64(len(removed)) < limit) {
+			removed[idx] = true
+		}
+	}
+	if len(removed) > 0 {
+		values := make([]string, 0, len(l.values)-len(removed))
+		for i, v := range l.values {
+			if !removed[i] {
+				values = append(values, v)
+			}
+		}
+		l.values = values
+		c.touch(args[0])
+		c.removeIfEmpty(args[0])
+	}
+	c.writeInt(int64(len(removed)))
+}
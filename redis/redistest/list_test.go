@@ -0,0 +1,44 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// list 相关命令
+package redistest
+
+import (
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	server.FlushAll()
+	conn := dial(t)
+	defer conn.Close()
+	runCommands(t, conn, []commandTest{
+		{name: "rpush", args: []interface{}{"rpush", "list", "b", "c"}, want: int64(2)},
+		{name: "lpush", args: []interface{}{"lpush", "list", "a", "x"}, want: int64(4)},
+		{name: "lrange", args: []interface{}{"lrange", "list", 0, -1}, want: []interface{}{"x", "a", "b", "c"}},
+		{name: "lrange part", args: []interface{}{"lrange", "list", 1, 2}, want: []interface{}{"a", "b"}},
+		{name: "lrange out", args: []interface{}{"lrange", "list", 10, 20}, want: []interface{}{}},
+		{name: "lindex", args: []interface{}{"lindex", "list", -1}, want: "c"},
+		{name: "llen", args: []interface{}{"llen", "list"}, want: int64(4)},
+		{name: "lpop", args: []interface{}{"lpop", "list"}, want: "x"},
+		{name: "rpop", args: []interface{}{"rpop", "list"}, want: "c"},
+		{name: "rpush dup", args: []interface{}{"rpush", "list", "a", "a"}, want: int64(4)},
+		{name: "lrem tail", args: []interface{}{"lrem", "list", -1, "a"}, want: int64(1)},
+		{name: "after lrem", args: []interface{}{"lrange", "list", 0, -1}, want: []interface{}{"a", "b", "a"}},
+		{name: "lrem all", args: []interface{}{"lrem", "list", 0, "a"}, want: int64(2)},
+		{name: "lpop last", args: []interface{}{"lpop", "list"}, want: "b"},
+		{name: "empty removed", args: []interface{}{"exists", "list"}, want: int64(0)},
+		{name: "lpop nil", args: []interface{}{"lpop", "list"}, want: nil},
+	})
+}
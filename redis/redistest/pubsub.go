@@ -0,0 +1,114 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 发布订阅相关命令
+package redistest
+
+import (
+	"sort"
+)
+
+var pubSubCommands = map[string]*command{
+	"subscribe":    {handler: cmdSubscribe, arity: -2, pubSub: true},
+	"psubscribe":   {handler: cmdPSubscribe, arity: -2, pubSub: true},
+	"unsubscribe":  {handler: cmdUnsubscribe, arity: -1, pubSub: true},
+	"punsubscribe": {handler: cmdPUnsubscribe, arity: -1, pubSub: true},
+	"publish":      {handler: cmdPublish, arity: 3},
+}
+
+func cmdSubscribe(c *client, args []string) {
+	for _, channel := range args {
+		c.channels[channel] = struct{}{}
+		c.writeSubscription("subscribe", channel)
+	}
+}
+
+func cmdPSubscribe(c *client, args []string) {
+	for _, pattern := range args {
+		c.patterns[pattern] = struct{}{}
+		c.writeSubscription("psubscribe", pattern)
+	}
+}
+
+// 不带参数时取消所有订阅
+func cmdUnsubscribe(c *client, args []string) {
+	unsubscribe(c, "unsubscribe", c.channels, args)
+}
+
+func cmdPUnsubscribe(c *client, args []string) {
+	unsubscribe(c, "punsubscribe", c.patterns, args)
+}
+
+func unsubscribe(c *client, kind string, subscriptions map[string]struct{}, names []string) {
+	if len(names) == 0 {
+		for name := range subscriptions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		c.writeArray(3)
+		c.writeBulk(kind)
+		c.writeNull()
+		c.writeInt(int64(c.subscriptions()))
+		return
+	}
+	for _, name := range names {
+		delete(subscriptions, name)
+		c.writeSubscription(kind, name)
+	}
+}
+
+// 发布消息，返回收到消息的订阅数量
+func cmdPublish(c *client, args []string) {
+	channel, message := args[0], args[1]
+	var n int64
+	for other := range c.server.clients {
+		received := false
+		if _, ok := other.channels[channel]; ok {
+			writeArray(other.w, 3)
+			writeBulk(other.w, "message")
+			writeBulk(other.w, channel)
+			writeBulk(other.w, message)
+			received = true
+			n++
+		}
+		for pattern := range other.patterns {
+			if match(pattern, channel) {
+				writeArray(other.w, 4)
+				writeBulk(other.w, "pmessage")
+				writeBulk(other.w, pattern)
+				writeBulk(other.w, channel)
+				writeBulk(other.w, message)
+				received = true
+				n++
+			}
+		}
+		if received && other != c {
+			other.w.Flush()
+		}
+	}
+	c.writeInt(n)
+}
+
+func (c *client) subscriptions() int {
+	return len(c.channels) + len(c.patterns)
+}
+
+func (c *client) writeSubscription(kind string, name string) {
+	c.writeArray(3)
+	c.writeBulk(kind)
+	c.writeBulk(name)
+	c.writeInt(int64(c.subscriptions()))
+}
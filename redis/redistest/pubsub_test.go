@@ -0,0 +1,93 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 发布订阅相关命令
+package redistest
+
+import (
+	"testing"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+func TestPubSub(t *testing.T) {
+	sub := dial(t)
+	defer sub.Close()
+	psc := redigo.PubSubConn{Conn: sub}
+	psc.Subscribe("news")
+	psc.PSubscribe("news.*")
+	for i := 0; i < 2; i++ {
+		if _, ok := psc.Receive().(redigo.Subscription); !ok {
+			t.Fatalf("Receive() want subscription")
+		}
+	}
+
+	conn := dial(t)
+	defer conn.Close()
+	tests := []struct {
+		name    string
+		channel string
+		want    int
+	}{
+		{name: "channel", channel: "news", want: 1},
+		{name: "pattern", channel: "news.sport", want: 1},
+		{name: "none", channel: "other", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if n, err := redigo.Int(conn.Do("publish", tt.channel, "hello")); err != nil || n != tt.want {
+				t.Fatalf("publish = %v, %v, want %v", n, err, tt.want)
+			}
+			if tt.want == 0 {
+				return
+			}
+			msg, ok := psc.ReceiveWithTimeout(time.Second).(redigo.Message)
+			if !ok || msg.Channel != tt.channel || string(msg.Data) != "hello" {
+				t.Errorf("Receive() = %+v, want message on %v", msg, tt.channel)
+			}
+		})
+	}
+
+	// 订阅状态下只能执行订阅相关命令和 PING
+	if err := psc.Ping("hi"); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if pong, ok := psc.Receive().(redigo.Pong); !ok || pong.Data != "hi" {
+		t.Errorf("Receive() = %v, want pong", pong)
+	}
+	psc.Unsubscribe()
+	psc.PUnsubscribe()
+	for i := 0; i < 2; i++ {
+		if s, ok := psc.Receive().(redigo.Subscription); !ok || (i == 1 && s.Count != 0) {
+			t.Errorf("Receive() = %+v, want unsubscribe", s)
+		}
+	}
+	if reply, err := redigo.String(sub.Do("ping")); err != nil || reply != "PONG" {
+		t.Errorf("ping after unsubscribe = %v, %v", reply, err)
+	}
+}
+
+func TestPubSubNotAllowed(t *testing.T) {
+	conn := dial(t)
+	defer conn.Close()
+	conn.Send("subscribe", "channel")
+	conn.Flush()
+	conn.Receive()
+	conn.Send("get", "key")
+	conn.Flush()
+	if _, err := conn.Receive(); err == nil {
+		t.Errorf("get in subscribe mode error = nil, want error")
+	}
+}
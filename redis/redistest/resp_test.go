@@ -0,0 +1,61 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// RESP 协议读写
+package redistest
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "all",
+			input: "*2\r\n$3\r\nget\r\n$1\r\nk\r\n",
+			want:  []string{"get", "k"},
+		}, {
+			name:  "empty arg",
+			input: "*2\r\n$4\r\necho\r\n$0\r\n\r\n",
+			want:  []string{"echo", ""},
+		}, {
+			name:    "inline",
+			input:   "get k\r\n",
+			wantErr: true,
+		}, {
+			name:    "short",
+			input:   "*2\r\n$3\r\nget\r\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCommand(bufio.NewReader(strings.NewReader(tt.input)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
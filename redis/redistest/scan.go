@@ -0,0 +1,159 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 游标遍历相关命令
+package redistest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var scanCommands = map[string]*command{
+	"scan":  {handler: cmdScan, arity: -2},
+	"hscan": {handler: cmdHScan, arity: -3},
+	"sscan": {handler: cmdSScan, arity: -3},
+	"zscan": {handler: cmdZScan, arity: -3},
+}
+
+type scanOptions struct {
+	// 上一次返回的最后一个元素，为空表示从头开始
+	after string
+	match string
+	count int
+}
+
+// 游标对应上一次返回的最后一个元素，下一次从其后开始，
+// 遍历期间元素被增删时不会遗漏一直存在的元素
+func parseScanOptions(c *client, args []string) (*scanOptions, bool) {
+	cursor, err := strconv.Atoi(args[0])
+	after, ok := c.server.cursors[cursor]
+	if err != nil || (cursor != 0 && !ok) {
+		c.writeError("ERR invalid cursor")
+		return nil, false
+	}
+	opts := &scanOptions{after: after, match: "*", count: 10}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			c.writeSyntaxError()
+			return nil, false
+		}
+		switch strings.ToLower(args[i]) {
+		case "match":
+			opts.match = args[i+1]
+		case "count":
+			if opts.count, err = strconv.Atoi(args[i+1]); err != nil || opts.count <= 0 {
+				c.writeSyntaxError()
+				return nil, false
+			}
+		default:
+			c.writeSyntaxError()
+			return nil, false
+		}
+	}
+	return opts, true
+}
+
+// 返回 [cursor, [element, ...]]，elements 按名称排序，每个元素占 width 个位置
+func writeScan(c *client, opts *scanOptions, elements []string, width int) {
+	n := len(elements) / width
+	start := 0
+	if opts.after != "" {
+		start = sort.Search(n, func(i int) bool { return elements[i*width] > opts.after })
+	}
+	end := start + opts.count
+	next := 0
+	if end < n {
+		next = c.server.newCursor(elements[(end-1)*width])
+	} else {
+		end = n
+	}
+	var result []string
+	for i := start; i < end; i++ {
+		if match(opts.match, elements[i*width]) {
+			result = append(result, elements[i*width:(i+1)*width]...)
+		}
+	}
+	c.writeArray(2)
+	c.writeBulk(strconv.Itoa(next))
+	c.writeStrings(result)
+}
+
+func cmdScan(c *client, args []string) {
+	opts, ok := parseScanOptions(c, args)
+	if !ok {
+		return
+	}
+	keys := c.server.db(c.dbIndex).keys(c.server, c.dbIndex, "*")
+	sort.Strings(keys)
+	writeScan(c, opts, keys, 1)
+}
+
+func cmdHScan(c *client, args []string) {
+	opts, ok := parseScanOptions(c, args[1:])
+	if !ok {
+		return
+	}
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	var elements []string
+	for _, field := range sortedFields(h) {
+		elements = append(elements, field, h[field])
+	}
+	writeScan(c, opts, elements, 2)
+}
+
+func cmdSScan(c *client, args []string) {
+	opts, ok := parseScanOptions(c, args[1:])
+	if !ok {
+		return
+	}
+	st, err := c.getSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	members := make([]string, 0, len(st))
+	for member := range st {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	writeScan(c, opts, members, 1)
+}
+
+func cmdZScan(c *client, args []string) {
+	opts, ok := parseScanOptions(c, args[1:])
+	if !ok {
+		return
+	}
+	z, err := c.getZSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	members := make([]string, 0, len(z))
+	for member := range z {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	var elements []string
+	for _, member := range members {
+		elements = append(elements, member, formatFloat(z[member]))
+	}
+	writeScan(c, opts, elements, 2)
+}
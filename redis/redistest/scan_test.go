@@ -0,0 +1,48 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 游标遍历相关命令
+package redistest
+
+import (
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	server.FlushAll()
+	conn := dial(t)
+	defer conn.Close()
+	conn.Do("mset", "scan:a", "1", "scan:b", "2", "scan:c", "3", "other", "4")
+	conn.Do("hset", "scan:hash", "f1", "1", "f2", "2")
+	conn.Do("sadd", "scan:set", "a", "b")
+	conn.Do("zadd", "scan:zset", 1, "a", 2, "b")
+	runCommands(t, conn, []commandTest{
+		{name: "scan", args: []interface{}{"scan", 0, "count", 3},
+			want: []interface{}{"1", []interface{}{"other", "scan:a", "scan:b"}}},
+		{name: "delete scanned", args: []interface{}{"del", "scan:a"}, want: int64(1)},
+		{name: "scan next", args: []interface{}{"scan", 1, "match", "scan:?", "count", 3},
+			want: []interface{}{"2", []interface{}{"scan:c"}}},
+		{name: "scan end", args: []interface{}{"scan", 2, "count", 3},
+			want: []interface{}{"0", []interface{}{"scan:zset"}}},
+		{name: "hscan", args: []interface{}{"hscan", "scan:hash", 0, "match", "f2"},
+			want: []interface{}{"0", []interface{}{"f2", "2"}}},
+		{name: "sscan", args: []interface{}{"sscan", "scan:set", 0},
+			want: []interface{}{"0", []interface{}{"a", "b"}}},
+		{name: "zscan", args: []interface{}{"zscan", "scan:zset", 0, "count", 1},
+			want: []interface{}{"3", []interface{}{"a", "1"}}},
+		{name: "unknown cursor", args: []interface{}{"scan", 100}, want: errReply},
+		{name: "invalid cursor", args: []interface{}{"scan", "x"}, want: errReply},
+		{name: "invalid option", args: []interface{}{"scan", 0, "type"}, want: errReply},
+	})
+}
@@ -0,0 +1,281 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 内存 redis 服务，用于单元测试
+//
+// 只实现了 redis 包及其调用方测试用到的命令子集，以下命令不支持，返回 unknown command 错误：
+// lua 脚本（EVAL、EVALSHA、SCRIPT）、stream（X*）、HyperLogLog（PF*）、
+// ROLE 及哨兵、集群命令、ACL、阻塞命令（BLPOP 等）。
+// 依赖这些命令的功能（分布式锁、redlock、脚本、stream 消费组、延迟队列、布隆过滤器、哨兵）
+// 需要连接真实的 redis 测试，见 redis 包测试中的 REDIS_TEST_ADDR
+package redistest
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 内存 redis 服务，监听 127.0.0.1 的随机端口
+// 支持 string、过期时间、hash、list、set、sorted set、geo、SCAN、发布订阅和 MULTI/EXEC，
+// 不支持的命令见包注释
+type Server struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	// 所有命令在 mu 下串行执行
+	mu       sync.Mutex
+	password string
+	dbs      map[int]*db
+	// 时钟偏移，用于测试过期时间
+	offset time.Duration
+	// key 的修改版本，用于 WATCH
+	versions map[string]uint64
+	// SCAN 游标对应的上一次返回的最后一个元素
+	cursors map[int]string
+	clients map[*client]struct{}
+}
+
+// 创建并启动服务
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener: listener,
+		dbs:      make(map[int]*db),
+		versions: make(map[string]uint64),
+		cursors:  make(map[int]string),
+		clients:  make(map[*client]struct{}),
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// 监听地址，可直接作为 RedisConfig.Address
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// 关闭服务并断开所有连接
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// 断开所有已建立的连接，服务继续运行，用于测试断线重连
+func (s *Server) CloseClients() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+}
+
+// 设置密码，之后建立的连接需要先 AUTH
+func (s *Server) RequirePass(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password = password
+}
+
+// 服务端当前时间
+func (s *Server) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now()
+}
+
+// 设置服务端当前时间，之后时间继续正常流逝
+func (s *Server) SetTime(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset = t.Sub(time.Now())
+}
+
+// 将服务端时间向后拨动 d，用于测试过期
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+}
+
+// 清空所有数据库
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushAll()
+}
+
+// 获取 0 号数据库中 key 对应的 string 值
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it := s.lookup(0, key)
+	if it == nil {
+		return "", false
+	}
+	value, ok := it.value.(string)
+	return value, ok
+}
+
+// 设置 0 号数据库中 key 对应的 string 值
+func (s *Server) Set(key string, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setItem(0, key, &item{value: value})
+}
+
+// 获取 0 号数据库中 key 的剩余过期时间，key 不存在或未设置过期时间时返回 0
+func (s *Server) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it := s.lookup(0, key)
+	if it == nil || it.expireAt.IsZero() {
+		return 0
+	}
+	return it.expireAt.Sub(s.now())
+}
+
+// 获取 0 号数据库中的所有 key，按字典序排序
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := s.db(0).keys(s, 0, "*")
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := newClient(s, conn)
+		s.mu.Lock()
+		s.clients[c] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serve(c)
+	}
+}
+
+func (s *Server) serve(c *client) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		c.conn.Close()
+	}()
+	for {
+		args, err := c.readCommand()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		quit := c.execute(args)
+		err = c.w.Flush()
+		s.mu.Unlock()
+		if quit || err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+func (s *Server) db(index int) *db {
+	d, ok := s.dbs[index]
+	if !ok {
+		d = &db{items: make(map[string]*item)}
+		s.dbs[index] = d
+	}
+	return d
+}
+
+// 查找 key，已过期的 key 会被删除
+func (s *Server) lookup(index int, key string) *item {
+	d := s.db(index)
+	it, ok := d.items[key]
+	if !ok {
+		return nil
+	}
+	if it.expired(s.now()) {
+		delete(d.items, key)
+		s.touch(index, key)
+		return nil
+	}
+	return it
+}
+
+func (s *Server) setItem(index int, key string, it *item) {
+	s.db(index).items[key] = it
+	s.touch(index, key)
+}
+
+func (s *Server) delItem(index int, key string) bool {
+	if s.lookup(index, key) == nil {
+		return false
+	}
+	delete(s.db(index).items, key)
+	s.touch(index, key)
+	return true
+}
+
+// 记录 key 被修改，使 WATCH 该 key 的事务失败
+func (s *Server) touch(index int, key string) {
+	s.versions[versionKey(index, key)]++
+}
+
+func (s *Server) version(index int, key string) uint64 {
+	return s.versions[versionKey(index, key)]
+}
+
+func (s *Server) flushDB(index int) {
+	for key := range s.db(index).items {
+		s.touch(index, key)
+	}
+	s.dbs[index] = &db{items: make(map[string]*item)}
+}
+
+func (s *Server) flushAll() {
+	for index := range s.dbs {
+		s.flushDB(index)
+	}
+}
+
+// 创建一个新的 SCAN 游标
+func (s *Server) newCursor(after string) int {
+	cursor := len(s.cursors) + 1
+	s.cursors[cursor] = after
+	return cursor
+}
+
+func versionKey(index int, key string) string {
+	return strconv.Itoa(index) + ":" + key
+}
@@ -0,0 +1,214 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 内存 redis 服务，用于单元测试
+package redistest
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/liuchonglin/go-tools/redis"
+)
+
+var server *Server
+
+// 连接测试服务
+func dial(t *testing.T) redigo.Conn {
+	conn, err := redigo.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	return conn
+}
+
+// 依次执行命令并比较结果，want 为 error 时只比较错误是否存在
+type commandTest struct {
+	name string
+	args []interface{}
+	want interface{}
+}
+
+func runCommands(t *testing.T, conn redigo.Conn, tests []commandTest) {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := conn.Do(tt.args[0].(string), tt.args[1:]...)
+			if wantErr, ok := tt.want.(error); ok {
+				if err == nil {
+					t.Errorf("%v error = nil, want %v", tt.args, wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%v error = %v", tt.args, err)
+			}
+			if !reflect.DeepEqual(normalize(got), tt.want) {
+				t.Errorf("%v = %#v, want %#v", tt.args, normalize(got), tt.want)
+			}
+		})
+	}
+}
+
+// 将回复中的 []byte 转换为 string，便于比较
+func normalize(reply interface{}) interface{} {
+	switch v := reply.(type) {
+	case []byte:
+		return string(v)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, e := range v {
+			values[i] = normalize(e)
+		}
+		return values
+	}
+	return reply
+}
+
+func TestNewRedis(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer s.Close()
+	s.RequirePass("secret")
+	tests := []struct {
+		name     string
+		password string
+		db       int
+		wantErr  bool
+	}{
+		{
+			name:     "all",
+			password: "secret",
+			db:       1,
+		}, {
+			name:     "wrong password",
+			password: "wrong",
+			wantErr:  true,
+		}, {
+			name:    "password nil",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := redis.NewRedis(&redis.RedisConfig{Address: s.Addr(), Password: tt.password, DB: tt.db})
+			if err != nil {
+				// 密码错误时连接阶段的 AUTH 失败
+				if !tt.wantErr {
+					t.Errorf("NewRedis() error = %v", err)
+				}
+				return
+			}
+			// 未认证时命令返回 NOAUTH
+			if err := r.Set("server:key", "value"); (err != nil) != tt.wantErr {
+				t.Fatalf("Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got, err := r.Get("server:key"); err != nil || got != "value" {
+				t.Errorf("Get() = %v, %v, want value", got, err)
+			}
+			// 写入的是 1 号数据库
+			if _, ok := s.Get("server:key"); ok {
+				t.Errorf("Server.Get() ok = true, want false")
+			}
+		})
+	}
+}
+
+func TestServerClock(t *testing.T) {
+	server.FlushAll()
+	conn := dial(t)
+	defer conn.Close()
+	conn.Do("set", "clock:key", "value", "ex", 10)
+	if ttl := server.TTL("clock:key"); ttl <= 9*time.Second || ttl > 10*time.Second {
+		t.Errorf("TTL() = %v, want 10s", ttl)
+	}
+	server.FastForward(9 * time.Second)
+	if ttl, _ := redigo.Int(conn.Do("ttl", "clock:key")); ttl != 1 {
+		t.Errorf("ttl = %v, want 1", ttl)
+	}
+	server.FastForward(time.Second)
+	if _, ok := server.Get("clock:key"); ok {
+		t.Errorf("Get() after expire ok = true, want false")
+	}
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	server.SetTime(now)
+	if got := server.Now(); got.Sub(now) < 0 || got.Sub(now) > time.Second {
+		t.Errorf("Now() = %v, want %v", got, now)
+	}
+}
+
+func TestServerHelpers(t *testing.T) {
+	server.FlushAll()
+	server.Set("helper:b", "2")
+	server.Set("helper:a", "1")
+	if got := server.Keys(); !reflect.DeepEqual(got, []string{"helper:a", "helper:b"}) {
+		t.Errorf("Keys() = %v", got)
+	}
+	if got, ok := server.Get("helper:a"); !ok || got != "1" {
+		t.Errorf("Get() = %v, %v, want 1, true", got, ok)
+	}
+	if ttl := server.TTL("helper:a"); ttl != 0 {
+		t.Errorf("TTL() = %v, want 0", ttl)
+	}
+}
+
+func TestCloseClients(t *testing.T) {
+	conn := dial(t)
+	defer conn.Close()
+	if _, err := conn.Do("ping"); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	server.CloseClients()
+	if _, err := conn.Do("ping"); err == nil {
+		t.Errorf("Do() after CloseClients() error = nil, want error")
+	}
+	other := dial(t)
+	defer other.Close()
+	if _, err := other.Do("ping"); err != nil {
+		t.Errorf("Do() on new connection error = %v", err)
+	}
+}
+
+func TestConnection(t *testing.T) {
+	conn := dial(t)
+	defer conn.Close()
+	runCommands(t, conn, []commandTest{
+		{name: "ping", args: []interface{}{"ping"}, want: "PONG"},
+		{name: "ping message", args: []interface{}{"ping", "hi"}, want: "hi"},
+		{name: "echo", args: []interface{}{"echo", "hi"}, want: "hi"},
+		{name: "select", args: []interface{}{"select", 2}, want: "OK"},
+		{name: "select out of range", args: []interface{}{"select", 16}, want: redigo.ErrNil},
+		{name: "auth without password", args: []interface{}{"auth", "secret"}, want: redigo.ErrNil},
+		{name: "unknown", args: []interface{}{"unknown"}, want: redigo.ErrNil},
+		{name: "arity", args: []interface{}{"get"}, want: redigo.ErrNil},
+	})
+}
+
+func TestMain(m *testing.M) {
+	var err error
+	server, err = NewServer()
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
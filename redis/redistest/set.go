@@ -0,0 +1,99 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// set 相关命令
+package redistest
+
+import (
+	"sort"
+)
+
+var setCommands = map[string]*command{
+	"sadd":      {handler: cmdSAdd, arity: -3},
+	"srem":      {handler: cmdSRem, arity: -3},
+	"smembers":  {handler: cmdSMembers, arity: 2},
+	"sismember": {handler: cmdSIsMember, arity: 3},
+	"scard":     {handler: cmdSCard, arity: 2},
+}
+
+func cmdSAdd(c *client, args []string) {
+	st, err := c.getSet(args[0], true)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	var n int64
+	for _, member := range args[1:] {
+		if _, ok := st[member]; !ok {
+			st[member] = struct{}{}
+			n++
+		}
+	}
+	c.touch(args[0])
+	c.writeInt(n)
+}
+
+func cmdSRem(c *client, args []string) {
+	st, err := c.getSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	var n int64
+	for _, member := range args[1:] {
+		if _, ok := st[member]; ok {
+			delete(st, member)
+			n++
+		}
+	}
+	if n > 0 {
+		c.touch(args[0])
+		c.removeIfEmpty(args[0])
+	}
+	c.writeInt(n)
+}
+
+// 按字典序返回，保证结果稳定
+func cmdSMembers(c *client, args []string) {
+	st, err := c.getSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	members := make([]string, 0, len(st))
+	for member := range st {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	c.writeStrings(members)
+}
+
+func cmdSIsMember(c *client, args []string) {
+	st, err := c.getSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	_, ok := st[args[1]]
+	c.writeBool(ok)
+}
+
+func cmdSCard(c *client, args []string) {
+	st, err := c.getSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.writeInt(int64(len(st)))
+}
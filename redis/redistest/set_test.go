@@ -0,0 +1,37 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// set 相关命令
+package redistest
+
+import (
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	server.FlushAll()
+	conn := dial(t)
+	defer conn.Close()
+	runCommands(t, conn, []commandTest{
+		{name: "sadd", args: []interface{}{"sadd", "set", "b", "a", "b"}, want: int64(2)},
+		{name: "smembers", args: []interface{}{"smembers", "set"}, want: []interface{}{"a", "b"}},
+		{name: "sismember", args: []interface{}{"sismember", "set", "a"}, want: int64(1)},
+		{name: "sismember nil", args: []interface{}{"sismember", "set", "x"}, want: int64(0)},
+		{name: "scard", args: []interface{}{"scard", "set"}, want: int64(2)},
+		{name: "srem", args: []interface{}{"srem", "set", "a", "b", "x"}, want: int64(2)},
+		{name: "empty removed", args: []interface{}{"exists", "set"}, want: int64(0)},
+		{name: "set", args: []interface{}{"set", "str", "v"}, want: "OK"},
+		{name: "sadd wrong type", args: []interface{}{"sadd", "str", "a"}, want: errReply},
+	})
+}
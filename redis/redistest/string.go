@@ -0,0 +1,272 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// string 相关命令
+package redistest
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+var stringCommands = map[string]*command{
+	"get":         {handler: cmdGet, arity: 2},
+	"set":         {handler: cmdSet, arity: -3},
+	"setnx":       {handler: cmdSetNX, arity: 3},
+	"setex":       {handler: cmdSetEX, arity: 4},
+	"getset":      {handler: cmdGetSet, arity: 3},
+	"mget":        {handler: cmdMGet, arity: -2},
+	"mset":        {handler: cmdMSet, arity: -3},
+	"incr":        {handler: cmdIncr, arity: 2},
+	"decr":        {handler: cmdDecr, arity: 2},
+	"incrby":      {handler: cmdIncrBy, arity: 3},
+	"decrby":      {handler: cmdDecrBy, arity: 3},
+	"incrbyfloat": {handler: cmdIncrByFloat, arity: 3},
+}
+
+func cmdGet(c *client, args []string) {
+	value, ok, err := c.getString(args[0])
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	if !ok {
+		c.writeNull()
+		return
+	}
+	c.writeBulk(value)
+}
+
+// SET key value [EX seconds|PX milliseconds|KEEPTTL] [NX|XX] [GET]
+func cmdSet(c *client, args []string) {
+	key, value := args[0], args[1]
+	var expireAt time.Time
+	var nx, xx, keepTTL, get, hasExpire bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i]); opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "keepttl":
+			keepTTL = true
+		case "get":
+			get = true
+		case "ex", "px":
+			if hasExpire || i+1 >= len(args) {
+				c.writeSyntaxError()
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				c.writeNotInteger()
+				return
+			}
+			if n <= 0 {
+				c.writeError("ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Second
+			if opt == "px" {
+				unit = time.Millisecond
+			}
+			hasExpire = true
+			expireAt = c.server.now().Add(time.Duration(n) * unit)
+		default:
+			c.writeSyntaxError()
+			return
+		}
+	}
+	if (nx && xx) || (keepTTL && hasExpire) {
+		c.writeSyntaxError()
+		return
+	}
+	// 不带 GET 时可以覆盖其他类型的值
+	old, exists, err := c.getString(key)
+	if err != nil && get {
+		c.writeErr(err)
+		return
+	}
+	present := c.lookup(key) != nil
+	if (nx && present) || (xx && !present) {
+		if get {
+			writeOld(c, old, exists)
+			return
+		}
+		c.writeNull()
+		return
+	}
+	if keepTTL {
+		if it := c.lookup(key); it != nil {
+			expireAt = it.expireAt
+		}
+	}
+	c.setItem(key, &item{value: value, expireAt: expireAt})
+	if get {
+		writeOld(c, old, exists)
+		return
+	}
+	c.writeOK()
+}
+
+func writeOld(c *client, old string, exists bool) {
+	if !exists {
+		c.writeNull()
+		return
+	}
+	c.writeBulk(old)
+}
+
+func cmdSetNX(c *client, args []string) {
+	if c.lookup(args[0]) != nil {
+		c.writeInt(0)
+		return
+	}
+	c.setItem(args[0], &item{value: args[1]})
+	c.writeInt(1)
+}
+
+func cmdSetEX(c *client, args []string) {
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		c.writeNotInteger()
+		return
+	}
+	if n <= 0 {
+		c.writeError("ERR invalid expire time in 'setex' command")
+		return
+	}
+	c.setItem(args[0], &item{value: args[2], expireAt: c.server.now().Add(time.Duration(n) * time.Second)})
+	c.writeOK()
+}
+
+// 设置新值并返回旧值，清除过期时间
+func cmdGetSet(c *client, args []string) {
+	old, exists, err := c.getString(args[0])
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.setItem(args[0], &item{value: args[1]})
+	writeOld(c, old, exists)
+}
+
+func cmdMGet(c *client, args []string) {
+	c.writeArray(len(args))
+	for _, key := range args {
+		// 类型不是 string 时返回 nil
+		value, ok, err := c.getString(key)
+		if !ok || err != nil {
+			c.writeNull()
+			continue
+		}
+		c.writeBulk(value)
+	}
+}
+
+func cmdMSet(c *client, args []string) {
+	if len(args)%2 != 0 {
+		c.writeError("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+	for i := 0; i < len(args); i += 2 {
+		c.setItem(args[i], &item{value: args[i+1]})
+	}
+	c.writeOK()
+}
+
+func cmdIncr(c *client, args []string) {
+	incrBy(c, args[0], 1)
+}
+
+func cmdDecr(c *client, args []string) {
+	incrBy(c, args[0], -1)
+}
+
+func cmdIncrBy(c *client, args []string) {
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		c.writeNotInteger()
+		return
+	}
+	incrBy(c, args[0], n)
+}
+
+func cmdDecrBy(c *client, args []string) {
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		c.writeNotInteger()
+		return
+	}
+	incrBy(c, args[0], -n)
+}
+
+// 自增，保留原有的过期时间
+func incrBy(c *client, key string, delta int64) {
+	value, ok, err := c.getString(key)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	var n int64
+	if ok {
+		if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+			c.writeNotInteger()
+			return
+		}
+	}
+	if (delta > 0 && n > n+delta) || (delta < 0 && n < n+delta) {
+		c.writeError("ERR increment or decrement would overflow")
+		return
+	}
+	n += delta
+	setKeepTTL(c, key, strconv.FormatInt(n, 10))
+	c.writeInt(n)
+}
+
+func cmdIncrByFloat(c *client, args []string) {
+	delta, ok := parseFloat(args[1])
+	if !ok {
+		c.writeNotFloat()
+		return
+	}
+	value, exists, err := c.getString(args[0])
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	var f float64
+	if exists {
+		if f, ok = parseFloat(value); !ok {
+			c.writeNotFloat()
+			return
+		}
+	}
+	f += delta
+	value = formatFloat(f)
+	setKeepTTL(c, args[0], value)
+	c.writeBulk(value)
+}
+
+// 设置值并保留原有的过期时间
+func setKeepTTL(c *client, key string, value string) {
+	if it := c.lookup(key); it != nil {
+		it.value = value
+		c.touch(key)
+		return
+	}
+	c.setItem(key, &item{value: value})
+}
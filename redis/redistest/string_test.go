@@ -0,0 +1,60 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// string 相关命令
+package redistest
+
+import (
+	"errors"
+	"testing"
+)
+
+var errReply = errors.New("error reply")
+
+func TestString(t *testing.T) {
+	server.FlushAll()
+	conn := dial(t)
+	defer conn.Close()
+	runCommands(t, conn, []commandTest{
+		{name: "get nil", args: []interface{}{"get", "str:a"}, want: nil},
+		{name: "set", args: []interface{}{"set", "str:a", "1"}, want: "OK"},
+		{name: "get", args: []interface{}{"get", "str:a"}, want: "1"},
+		{name: "set nx exists", args: []interface{}{"set", "str:a", "2", "nx"}, want: nil},
+		{name: "set xx", args: []interface{}{"set", "str:a", "2", "xx", "ex", 10}, want: "OK"},
+		{name: "set keepttl", args: []interface{}{"set", "str:a", "3", "keepttl"}, want: "OK"},
+		{name: "ttl kept", args: []interface{}{"ttl", "str:a"}, want: int64(10)},
+		{name: "set get", args: []interface{}{"set", "str:a", "4", "get"}, want: "3"},
+		{name: "ttl cleared", args: []interface{}{"ttl", "str:a"}, want: int64(-1)},
+		{name: "set xx missing", args: []interface{}{"set", "str:b", "1", "xx"}, want: nil},
+		{name: "set nx xx", args: []interface{}{"set", "str:b", "1", "nx", "xx"}, want: errReply},
+		{name: "set ex invalid", args: []interface{}{"set", "str:b", "1", "ex", 0}, want: errReply},
+		{name: "setnx", args: []interface{}{"setnx", "str:b", "1"}, want: int64(1)},
+		{name: "setex", args: []interface{}{"setex", "str:c", 5, "1"}, want: "OK"},
+		{name: "getset", args: []interface{}{"getset", "str:c", "2"}, want: "1"},
+		{name: "getset clears ttl", args: []interface{}{"ttl", "str:c"}, want: int64(-1)},
+		{name: "mset", args: []interface{}{"mset", "str:d", "1", "str:e", "2"}, want: "OK"},
+		{name: "mget", args: []interface{}{"mget", "str:d", "str:x", "str:e"}, want: []interface{}{"1", nil, "2"}},
+		{name: "incr", args: []interface{}{"incr", "str:n"}, want: int64(1)},
+		{name: "incrby", args: []interface{}{"incrby", "str:n", 10}, want: int64(11)},
+		{name: "decr", args: []interface{}{"decr", "str:n"}, want: int64(10)},
+		{name: "decrby", args: []interface{}{"decrby", "str:n", 3}, want: int64(7)},
+		{name: "incr existing", args: []interface{}{"incr", "str:a"}, want: int64(5)},
+		{name: "incrbyfloat", args: []interface{}{"incrbyfloat", "str:f", "1.5"}, want: "1.5"},
+		{name: "incrbyfloat again", args: []interface{}{"incrbyfloat", "str:f", "-0.5"}, want: "1"},
+		{name: "incr missing", args: []interface{}{"incr", "str:h"}, want: int64(1)},
+		{name: "hset", args: []interface{}{"hset", "str:hash", "f", "v"}, want: int64(1)},
+		{name: "get wrong type", args: []interface{}{"get", "str:hash"}, want: errReply},
+		{name: "set overwrite type", args: []interface{}{"set", "str:hash", "v"}, want: "OK"},
+	})
+}
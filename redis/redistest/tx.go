@@ -0,0 +1,106 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 事务相关命令
+package redistest
+
+import "strings"
+
+var txCommands = map[string]*command{
+	"multi":   {handler: cmdMulti, arity: 1, noQueue: true},
+	"exec":    {handler: cmdExec, arity: 1, noQueue: true},
+	"discard": {handler: cmdDiscard, arity: 1, noQueue: true},
+	"watch":   {handler: cmdWatch, arity: -2, noQueue: true},
+	"unwatch": {handler: cmdUnwatch, arity: 1},
+}
+
+func cmdMulti(c *client, args []string) {
+	if c.multi {
+		c.writeError("ERR MULTI calls can not be nested")
+		return
+	}
+	c.multi = true
+	c.writeOK()
+}
+
+// 执行排队的命令，WATCH 的 key 被修改时返回 nil
+func cmdExec(c *client, args []string) {
+	if !c.multi {
+		c.writeError("ERR EXEC without MULTI")
+		return
+	}
+	queue, dirty, watched := c.queue, c.dirty, c.watchedUnchanged()
+	c.resetTx()
+	if dirty {
+		c.writeError("EXECABORT Transaction discarded because of previous errors.")
+		return
+	}
+	if !watched {
+		c.writeNullArray()
+		return
+	}
+	c.writeArray(len(queue))
+	for _, args := range queue {
+		commands[strings.ToLower(args[0])].handler(c, args[1:])
+	}
+}
+
+func cmdDiscard(c *client, args []string) {
+	if !c.multi {
+		c.writeError("ERR DISCARD without MULTI")
+		return
+	}
+	c.resetTx()
+	c.writeOK()
+}
+
+func cmdWatch(c *client, args []string) {
+	if c.multi {
+		c.writeError("ERR WATCH inside MULTI is not allowed")
+		return
+	}
+	if c.watches == nil {
+		c.watches = make(map[string]uint64)
+	}
+	for _, key := range args {
+		// 先访问一次 key，使已过期的 key 在 WATCH 之前被删除
+		c.lookup(key)
+		if _, ok := c.watches[versionKey(c.dbIndex, key)]; !ok {
+			c.watches[versionKey(c.dbIndex, key)] = c.server.version(c.dbIndex, key)
+		}
+	}
+	c.writeOK()
+}
+
+func cmdUnwatch(c *client, args []string) {
+	c.watches = nil
+	c.writeOK()
+}
+
+// WATCH 的 key 是否都没有被修改
+func (c *client) watchedUnchanged() bool {
+	for key, version := range c.watches {
+		if c.server.versions[key] != version {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *client) resetTx() {
+	c.multi = false
+	c.queue = nil
+	c.dirty = false
+	c.watches = nil
+}
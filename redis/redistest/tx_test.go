@@ -0,0 +1,81 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 事务相关命令
+package redistest
+
+import (
+	"testing"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+func TestTx(t *testing.T) {
+	server.FlushAll()
+	conn := dial(t)
+	defer conn.Close()
+	runCommands(t, conn, []commandTest{
+		{name: "exec without multi", args: []interface{}{"exec"}, want: errReply},
+		{name: "multi", args: []interface{}{"multi"}, want: "OK"},
+		{name: "multi nested", args: []interface{}{"multi"}, want: errReply},
+		{name: "queued set", args: []interface{}{"set", "tx:a", "1"}, want: "QUEUED"},
+		{name: "queued incr", args: []interface{}{"incr", "tx:a"}, want: "QUEUED"},
+		{name: "queued get", args: []interface{}{"get", "tx:a"}, want: "QUEUED"},
+		{name: "exec", args: []interface{}{"exec"}, want: []interface{}{"OK", int64(2), "2"}},
+		{name: "multi discard", args: []interface{}{"multi"}, want: "OK"},
+		{name: "queued discarded", args: []interface{}{"set", "tx:a", "3"}, want: "QUEUED"},
+		{name: "discard", args: []interface{}{"discard"}, want: "OK"},
+		{name: "not changed", args: []interface{}{"get", "tx:a"}, want: "2"},
+		{name: "multi abort", args: []interface{}{"multi"}, want: "OK"},
+		{name: "unknown", args: []interface{}{"unknown"}, want: errReply},
+		{name: "execabort", args: []interface{}{"exec"}, want: errReply},
+	})
+}
+
+// WATCH 的 key 被其他连接修改后 EXEC 返回 nil
+func TestTxWatch(t *testing.T) {
+	server.FlushAll()
+	conn := dial(t)
+	defer conn.Close()
+	other := dial(t)
+	defer other.Close()
+	tests := []struct {
+		name    string
+		modify  bool
+		wantNil bool
+	}{
+		{name: "unchanged"},
+		{name: "changed", modify: true, wantNil: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn.Do("watch", "tx:watch")
+			if tt.modify {
+				other.Do("set", "tx:watch", "other")
+			}
+			conn.Send("multi")
+			conn.Send("set", "tx:watch", "mine")
+			reply, err := conn.Do("exec")
+			if err != nil {
+				t.Fatalf("exec error = %v", err)
+			}
+			if (reply == nil) != tt.wantNil {
+				t.Errorf("exec = %v, wantNil %v", reply, tt.wantNil)
+			}
+		})
+	}
+	if got, _ := redigo.String(conn.Do("get", "tx:watch")); got != "other" {
+		t.Errorf("get = %v, want other", got)
+	}
+}
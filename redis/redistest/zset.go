@@ -0,0 +1,397 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// sorted set 相关命令
+package redistest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var zsetCommands = map[string]*command{
+	"zadd":             {handler: cmdZAdd, arity: -4},
+	"zrem":             {handler: cmdZRem, arity: -3},
+	"zincrby":          {handler: cmdZIncrBy, arity: 4},
+	"zscore":           {handler: cmdZScore, arity: 3},
+	"zcard":            {handler: cmdZCard, arity: 2},
+	"zcount":           {handler: cmdZCount, arity: 4},
+	"zrank":            {handler: cmdZRank, arity: 3},
+	"zrange":           {handler: cmdZRange, arity: -4},
+	"zrevrange":        {handler: cmdZRevRange, arity: -4},
+	"zrangebyscore":    {handler: cmdZRangeByScore, arity: -4},
+	"zrevrangebyscore": {handler: cmdZRevRangeByScore, arity: -4},
+}
+
+// 有序集合的成员
+type zmember struct {
+	member string
+	score  float64
+}
+
+// 分数区间，支持 -inf、+inf 和 ( 开区间
+type scoreRange struct {
+	min, max               float64
+	minExclude, maxExclude bool
+}
+
+func (r scoreRange) contains(score float64) bool {
+	if score < r.min || (r.minExclude && score == r.min) {
+		return false
+	}
+	if score > r.max || (r.maxExclude && score == r.max) {
+		return false
+	}
+	return true
+}
+
+func parseScoreRange(min, max string) (scoreRange, bool) {
+	var r scoreRange
+	var ok1, ok2 bool
+	r.min, r.minExclude, ok1 = parseScoreBound(min)
+	r.max, r.maxExclude, ok2 = parseScoreBound(max)
+	return r, ok1 && ok2
+}
+
+func parseScoreBound(s string) (float64, bool, bool) {
+	exclude := strings.HasPrefix(s, "(")
+	if exclude {
+		s = s[1:]
+	}
+	f, ok := parseFloat(s)
+	return f, exclude, ok
+}
+
+// ZADD key [NX|XX] [CH] [INCR] score member [score member ...]
+func cmdZAdd(c *client, args []string) {
+	key := args[0]
+	var nx, xx, ch, incr bool
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			nx = true
+			continue
+		case "xx":
+			xx = true
+			continue
+		case "ch":
+			ch = true
+			continue
+		case "incr":
+			incr = true
+			continue
+		}
+		break
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 || (nx && xx) || (incr && len(pairs) != 2) {
+		c.writeSyntaxError()
+		return
+	}
+	scores := make([]float64, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, ok := parseFloat(pairs[j])
+		if !ok {
+			c.writeNotFloat()
+			return
+		}
+		scores = append(scores, score)
+	}
+	z, err := c.getZSet(key, !xx)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	if z == nil {
+		if incr {
+			c.writeNull()
+		} else {
+			c.writeInt(0)
+		}
+		return
+	}
+	var added, changed int64
+	var result float64
+	skipped := false
+	for j := 0; j < len(pairs); j += 2 {
+		member, score := pairs[j+1], scores[j/2]
+		old, exists := z[member]
+		if (nx && exists) || (xx && !exists) {
+			skipped = true
+			continue
+		}
+		if incr {
+			score += old
+		}
+		result = score
+		if !exists {
+			added++
+		} else if old != score {
+			changed++
+		}
+		z[member] = score
+	}
+	c.touch(key)
+	c.removeIfEmpty(key)
+	if incr {
+		if skipped {
+			c.writeNull()
+			return
+		}
+		c.writeFloat(result)
+		return
+	}
+	if ch {
+		c.writeInt(added + changed)
+		return
+	}
+	c.writeInt(added)
+}
+
+func cmdZRem(c *client, args []string) {
+	z, err := c.getZSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	var n int64
+	for _, member := range args[1:] {
+		if _, ok := z[member]; ok {
+			delete(z, member)
+			n++
+		}
+	}
+	if n > 0 {
+		c.touch(args[0])
+		c.removeIfEmpty(args[0])
+	}
+	c.writeInt(n)
+}
+
+func cmdZIncrBy(c *client, args []string) {
+	delta, ok := parseFloat(args[1])
+	if !ok {
+		c.writeNotFloat()
+		return
+	}
+	z, err := c.getZSet(args[0], true)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	z[args[2]] += delta
+	c.touch(args[0])
+	c.writeFloat(z[args[2]])
+}
+
+func cmdZScore(c *client, args []string) {
+	z, err := c.getZSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	score, ok := z[args[1]]
+	if !ok {
+		c.writeNull()
+		return
+	}
+	c.writeFloat(score)
+}
+
+func cmdZCard(c *client, args []string) {
+	z, err := c.getZSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.writeInt(int64(len(z)))
+}
+
+func cmdZCount(c *client, args []string) {
+	r, ok := parseScoreRange(args[1], args[2])
+	if !ok {
+		c.writeError("ERR min or max is not a float")
+		return
+	}
+	z, err := c.getZSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	var n int64
+	for _, score := range z {
+		if r.contains(score) {
+			n++
+		}
+	}
+	c.writeInt(n)
+}
+
+func cmdZRank(c *client, args []string) {
+	z, err := c.getZSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	for i, m := range sortedMembers(z) {
+		if m.member == args[1] {
+			c.writeInt(int64(i))
+			return
+		}
+	}
+	c.writeNull()
+}
+
+func cmdZRange(c *client, args []string) {
+	zrange(c, args, false)
+}
+
+func cmdZRevRange(c *client, args []string) {
+	zrange(c, args, true)
+}
+
+// ZRANGE key start stop [WITHSCORES]
+func zrange(c *client, args []string, reverse bool) {
+	start, err1 := strconv.ParseInt(args[1], 10, 64)
+	stop, err2 := strconv.ParseInt(args[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		c.writeNotInteger()
+		return
+	}
+	withScores := false
+	for _, opt := range args[3:] {
+		if strings.ToLower(opt) != "withscores" {
+			c.writeSyntaxError()
+			return
+		}
+		withScores = true
+	}
+	z, err := c.getZSet(args[0], false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	members := sortedMembers(z)
+	if reverse {
+		reverseMembers(members)
+	}
+	from, to, ok := rangeIndex(start, stop, len(members))
+	if !ok {
+		c.writeStrings(nil)
+		return
+	}
+	writeMembers(c, members[from:to], withScores)
+}
+
+func cmdZRangeByScore(c *client, args []string) {
+	zrangeByScore(c, args[0], args[1], args[2], args[3:], false)
+}
+
+func cmdZRevRangeByScore(c *client, args []string) {
+	zrangeByScore(c, args[0], args[2], args[1], args[3:], true)
+}
+
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func zrangeByScore(c *client, key, min, max string, opts []string, reverse bool) {
+	r, ok := parseScoreRange(min, max)
+	if !ok {
+		c.writeError("ERR min or max is not a float")
+		return
+	}
+	withScores := false
+	offset, count := int64(0), int64(-1)
+	for i := 0; i < len(opts); i++ {
+		switch strings.ToLower(opts[i]) {
+		case "withscores":
+			withScores = true
+		case "limit":
+			if i+2 >= len(opts) {
+				c.writeSyntaxError()
+				return
+			}
+			var err1, err2 error
+			offset, err1 = strconv.ParseInt(opts[i+1], 10, 64)
+			count, err2 = strconv.ParseInt(opts[i+2], 10, 64)
+			if err1 != nil || err2 != nil {
+				c.writeNotInteger()
+				return
+			}
+			i += 2
+		default:
+			c.writeSyntaxError()
+			return
+		}
+	}
+	z, err := c.getZSet(key, false)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	members := sortedMembers(z)
+	if reverse {
+		reverseMembers(members)
+	}
+	var result []zmember
+	for _, m := range members {
+		if r.contains(m.score) {
+			result = append(result, m)
+		}
+	}
+	if offset < 0 || offset >= int64(len(result)) {
+		result = nil
+	} else {
+		result = result[offset:]
+		if count >= 0 && count < int64(len(result)) {
+			result = result[:count]
+		}
+	}
+	writeMembers(c, result, withScores)
+}
+
+func writeMembers(c *client, members []zmember, withScores bool) {
+	if withScores {
+		c.writeArray(len(members) * 2)
+	} else {
+		c.writeArray(len(members))
+	}
+	for _, m := range members {
+		c.writeBulk(m.member)
+		if withScores {
+			c.writeFloat(m.score)
+		}
+	}
+}
+
+// 按分数从小到大排序，分数相同时按成员字典序
+func sortedMembers(z zset) []zmember {
+	members := make([]zmember, 0, len(z))
+	for member, score := range z {
+		members = append(members, zmember{member: member, score: score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].member < members[j].member
+	})
+	return members
+}
+
+func reverseMembers(members []zmember) {
+	for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+		members[i], members[j] = members[j], members[i]
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 go-tools Authors
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// sorted set 相关命令
+package redistest
+
+import (
+	"testing"
+)
+
+func TestZSet(t *testing.T) {
+	server.FlushAll()
+	conn := dial(t)
+	defer conn.Close()
+	runCommands(t, conn, []commandTest{
+		{name: "zadd", args: []interface{}{"zadd", "zset", 2, "b", 1, "a", 3, "c"}, want: int64(3)},
+		{name: "zadd nx", args: []interface{}{"zadd", "zset", "nx", 10, "a", 4, "d"}, want: int64(1)},
+		{name: "zadd xx ch", args: []interface{}{"zadd", "zset", "xx", "ch", 1.5, "a", 5, "e"}, want: int64(1)},
+		{name: "zadd incr", args: []interface{}{"zadd", "zset", "incr", 1, "d"}, want: "5"},
+		{name: "zadd invalid", args: []interface{}{"zadd", "zset", "x", "a"}, want: errReply},
+		{name: "zscore", args: []interface{}{"zscore", "zset", "a"}, want: "1.5"},
+		{name: "zscore nil", args: []interface{}{"zscore", "zset", "x"}, want: nil},
+		{name: "zincrby", args: []interface{}{"zincrby", "zset", 2, "a"}, want: "3.5"},
+		{name: "zcard", args: []interface{}{"zcard", "zset"}, want: int64(4)},
+		{name: "zrange", args: []interface{}{"zrange", "zset", 0, -1}, want: []interface{}{"b", "c", "a", "d"}},
+		{name: "zrange withscores", args: []interface{}{"zrange", "zset", 0, 0, "withscores"}, want: []interface{}{"b", "2"}},
+		{name: "zrevrange", args: []interface{}{"zrevrange", "zset", 0, 1}, want: []interface{}{"d", "a"}},
+		{name: "zrangebyscore", args: []interface{}{"zrangebyscore", "zset", "(2", "+inf"}, want: []interface{}{"c", "a", "d"}},
+		{name: "zrangebyscore limit", args: []interface{}{"zrangebyscore", "zset", "-inf", "+inf", "withscores", "limit", 1, 1}, want: []interface{}{"c", "3"}},
+		{name: "zrevrangebyscore", args: []interface{}{"zrevrangebyscore", "zset", 4, 3}, want: []interface{}{"a", "c"}},
+		{name: "zcount", args: []interface{}{"zcount", "zset", 2, 3.5}, want: int64(3)},
+		{name: "zrank", args: []interface{}{"zrank", "zset", "a"}, want: int64(2)},
+		{name: "zrem", args: []interface{}{"zrem", "zset", "a", "b", "c", "d"}, want: int64(4)},
+		{name: "empty removed", args: []interface{}{"exists", "zset"}, want: int64(0)},
+	})
+}